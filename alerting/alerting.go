@@ -0,0 +1,269 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+)
+
+// Rule types
+const (
+	TypeThreshold    = "THRESHOLD"      // value above/below a limit
+	TypeRateOfChange = "RATE_OF_CHANGE" // value rose/fell by more than a limit within a window
+	TypeStale        = "STALE"          // no reading for a number of minutes
+)
+
+// Comparison operators
+const (
+	OpGreaterThan = "GT"
+	OpLessThan    = "LT"
+)
+
+// Alert lifecycle states
+const (
+	StatusFiring       = "FIRING"
+	StatusAcknowledged = "ACKNOWLEDGED"
+	StatusResolved     = "RESOLVED"
+)
+
+// Severities
+const (
+	SeverityInfo     = "INFO"
+	SeverityWarning  = "WARNING"
+	SeverityCritical = "CRITICAL"
+)
+
+// openStatuses are the states of an alert that has not been resolved yet
+var openStatuses = []string{StatusFiring, StatusAcknowledged}
+
+// evalMu serializes evaluation so ingest and timer runs don't open duplicate alerts
+var evalMu sync.Mutex
+
+// InitAlerting evaluates rules whenever a sensor reading is stored
+func InitAlerting() {
+	events.Subscribe(events.SensorReading, func(e events.Event) {
+		EvaluateReading(e.Metric, e.Value, e.At)
+	})
+	slog.Info("alerting started")
+}
+
+// IsValidMetric reports whether alerts can be defined for metric
+func IsValidMetric(metric string) bool {
+	return sensors.IsMetric(metric)
+}
+
+// ValidateRule checks that rule is complete for its type
+func ValidateRule(rule *models.AlertRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if !IsValidMetric(rule.Metric) {
+		return fmt.Errorf("unknown metric: %s", rule.Metric)
+	}
+	if rule.Hysteresis < 0 {
+		return errors.New("hysteresis cannot be negative")
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = SeverityWarning
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity: %s", rule.Severity)
+	}
+
+	switch rule.Type {
+	case TypeThreshold:
+		if rule.Operator != OpGreaterThan && rule.Operator != OpLessThan {
+			return errors.New("operator must be GT or LT")
+		}
+	case TypeRateOfChange:
+		if rule.Operator != OpGreaterThan && rule.Operator != OpLessThan {
+			return errors.New("operator must be GT (rising) or LT (falling)")
+		}
+		if rule.Threshold <= 0 {
+			return errors.New("threshold must be greater than 0 for RATE_OF_CHANGE")
+		}
+		if rule.WindowMinutes <= 0 {
+			return errors.New("window_minutes must be greater than 0 for RATE_OF_CHANGE")
+		}
+	case TypeStale:
+		if rule.StaleMinutes <= 0 {
+			return errors.New("stale_minutes must be greater than 0 for STALE")
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", rule.Type)
+	}
+	return nil
+}
+
+// EvaluateReading checks threshold and rate-of-change rules for a new
+// reading and resolves stale alerts for its metric
+func EvaluateReading(metric string, value float64, at time.Time) {
+	evalMu.Lock()
+	defer evalMu.Unlock()
+
+	var rules []models.AlertRule
+	if err := database.DB.Where("metric = ? AND is_active = ?", metric, true).Find(&rules).Error; err != nil {
+		slog.Error("error loading alert rules", "metric", metric, "error", err)
+		return
+	}
+
+	for _, rule := range rules {
+		switch rule.Type {
+		case TypeThreshold:
+			breaching, recovered := compare(rule, value)
+			apply(rule, breaching, recovered, value,
+				fmt.Sprintf("%s is %.2f (%s %.2f)", metric, value, rule.Operator, rule.Threshold))
+
+		case TypeRateOfChange:
+			delta, ok := changeWithinWindow(rule, value, at)
+			if !ok {
+				continue
+			}
+			breaching, recovered := compare(rule, delta)
+			apply(rule, breaching, recovered, value,
+				fmt.Sprintf("%s changed by %+.2f within %d minutes", metric, delta, rule.WindowMinutes))
+
+		case TypeStale:
+			apply(rule, false, true, value, "")
+		}
+	}
+}
+
+// EvaluateTimers fires or resolves STALE rules. Called periodically by the scheduler.
+func EvaluateTimers() {
+	evalMu.Lock()
+	defer evalMu.Unlock()
+
+	var rules []models.AlertRule
+	if err := database.DB.Where("type = ? AND is_active = ?", TypeStale, true).Find(&rules).Error; err != nil {
+		slog.Error("error loading stale alert rules", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		latest, err := sensors.Latest(rule.Metric, "")
+		if err != nil {
+			apply(rule, true, false, 0, fmt.Sprintf("No %s reading received yet", rule.Metric))
+			continue
+		}
+
+		age := now.Sub(latest.RecordedAt)
+		if age > time.Duration(rule.StaleMinutes)*time.Minute {
+			apply(rule, true, false, 0, fmt.Sprintf("No %s reading for %d minutes", rule.Metric, int(age.Minutes())))
+		} else {
+			apply(rule, false, true, 0, "")
+		}
+	}
+}
+
+// compare applies the rule operator with hysteresis. breaching means the
+// value is past the threshold; recovered means it is back past the
+// threshold by at least the hysteresis margin. In between, neither is true
+// and the alert keeps its current state.
+func compare(rule models.AlertRule, value float64) (breaching, recovered bool) {
+	threshold := rule.Threshold
+	if rule.Type == TypeRateOfChange && rule.Operator == OpLessThan {
+		// Falling rate: a change of -threshold or less breaches
+		threshold = -rule.Threshold
+	}
+
+	switch rule.Operator {
+	case OpGreaterThan:
+		return value > threshold, value <= threshold-rule.Hysteresis
+	case OpLessThan:
+		return value < threshold, value >= threshold+rule.Hysteresis
+	}
+	return false, false
+}
+
+// changeWithinWindow returns value minus the oldest reading inside the rule window
+func changeWithinWindow(rule models.AlertRule, value float64, at time.Time) (float64, bool) {
+	since := at.Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+
+	var oldest models.SensorReading
+	if err := database.DB.Where("metric = ? AND quality = ? AND recorded_at >= ? AND recorded_at < ?", rule.Metric, sensors.QualityGood, since, at).
+		Order("recorded_at ASC").
+		First(&oldest).Error; err != nil {
+		return 0, false
+	}
+
+	return value - oldest.Value, true
+}
+
+// apply moves the rule's open alert through its lifecycle. Repeated
+// breaches are deduplicated into the open alert.
+func apply(rule models.AlertRule, breaching, recovered bool, value float64, message string) {
+	var alert models.Alert
+	hasOpen := database.DB.Where("rule_id = ? AND status IN ?", rule.ID, openStatuses).
+		Order("fired_at DESC").
+		First(&alert).Error == nil
+
+	now := time.Now()
+
+	switch {
+	case breaching && hasOpen:
+		alert.Occurrences++
+		alert.LastSeenAt = now
+		alert.Value = value
+		alert.Message = message
+		database.DB.Save(&alert)
+
+	case breaching:
+		alert = models.Alert{
+			RuleID:      rule.ID,
+			RuleName:    rule.Name,
+			Metric:      rule.Metric,
+			Severity:    rule.Severity,
+			Status:      StatusFiring,
+			Value:       value,
+			Message:     message,
+			Occurrences: 1,
+			FiredAt:     now,
+			LastSeenAt:  now,
+		}
+		if err := database.DB.Create(&alert).Error; err != nil {
+			slog.Error("error creating alert", "rule_id", rule.ID, "error", err)
+			return
+		}
+		slog.Warn("alert firing", "rule_id", rule.ID, "rule_name", rule.Name, "severity", rule.Severity, "value", value, "message", message)
+		events.Publish(events.Event{Type: events.AlertFiring, Metric: rule.Metric, Value: value, Message: message, Subject: &alert})
+
+	case recovered && hasOpen:
+		alert.Status = StatusResolved
+		alert.ResolvedAt = &now
+		database.DB.Save(&alert)
+		slog.Info("alert resolved", "rule_id", rule.ID, "rule_name", rule.Name, "value", value)
+		events.Publish(events.Event{Type: events.AlertResolved, Metric: rule.Metric, Value: value, Message: alert.Message, Subject: &alert})
+	}
+}
+
+// Acknowledge marks a firing alert as acknowledged by username
+func Acknowledge(alert *models.Alert, username string) error {
+	if alert.Status != StatusFiring {
+		return fmt.Errorf("alert is %s, only FIRING alerts can be acknowledged", alert.Status)
+	}
+
+	now := time.Now()
+	alert.Status = StatusAcknowledged
+	alert.AcknowledgedAt = &now
+	alert.AcknowledgedBy = username
+	return database.DB.Save(alert).Error
+}
+
+// ResolveRuleAlerts resolves the open alert of a rule that was disabled or deleted
+func ResolveRuleAlerts(ruleID uint) {
+	now := time.Now()
+	database.DB.Model(&models.Alert{}).
+		Where("rule_id = ? AND status IN ?", ruleID, openStatuses).
+		Updates(map[string]interface{}{"status": StatusResolved, "resolved_at": now})
+}
@@ -0,0 +1,160 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AlertRule{}, &models.Alert{}, &models.SensorReading{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+}
+
+func createRule(t *testing.T, rule models.AlertRule) models.AlertRule {
+	t.Helper()
+	rule.Name = rule.Type + " " + rule.Metric
+	rule.IsActive = true
+	if err := ValidateRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func reading(t *testing.T, metric string, value float64, at time.Time) {
+	t.Helper()
+	r := models.SensorReading{SensorID: "test", Metric: metric, Value: value, RawValue: value, Quality: sensors.QualityGood, RecordedAt: at, ReceivedAt: at}
+	if err := database.DB.Create(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func alerts(t *testing.T, ruleID uint) []models.Alert {
+	t.Helper()
+	var list []models.Alert
+	if err := database.DB.Where("rule_id = ?", ruleID).Order("id").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestThresholdHysteresisAndDeduplication(t *testing.T) {
+	setupDB(t)
+	rule := createRule(t, models.AlertRule{Metric: sensors.Temperature, Type: TypeThreshold, Operator: OpGreaterThan, Threshold: 30, Hysteresis: 1})
+	now := time.Now()
+
+	EvaluateReading(sensors.Temperature, 31, now)
+	EvaluateReading(sensors.Temperature, 32, now)
+	list := alerts(t, rule.ID)
+	if len(list) != 1 || list[0].Status != StatusFiring || list[0].Occurrences != 2 || list[0].Value != 32 {
+		t.Fatalf("repeated breach should update one firing alert, got %+v", list)
+	}
+
+	// Back under the threshold but within the hysteresis margin: still open
+	EvaluateReading(sensors.Temperature, 29.5, now)
+	if list = alerts(t, rule.ID); list[0].Status != StatusFiring {
+		t.Fatalf("alert resolved within hysteresis: %s", list[0].Status)
+	}
+
+	EvaluateReading(sensors.Temperature, 28.9, now)
+	if list = alerts(t, rule.ID); list[0].Status != StatusResolved || list[0].ResolvedAt == nil {
+		t.Fatalf("alert not resolved past hysteresis: %+v", list[0])
+	}
+
+	EvaluateReading(sensors.Temperature, 31, now)
+	if list = alerts(t, rule.ID); len(list) != 2 || list[1].Status != StatusFiring || list[1].Occurrences != 1 {
+		t.Fatalf("new breach after resolve should open a new alert, got %+v", list)
+	}
+}
+
+func TestAcknowledgedAlertKeepsDeduplicating(t *testing.T) {
+	setupDB(t)
+	rule := createRule(t, models.AlertRule{Metric: sensors.PH, Type: TypeThreshold, Operator: OpLessThan, Threshold: 6.5})
+	now := time.Now()
+
+	EvaluateReading(sensors.PH, 6.2, now)
+	list := alerts(t, rule.ID)
+	if err := Acknowledge(&list[0], "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	EvaluateReading(sensors.PH, 6.1, now)
+	list = alerts(t, rule.ID)
+	if len(list) != 1 || list[0].Status != StatusAcknowledged || list[0].Occurrences != 2 {
+		t.Fatalf("breach should be counted on the acknowledged alert, got %+v", list)
+	}
+}
+
+func TestFallingRateOfChange(t *testing.T) {
+	setupDB(t)
+	rule := createRule(t, models.AlertRule{Metric: sensors.WaterTemperature, Type: TypeRateOfChange, Operator: OpLessThan, Threshold: 2, WindowMinutes: 10})
+	now := time.Now()
+
+	// Without an earlier reading in the window there is nothing to compare
+	EvaluateReading(sensors.WaterTemperature, 20, now)
+	if list := alerts(t, rule.ID); len(list) != 0 {
+		t.Fatalf("fired without history: %+v", list)
+	}
+
+	reading(t, sensors.WaterTemperature, 26, now.Add(-20*time.Minute)) // outside the window
+	reading(t, sensors.WaterTemperature, 27, now.Add(-5*time.Minute))
+
+	EvaluateReading(sensors.WaterTemperature, 26, now)
+	if list := alerts(t, rule.ID); len(list) != 0 {
+		t.Fatalf("fired on a drop of 1: %+v", list)
+	}
+
+	EvaluateReading(sensors.WaterTemperature, 24.5, now)
+	list := alerts(t, rule.ID)
+	if len(list) != 1 || list[0].Status != StatusFiring {
+		t.Fatalf("drop of 2.5 should fire, got %+v", list)
+	}
+
+	// A rise is a recovery for a falling rule
+	EvaluateReading(sensors.WaterTemperature, 28, now)
+	if list = alerts(t, rule.ID); list[0].Status != StatusResolved {
+		t.Fatalf("rise should resolve the falling alert, got %s", list[0].Status)
+	}
+}
+
+func TestStaleAlertResolvesOnReading(t *testing.T) {
+	setupDB(t)
+	rule := createRule(t, models.AlertRule{Metric: sensors.TDS, Type: TypeStale, StaleMinutes: 10})
+	now := time.Now()
+
+	reading(t, sensors.TDS, 300, now.Add(-30*time.Minute))
+	EvaluateTimers()
+	EvaluateTimers()
+	list := alerts(t, rule.ID)
+	if len(list) != 1 || list[0].Status != StatusFiring || list[0].Occurrences != 2 {
+		t.Fatalf("stale sensor should fire one alert, got %+v", list)
+	}
+
+	reading(t, sensors.TDS, 310, now)
+	EvaluateReading(sensors.TDS, 310, now)
+	if list = alerts(t, rule.ID); list[0].Status != StatusResolved {
+		t.Fatalf("new reading should resolve the stale alert, got %s", list[0].Status)
+	}
+
+	EvaluateTimers()
+	if list = alerts(t, rule.ID); len(list) != 1 {
+		t.Fatalf("fresh sensor fired again: %+v", list)
+	}
+}
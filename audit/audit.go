@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/middleware"
+	"iot-backend-cursor/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const contextEntry = "audit_entry"
+
+// entry holds what a handler reported about the entity it changed
+type entry struct {
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// FieldChange is one changed field in an audit diff
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Record attaches the changed entity and its before/after snapshots to the
+// request so Middleware can store them. Pass nil for before on create and
+// for after on delete. Snapshots must be copies taken before mutation.
+func Record(c *gin.Context, entityType string, entityID interface{}, before, after interface{}) {
+	c.Set(contextEntry, &entry{
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// Middleware writes an audit log entry for every mutating request after the
+// handler has run. Must be registered after middleware.RequireAuth.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method == "GET" || method == "HEAD" || method == "OPTIONS" {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		auditLog := models.AuditLog{
+			Method:     method,
+			Endpoint:   c.FullPath(),
+			Path:       c.Request.URL.Path,
+			ClientIP:   c.ClientIP(),
+			StatusCode: c.Writer.Status(),
+			AuthMethod: c.GetString(middleware.ContextAuthMethod),
+		}
+
+		if user := middleware.CurrentUser(c); user != nil {
+			userID := user.ID
+			auditLog.UserID = &userID
+			auditLog.Username = user.Username
+		}
+
+		if value, ok := c.Get(contextEntry); ok {
+			e := value.(*entry)
+			auditLog.EntityType = e.EntityType
+			auditLog.EntityID = e.EntityID
+
+			before := toMap(e.Before)
+			after := toMap(e.After)
+			auditLog.Before = marshal(before)
+			auditLog.After = marshal(after)
+			if before != nil || after != nil {
+				auditLog.Diff = marshal(Diff(before, after))
+			}
+		}
+
+		if err := database.DB.Create(&auditLog).Error; err != nil {
+			logging.FromContext(c.Request.Context()).Error("error saving audit log", "entity_type", auditLog.EntityType, "entity_id", auditLog.EntityID, "error", err)
+		}
+	}
+}
+
+// Diff returns the fields whose values differ between before and after
+func Diff(before, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for key, from := range before {
+		to, ok := after[key]
+		if !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = FieldChange{From: from, To: to}
+		}
+	}
+	for key, to := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = FieldChange{From: nil, To: to}
+		}
+	}
+	return changes
+}
+
+// toMap converts a snapshot to a generic JSON object via its JSON encoding
+func toMap(value interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return map[string]interface{}{"value": value}
+	}
+	return m
+}
+
+func marshal(value interface{}) string {
+	if v := reflect.ValueOf(value); !v.IsValid() || (v.Kind() == reflect.Map && v.IsNil()) {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a session token
+const APIKeyPrefix = "aqk_"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInvalidAPIKey      = errors.New("invalid, expired or revoked API key")
+)
+
+var (
+	jwtSecret   []byte
+	tokenExpiry time.Duration
+	dummyHash   []byte // compared against for unknown users to keep login timing uniform
+)
+
+// Claims are the JWT claims carried by session tokens
+type Claims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// InitAuth configures token signing and makes sure an admin account exists
+func InitAuth(cfg *config.Config) {
+	if cfg.JWTSecret != "" {
+		jwtSecret = []byte(cfg.JWTSecret)
+	} else {
+		jwtSecret = []byte(randomHex(32))
+		slog.Warn("JWT_SECRET not set, using a random secret (sessions will not survive restarts)")
+	}
+
+	tokenExpiry = time.Duration(cfg.JWTExpiryHours) * time.Hour
+	if tokenExpiry <= 0 {
+		tokenExpiry = 24 * time.Hour
+	}
+
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte(randomHex(16)), bcrypt.DefaultCost)
+
+	ensureDefaultRoles()
+	ensureAdminUser(cfg)
+}
+
+// ensureAdminUser creates the bootstrap admin account when the users table is empty
+func ensureAdminUser(cfg *config.Config) {
+	var count int64
+	if err := database.DB.Model(&models.User{}).Count(&count).Error; err != nil {
+		slog.Error("error counting users", "error", err)
+		return
+	}
+	if count > 0 {
+		// Accounts created before roles existed default to viewer; make sure
+		// the configured admin can still manage users
+		var owners int64
+		database.DB.Model(&models.User{}).Where("role = ?", RoleOwner).Count(&owners)
+		if owners == 0 {
+			result := database.DB.Model(&models.User{}).
+				Where("username = ?", cfg.AdminUsername).
+				Update("role", RoleOwner)
+			if result.RowsAffected > 0 {
+				slog.Info("promoted admin user", "username", cfg.AdminUsername, "role", RoleOwner)
+			}
+		}
+		return
+	}
+
+	password := cfg.AdminPassword
+	generated := password == ""
+	if generated {
+		password = randomHex(12)
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		slog.Error("error hashing admin password", "error", err)
+		return
+	}
+
+	user := models.User{Username: cfg.AdminUsername, PasswordHash: hash, Role: RoleOwner, IsActive: true}
+	if err := database.DB.Create(&user).Error; err != nil {
+		slog.Error("error creating admin user", "error", err)
+		return
+	}
+
+	if generated {
+		slog.Warn("created admin user with generated password", "username", user.Username, "password", password)
+	} else {
+		slog.Info("created admin user", "username", user.Username)
+	}
+}
+
+// HashPassword hashes a plaintext password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Authenticate verifies username and password and returns the active user
+func Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.IsActive || !CheckPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	database.DB.Model(&user).Update("last_login_at", now)
+
+	return &user, nil
+}
+
+// IssueToken creates a signed session token for user
+func IssueToken(user *models.User) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(tokenExpiry)
+
+	claims := Claims{
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseToken validates a session token and returns the active user it belongs to
+func ParseToken(tokenStr string) (*models.User, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+	return &user, nil
+}
+
+// GenerateAPIKey creates a new API key for user. The plaintext key is only
+// returned here; the database keeps its hash.
+func GenerateAPIKey(user *models.User, name string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	plaintext := APIKeyPrefix + randomHex(24)
+
+	key := models.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    plaintext[:len(APIKeyPrefix)+8],
+		KeyHash:   hashAPIKey(plaintext),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		return "", nil, err
+	}
+	return plaintext, &key, nil
+}
+
+// ParseAPIKey validates an API key and returns the active user it belongs to
+func ParseAPIKey(plaintext string) (*models.User, *models.APIKey, error) {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := database.DB.Where("key_hash = ?", hashAPIKey(plaintext)).First(&key).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key.LastUsedAt = &now
+	database.DB.Model(&key).Update("last_used_at", now)
+
+	return &user, &key, nil
+}
+
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
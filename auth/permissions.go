@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"log/slog"
+	"strings"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+)
+
+// Permissions checked by middleware.RequirePermission
+const (
+	PermScheduleWrite   = "schedule:write"   // create, update and delete feeder/UV schedules
+	PermDeviceControl   = "device:control"   // manual feed, manual UV on/off
+	PermStockWrite      = "stock:write"      // set food stock
+	PermAdminDemo       = "admin:demo"       // seed/clear demo data, inject sensor data
+	PermAdminUsers      = "admin:users"      // manage users and roles
+	PermAuditRead       = "audit:read"       // read the audit log
+	PermAlertWrite      = "alert:write"      // manage alert rules, acknowledge alerts
+	PermNotifyWrite     = "notify:write"     // manage notification channels
+	PermAutomationWrite = "automation:write" // manage and run automation rules
+	PermDataManage      = "data:manage"      // data retention, backup and restore
+	PermSensorCalibrate = "sensor:calibrate" // manage sensor calibration offsets
+	PermSystemRead      = "system:read"      // read runtime diagnostics
+)
+
+// Built-in role names
+const (
+	RoleOwner     = "owner"
+	RoleCaretaker = "caretaker"
+	RoleViewer    = "viewer"
+)
+
+// AllPermissions lists every permission known to the API
+var AllPermissions = []string{
+	PermScheduleWrite,
+	PermDeviceControl,
+	PermStockWrite,
+	PermAdminDemo,
+	PermAdminUsers,
+	PermAuditRead,
+	PermAlertWrite,
+	PermNotifyWrite,
+	PermAutomationWrite,
+	PermDataManage,
+	PermSensorCalibrate,
+	PermSystemRead,
+}
+
+// defaultRoles are created on startup when missing
+var defaultRoles = []models.Role{
+	{
+		Name:        RoleOwner,
+		Description: "Full access, including user management",
+		Permissions: strings.Join(AllPermissions, ","),
+		IsBuiltin:   true,
+	},
+	{
+		Name:        RoleCaretaker,
+		Description: "Can trigger manual feeding and UV, read everything",
+		Permissions: PermDeviceControl,
+		IsBuiltin:   true,
+	},
+	{
+		Name:        RoleViewer,
+		Description: "Read-only access",
+		Permissions: "",
+		IsBuiltin:   true,
+	},
+}
+
+// ensureDefaultRoles creates the built-in roles if they don't exist yet and
+// keeps the owner role in sync with newly added permissions
+func ensureDefaultRoles() {
+	for _, role := range defaultRoles {
+		var existing models.Role
+		if err := database.DB.Where("name = ?", role.Name).First(&existing).Error; err != nil {
+			role := role
+			if err := database.DB.Create(&role).Error; err != nil {
+				slog.Error("error creating role", "role", role.Name, "error", err)
+				continue
+			}
+			slog.Info("initialized role", "role", role.Name)
+			continue
+		}
+
+		if existing.Name == RoleOwner && existing.Permissions != role.Permissions {
+			database.DB.Model(&existing).Update("permissions", role.Permissions)
+			slog.Info("updated permissions of role", "role", existing.Name)
+		}
+	}
+}
+
+// IsValidPermission reports whether perm is a known permission
+func IsValidPermission(perm string) bool {
+	for _, p := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePermissions splits a comma-separated permission list
+func ParsePermissions(list string) []string {
+	var perms []string
+	for _, perm := range strings.Split(list, ",") {
+		if perm = strings.TrimSpace(perm); perm != "" {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// UserPermissions returns the permissions granted to user through its role
+func UserPermissions(user *models.User) []string {
+	var role models.Role
+	if err := database.DB.Where("name = ?", user.Role).First(&role).Error; err != nil {
+		return nil
+	}
+	return ParsePermissions(role.Permissions)
+}
+
+// HasPermission reports whether user's role grants perm
+func HasPermission(user *models.User, perm string) bool {
+	for _, p := range UserPermissions(user) {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,465 @@
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Format identifies backup archives; FormatVersion changes when the archive
+// layout changes (not when tables gain columns)
+const (
+	Format        = "aquarium-backup"
+	FormatVersion = 1
+	manifestFile  = "manifest.json"
+	batchSize     = 500
+)
+
+// Sections group tables so parts of the state can be left out of a backup
+const (
+	SectionSchedules = "schedules"
+	SectionStock     = "stock"
+	SectionHistory   = "history"
+	SectionSensors   = "sensors"
+	SectionConfig    = "config"
+	SectionUsers     = "users"
+	SectionLogs      = "logs"
+)
+
+// Sections lists the valid section names
+var Sections = []string{SectionSchedules, SectionStock, SectionHistory, SectionSensors, SectionConfig, SectionUsers, SectionLogs}
+
+// Table is a table included in backups
+type Table struct {
+	Model   interface{}
+	Section string
+}
+
+// Tables lists every table in a backup, in restore order
+var Tables = []Table{
+	{&models.PakanSchedule{}, SectionSchedules},
+	{&models.UVSchedule{}, SectionSchedules},
+	{&models.Stock{}, SectionStock},
+	{&models.ActionHistory{}, SectionHistory},
+	{&models.ActionEvent{}, SectionHistory},
+	{&models.DeviceStatus{}, SectionHistory},
+	{&models.SensorLog{}, SectionSensors},
+	{&models.SensorReading{}, SectionSensors},
+	{&models.SensorRollup{}, SectionSensors},
+	{&models.SensorCalibration{}, SectionConfig},
+	{&models.AlertRule{}, SectionConfig},
+	{&models.Alert{}, SectionConfig},
+	{&models.NotificationChannel{}, SectionConfig},
+	{&models.AutomationRule{}, SectionConfig},
+	{&models.Role{}, SectionUsers},
+	{&models.User{}, SectionUsers},
+	{&models.APIKey{}, SectionUsers},
+	{&models.AuditLog{}, SectionLogs},
+	{&models.NotificationDelivery{}, SectionLogs},
+}
+
+// Manifest describes a backup archive
+type Manifest struct {
+	Format        string      `json:"format"`
+	FormatVersion int         `json:"format_version"`
+	SchemaVersion int         `json:"schema_version"`
+	SourceDialect string      `json:"source_dialect"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Tables        []TableInfo `json:"tables"`
+}
+
+// TableInfo is one table file in the archive
+type TableInfo struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options selects what goes into a backup
+type Options struct {
+	Exclude []string // sections to leave out, e.g. sensors
+}
+
+func (o Options) excluded(section string) bool {
+	for _, s := range o.Exclude {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Write streams a zip archive with one NDJSON file per table and a manifest.
+// Rows are read in one transaction so the backup is a consistent snapshot.
+func Write(w io.Writer, opts Options) (*Manifest, error) {
+	schemaVersion, err := database.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		SchemaVersion: schemaVersion,
+		SourceDialect: database.DB.Dialector.Name(),
+		CreatedAt:     time.Now(),
+	}
+
+	// Read-only so SQLite takes a snapshot instead of the write lock
+	zw := zip.NewWriter(w)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range Tables {
+			if opts.excluded(table.Section) {
+				continue
+			}
+			info, err := writeTable(tx, zw, table, manifest.CreatedAt)
+			if err != nil {
+				return err
+			}
+			manifest.Tables = append(manifest.Tables, info)
+		}
+		return nil
+	}, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: manifestFile, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+func writeTable(tx *gorm.DB, zw *zip.Writer, table Table, at time.Time) (TableInfo, error) {
+	s, err := parse(table.Model)
+	if err != nil {
+		return TableInfo{}, err
+	}
+
+	info := TableInfo{Name: s.Table, File: s.Table + ".ndjson"}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: info.File, Method: zip.Deflate, Modified: at})
+	if err != nil {
+		return info, err
+	}
+
+	hash := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(fw, hash))
+
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	result := tx.Unscoped().Model(table.Model).Order("id").FindInBatches(rows.Interface(), batchSize, func(batch *gorm.DB, _ int) error {
+		slice := rows.Elem()
+		for i := 0; i < slice.Len(); i++ {
+			if err := encoder.Encode(rowMap(s, slice.Index(i))); err != nil {
+				return err
+			}
+			info.Rows++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return info, fmt.Errorf("backing up %s: %w", s.Table, result.Error)
+	}
+
+	info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+// rowMap returns the columns of a model value by column name. Unlike the
+// model's JSON encoding it includes hidden fields such as password hashes.
+func rowMap(s *schema.Schema, value reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		v := field.ReflectValueOf(context.Background(), value).Interface()
+		if deletedAt, ok := v.(gorm.DeletedAt); ok {
+			v = nil
+			if deletedAt.Valid {
+				v = deletedAt.Time
+			}
+		}
+		row[field.DBName] = v
+	}
+	return row
+}
+
+// Restore validates the archive and, unless dryRun, replaces the contents of
+// every table in it in a single transaction. Tables not in the archive are kept.
+func Restore(r io.ReaderAt, size int64, dryRun bool) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+
+	manifest, err := readManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := restoreTables(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify every file before touching the database
+	for _, info := range manifest.Tables {
+		if err := verifyFile(zr, info); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return manifest, nil
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, info := range manifest.Tables {
+			if err := restoreTable(tx, zr, info, tables[info.Name]); err != nil {
+				return fmt.Errorf("restoring %s: %w", info.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func readManifest(zr *zip.Reader) (*Manifest, error) {
+	f, err := zr.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("archive has no %s", manifestFile)
+	}
+	defer f.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestFile, err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a backup archive (format %q)", manifest.Format)
+	}
+	if manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than this build supports (%d)", manifest.FormatVersion, FormatVersion)
+	}
+
+	schemaVersion, err := database.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("backup schema version %d is newer than the database (%d); upgrade the backend first", manifest.SchemaVersion, schemaVersion)
+	}
+	return &manifest, nil
+}
+
+// restoreTables maps the table names in the manifest to their schemas
+func restoreTables(manifest *Manifest) (map[string]*schema.Schema, error) {
+	known := make(map[string]*schema.Schema, len(Tables))
+	for _, table := range Tables {
+		s, err := parse(table.Model)
+		if err != nil {
+			return nil, err
+		}
+		known[s.Table] = s
+	}
+
+	tables := make(map[string]*schema.Schema, len(manifest.Tables))
+	for _, info := range manifest.Tables {
+		s, ok := known[info.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown table %q in backup", info.Name)
+		}
+		tables[info.Name] = s
+	}
+	return tables, nil
+}
+
+// verifyFile checks a table file's checksum and that every line is a JSON object
+func verifyFile(zr *zip.Reader, info TableInfo) error {
+	f, err := zr.Open(info.File)
+	if err != nil {
+		return fmt.Errorf("archive has no %s", info.File)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	rows := 0
+	err = eachRow(io.TeeReader(f, hash), func(map[string]interface{}) error {
+		rows++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", info.File, err)
+	}
+	if rows != info.Rows {
+		return fmt.Errorf("%s has %d rows, manifest says %d", info.File, rows, info.Rows)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != info.SHA256 {
+		return fmt.Errorf("%s checksum mismatch", info.File)
+	}
+	return nil
+}
+
+func restoreTable(tx *gorm.DB, zr *zip.Reader, info TableInfo, s *schema.Schema) error {
+	if err := tx.Exec("DELETE FROM " + tx.Statement.Quote(s.Table)).Error; err != nil {
+		return err
+	}
+
+	f, err := zr.Open(info.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Rows are inserted as column maps so zero values are kept as they are
+	// instead of being replaced by column defaults
+	batch := make([]map[string]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := tx.Table(s.Table).Create(&batch).Error
+		batch = batch[:0]
+		return err
+	}
+
+	err = eachRow(f, func(raw map[string]interface{}) error {
+		row, err := columnValues(s, raw)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	return resetSequence(tx, s.Table)
+}
+
+// resetSequence moves a Postgres id sequence past the restored ids
+// (SQLite's AUTOINCREMENT follows explicit ids by itself)
+func resetSequence(tx *gorm.DB, table string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec(fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)",
+		table, table,
+	)).Error
+}
+
+// eachRow calls fn for every NDJSON line of r
+func eachRow(r io.Reader, fn func(map[string]interface{}) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	decoder.UseNumber()
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+)
+
+// columnValues converts a decoded JSON row to Go values of the model's
+// column types, so it can be written to either dialect. Columns the model
+// doesn't have (from a newer format) are an error, missing ones get their default.
+func columnValues(s *schema.Schema, raw map[string]interface{}) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(raw))
+	for column, value := range raw {
+		field, ok := s.FieldsByDBName[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		if value == nil {
+			row[column] = nil
+			continue
+		}
+
+		converted, err := convert(field.IndirectFieldType, value)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", column, err)
+		}
+		row[column] = converted
+	}
+	return row, nil
+}
+
+func convert(t reflect.Type, value interface{}) (interface{}, error) {
+	if t == timeType || t == deletedAtType {
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a timestamp, got %T", value)
+		}
+		return time.Parse(time.RFC3339Nano, text)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := value.(json.Number); ok {
+			return n.Int64()
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := value.(json.Number); ok {
+			return n.Float64()
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, t)
+}
+
+func parse(model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: database.DB}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
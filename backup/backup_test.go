@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+	if _, err := database.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	setupDB(t)
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.Local)
+	database.DB.Create(&models.PakanSchedule{DeviceType: "FEEDER", DayName: "Mon", Time: "08:00", AmountGram: 15})
+	database.DB.Model(&models.PakanSchedule{}).Where("id = 1").Update("is_active", false)
+	database.DB.Create(&models.Stock{AmountGram: 420})
+	database.DB.Create(&models.User{Username: "owner", PasswordHash: "hash", Role: "owner", IsActive: true})
+	deleted := models.ActionHistory{DeviceType: "UV", TriggerSource: "MANUAL", StartTime: start, Status: "SUCCESS", Value: 60}
+	database.DB.Create(&deleted)
+	database.DB.Delete(&deleted)
+	database.DB.Create(&models.SensorLog{Temperature: 26.5, Humidity: 70, RecordedAt: start})
+
+	var buf bytes.Buffer
+	manifest, err := Write(&buf, Options{Exclude: []string{SectionSensors}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range manifest.Tables {
+		if table.Name == "sensor_logs" {
+			t.Error("excluded section sensors was backed up")
+		}
+	}
+
+	// Restore into a fresh database
+	setupDB(t)
+	database.DB.Create(&models.Stock{AmountGram: 1})
+	database.DB.Create(&models.SensorLog{Temperature: 20, RecordedAt: start})
+
+	if _, err := Restore(bytes.NewReader(buf.Bytes()), int64(buf.Len()), false); err != nil {
+		t.Fatal(err)
+	}
+
+	var schedule models.PakanSchedule
+	database.DB.First(&schedule)
+	if schedule.IsActive || schedule.AmountGram != 15 {
+		t.Errorf("schedule = %+v, want inactive with 15g", schedule)
+	}
+
+	var stocks []models.Stock
+	database.DB.Find(&stocks)
+	if len(stocks) != 1 || stocks[0].AmountGram != 420 {
+		t.Errorf("stocks = %+v, want only the restored 420g", stocks)
+	}
+
+	var user models.User
+	database.DB.First(&user)
+	if user.PasswordHash != "hash" {
+		t.Errorf("password hash = %q, want it restored", user.PasswordHash)
+	}
+
+	var history models.ActionHistory
+	if err := database.DB.Unscoped().First(&history).Error; err != nil || !history.DeletedAt.Valid || !history.StartTime.Equal(start) {
+		t.Errorf("history = %+v, %v; want soft-deleted row with its start time", history, err)
+	}
+
+	var sensorLogs int64
+	database.DB.Model(&models.SensorLog{}).Count(&sensorLogs)
+	if sensorLogs != 1 {
+		t.Errorf("%d sensor logs, tables missing from the backup must be kept", sensorLogs)
+	}
+}
+
+func TestRestoreRejectsTamperedArchive(t *testing.T) {
+	setupDB(t)
+	database.DB.Create(&models.Stock{AmountGram: 420})
+
+	var buf bytes.Buffer
+	if _, err := Write(&buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy the archive, changing the stock
+	zr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	var tampered bytes.Buffer
+	zw := zip.NewWriter(&tampered)
+	for _, f := range zr.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		if f.Name == "stocks.ndjson" {
+			data = bytes.Replace(data, []byte("420"), []byte("999"), 1)
+		}
+		w, _ := zw.Create(f.Name)
+		w.Write(data)
+	}
+	zw.Close()
+
+	if _, err := Restore(bytes.NewReader(tampered.Bytes()), int64(tampered.Len()), true); err == nil {
+		t.Error("Restore accepted an archive with a checksum mismatch")
+	}
+}
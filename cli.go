@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"iot-backend-cursor/backup"
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+)
+
+const usage = `Usage:
+  app                       start the server
+  app migrate up            apply pending migrations
+  app migrate down [steps]  revert the latest migration(s) (default 1)
+  app migrate status        list migrations and whether they are applied
+  app backup [-exclude sensors,logs] <file>
+                            write a backup archive of the database
+  app restore [-dry-run] <file>
+                            migrate the database and replace its data with a backup`
+
+// runCommand runs a CLI subcommand and returns the process exit code
+func runCommand(cfg *config.Config, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "backup":
+		return runBackup(cfg, args[1:])
+	case "restore":
+		return runRestore(cfg, args[1:])
+	}
+
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
+
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if err := database.Connect(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 1
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		if _, err := database.CheckSchema(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		count, err := database.MigrateUp()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", count)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "steps must be a positive number")
+				return 2
+			}
+			steps = n
+		}
+		count, err := database.MigrateDown(steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Reverted %d migration(s)\n", count)
+
+	case "status":
+		statuses, err := database.MigrationStatuses()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
+
+func runBackup(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	exclude := flags.String("exclude", "", "comma-separated sections to leave out ("+strings.Join(backup.Sections, ", ")+")")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if err := database.Connect(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 1
+	}
+	defer database.Close()
+
+	f, err := os.Create(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	var opts backup.Options
+	if *exclude != "" {
+		opts.Exclude = strings.Split(*exclude, ",")
+	}
+	manifest, err := backup.Write(f, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Backup failed:", err)
+		return 1
+	}
+
+	printTables(manifest)
+	fmt.Printf("Backup written to %s (schema version %d)\n", flags.Arg(0), manifest.SchemaVersion)
+	return 0
+}
+
+func runRestore(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the archive")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if err := database.Connect(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 1
+	}
+	defer database.Close()
+
+	// A new database (e.g. Postgres replacing the demo SQLite file) needs the schema first
+	if _, err := database.CheckSchema(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := database.MigrateUp(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	manifest, err := backup.Restore(f, info.Size(), *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Restore failed:", err)
+		return 1
+	}
+
+	printTables(manifest)
+	if *dryRun {
+		fmt.Println("Backup is valid, nothing restored (dry run)")
+	} else {
+		fmt.Printf("Restored backup from %s (%s)\n", manifest.CreatedAt.Format("2006-01-02 15:04:05"), manifest.SourceDialect)
+	}
+	return 0
+}
+
+func printTables(manifest *backup.Manifest) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS")
+	for _, table := range manifest.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", table.Name, table.Rows)
+	}
+	w.Flush()
+}
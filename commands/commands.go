@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/mqtt"
+	"iot-backend-cursor/service"
+	"iot-backend-cursor/utils"
+)
+
+// Dose dispenses an amount on a dose device and records the action.
+// Feeder amounts are grams and get the default dose when zero.
+func Dose(ctx context.Context, deviceType *devices.Type, amount int, source string) (*models.ActionHistory, error) {
+	if !deviceType.HasCapability(devices.CapDose) {
+		return nil, fmt.Errorf("%s does not support dose commands", deviceType.Name)
+	}
+	if deviceType.Name == devices.Feeder {
+		amount = utils.NormalizeFeedAmount(amount)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be greater than 0")
+	}
+
+	action := models.ActionHistory{
+		DeviceType:    deviceType.Name,
+		TriggerSource: source,
+		StartTime:     time.Now(),
+		Status:        models.ActionPending,
+		Value:         amount,
+		RequestID:     logging.RequestID(ctx),
+	}
+	if err := service.StartAction(ctx, &action, ""); err != nil {
+		return nil, err
+	}
+	ctx = ActionContext(ctx, &action)
+	logging.FromContext(ctx).Info("action created", "amount", amount)
+
+	if err := mqtt.PublishCommand(ctx, deviceType, devices.Command{Amount: amount}); err != nil {
+		service.FailAction(ctx, &action, err.Error())
+		return &action, err
+	}
+
+	// A mock device may already have reported success
+	if err := service.MarkRunning(ctx, &action); err != nil {
+		return &action, err
+	}
+	return &action, nil
+}
+
+// TurnOn switches an on/off device ON and records the action. With a
+// duration the scheduler turns it off on expiry; without one it stays on.
+func TurnOn(ctx context.Context, deviceType *devices.Type, durationSec int, source string) (*models.ActionHistory, error) {
+	if !deviceType.HasCapability(devices.CapOnOff) {
+		return nil, fmt.Errorf("%s does not support on/off commands", deviceType.Name)
+	}
+	if durationSec > 0 && !deviceType.HasCapability(devices.CapDuration) {
+		return nil, fmt.Errorf("%s does not support a duration", deviceType.Name)
+	}
+	override, err := service.ActiveOverride(deviceType.Name)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil && override.Mode == service.OverrideForceOff {
+		return nil, fmt.Errorf("%w until %s", service.ErrForcedOff, override.Until.Format(time.RFC3339))
+	}
+
+	startTime := time.Now()
+	action := models.ActionHistory{
+		DeviceType:    deviceType.Name,
+		TriggerSource: source,
+		StartTime:     startTime,
+		Status:        models.ActionRunning,
+		Value:         durationSec,
+		RequestID:     logging.RequestID(ctx),
+	}
+	if durationSec > 0 {
+		endTime := startTime.Add(time.Duration(durationSec) * time.Second)
+		action.EndTime = &endTime
+	}
+	if err := service.StartAction(ctx, &action, ""); err != nil {
+		return nil, err
+	}
+	ctx = ActionContext(ctx, &action)
+	logging.FromContext(ctx).Info("action created", "duration_sec", durationSec)
+
+	if err := mqtt.PublishCommand(ctx, deviceType, devices.Command{State: "ON", DurationSec: durationSec}); err != nil {
+		service.FailAction(ctx, &action, err.Error())
+		return &action, err
+	}
+
+	if err := service.SetDeviceStatus(deviceType.Name, "ON", 0); err != nil {
+		return &action, err
+	}
+	return &action, nil
+}
+
+// TurnOff switches an on/off device OFF and ends its running actions with
+// the given status (STOPPED when stopped early, SUCCESS on expiry) and reason
+func TurnOff(ctx context.Context, deviceType *devices.Type, status models.ActionStatus, reason string) ([]models.ActionHistory, error) {
+	if !deviceType.HasCapability(devices.CapOnOff) {
+		return nil, fmt.Errorf("%s does not support on/off commands", deviceType.Name)
+	}
+
+	if err := mqtt.PublishCommand(ctx, deviceType, devices.Command{State: "OFF"}); err != nil {
+		return nil, err
+	}
+
+	running, err := service.StopDevice(ctx, deviceType.Name, status, reason)
+	if err != nil {
+		return nil, err
+	}
+	for i := range running {
+		logging.FromContext(ActionContext(ctx, &running[i])).Info("action finished", "status", status)
+	}
+	return running, nil
+}
+
+// ActionContext adds the action's ID and device to the logger in ctx, so the
+// HTTP request, MQTT publish and device report logs can be correlated
+func ActionContext(ctx context.Context, action *models.ActionHistory) context.Context {
+	return logging.With(ctx, "action_id", action.ID, "device_type", action.DeviceType, "trigger_source", action.TriggerSource)
+}
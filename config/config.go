@@ -1,7 +1,10 @@
 package config
 
 import (
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -20,6 +23,61 @@ type Config struct {
 	MQTTPass     string
 	MQTTClientID string
 	DemoMode     bool // Enable demo mode (no real MQTT connection)
+
+	// Database schema
+	DBAutoMigrate bool // Apply pending migrations on startup (otherwise refuse to start)
+
+	// Database connection
+	DBDSN                    string // Full DSN, overrides the DB_HOST/DB_NAME settings
+	DBSSLMode                string // Postgres sslmode (disable, require, verify-full, ...)
+	DBMaxOpenConns           int    // Max open connections (0 = unlimited)
+	DBMaxIdleConns           int    // Max idle connections kept in the pool
+	DBConnMaxLifetimeMinutes int    // Recycle connections after this long (0 = never)
+	DBConnMaxIdleMinutes     int    // Close idle connections after this long (0 = never)
+	DBBusyRetries            int    // Retries of a SQLite write that failed with "database is locked"
+	DBBusyRetryMillis        int    // Wait before the first busy retry, doubled on each retry
+	SQLiteJournalMode        string // SQLite journal_mode pragma (WAL, DELETE, ...)
+	SQLiteSynchronous        string // SQLite synchronous pragma (NORMAL, FULL, ...)
+	SQLiteBusyTimeoutMillis  int    // SQLite busy_timeout pragma
+
+	// Authentication
+	JWTSecret          string   // HMAC secret used to sign session tokens
+	JWTExpiryHours     int      // Session token lifetime in hours
+	AdminUsername      string   // Bootstrap admin account (created when no users exist)
+	AdminPassword      string   // Bootstrap admin password (random if empty)
+	CORSAllowedOrigins []string // Allowed CORS origins, "*" allows all
+
+	// Notifications
+	NotifyMaxAttempts      int // Delivery attempts per notification
+	NotifyRetryBaseSeconds int // Wait before the first retry, doubled on each retry
+	StockLowThresholdGram  int // Send stock.low when stock drops below this amount
+
+	// Devices
+	DeviceTypesFile string // Optional YAML file registering extra device types
+
+	// Sensor timestamps reported by devices
+	SensorClockToleranceSeconds int // Max allowed device clock lead over server time
+	SensorMaxBackfillHours      int // Oldest buffered reading accepted with its device time
+
+	// Logging
+	LogLevel   string // debug, info, warn, error
+	LogFormat  string // json or text
+	DBLogLevel string // SQL log level: silent, error, warn, info
+
+	// Observability
+	MetricsToken        string // Bearer token required by /metrics (empty: no auth)
+	DeviceOnlineMinutes int    // A device counts as online if it reported within this window
+
+	// Shutdown
+	ShutdownTimeoutSeconds int  // Max time to drain requests, jobs and queues on SIGTERM
+	ShutdownUVOff          bool // Turn the UV off before exiting
+
+	// Data retention in days (0 keeps data forever)
+	RetentionRawDays            int // Raw sensor data (sensor_logs, sensor_readings)
+	RetentionRollupDays         int // Hourly sensor rollups
+	RetentionHistoryDays        int // Action history
+	RetentionDeletedHistoryDays int // Soft-deleted action history
+	RetentionBatchSize          int // Rows deleted per statement
 }
 
 func LoadConfig() *Config {
@@ -47,6 +105,51 @@ func LoadConfig() *Config {
 		MQTTPass:     getEnv("MQTT_PASS", ""),
 		MQTTClientID: getEnv("MQTT_CLIENT_ID", "aquarium-backend"),
 		DemoMode:     demoMode,
+
+		DBAutoMigrate: getEnv("DB_AUTO_MIGRATE", "true") == "true",
+
+		DBDSN:                    getEnv("DB_DSN", ""),
+		DBSSLMode:                getEnv("DB_SSLMODE", "disable"),
+		DBMaxOpenConns:           getEnvInt("DB_MAX_OPEN_CONNS", 10),
+		DBMaxIdleConns:           getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetimeMinutes: getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30),
+		DBConnMaxIdleMinutes:     getEnvInt("DB_CONN_MAX_IDLE_MINUTES", 5),
+		DBBusyRetries:            getEnvInt("DB_BUSY_RETRIES", 3),
+		DBBusyRetryMillis:        getEnvInt("DB_BUSY_RETRY_MS", 100),
+		SQLiteJournalMode:        getEnv("SQLITE_JOURNAL_MODE", "WAL"),
+		SQLiteSynchronous:        getEnv("SQLITE_SYNCHRONOUS", "NORMAL"),
+		SQLiteBusyTimeoutMillis:  getEnvInt("SQLITE_BUSY_TIMEOUT_MS", 5000),
+
+		JWTSecret:          getEnv("JWT_SECRET", ""),
+		JWTExpiryHours:     getEnvInt("JWT_EXPIRY_HOURS", 24),
+		AdminUsername:      getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:      getEnv("ADMIN_PASSWORD", ""),
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:5173"),
+
+		NotifyMaxAttempts:      getEnvInt("NOTIFY_MAX_ATTEMPTS", 3),
+		NotifyRetryBaseSeconds: getEnvInt("NOTIFY_RETRY_BASE_SECONDS", 2),
+		StockLowThresholdGram:  getEnvInt("STOCK_LOW_THRESHOLD_GRAM", 100),
+
+		DeviceTypesFile: getEnv("DEVICE_TYPES_FILE", ""),
+
+		SensorClockToleranceSeconds: getEnvInt("SENSOR_CLOCK_TOLERANCE_SECONDS", 300),
+		SensorMaxBackfillHours:      getEnvInt("SENSOR_MAX_BACKFILL_HOURS", 24),
+
+		LogLevel:   getEnv("LOG_LEVEL", "info"),
+		LogFormat:  getEnv("LOG_FORMAT", "json"),
+		DBLogLevel: getEnv("DB_LOG_LEVEL", "warn"),
+
+		MetricsToken:        getEnv("METRICS_TOKEN", ""),
+		DeviceOnlineMinutes: getEnvInt("DEVICE_ONLINE_MINUTES", 10),
+
+		ShutdownTimeoutSeconds: getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 20),
+		ShutdownUVOff:          getEnv("SHUTDOWN_UV_OFF", "false") == "true",
+
+		RetentionRawDays:            getEnvInt("RETENTION_RAW_DAYS", 30),
+		RetentionRollupDays:         getEnvInt("RETENTION_ROLLUP_DAYS", 730),
+		RetentionHistoryDays:        getEnvInt("RETENTION_HISTORY_DAYS", 365),
+		RetentionDeletedHistoryDays: getEnvInt("RETENTION_DELETED_HISTORY_DAYS", 30),
+		RetentionBatchSize:          getEnvInt("RETENTION_BATCH_SIZE", 1000),
 	}
 
 	return config
@@ -60,11 +163,43 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList parses a comma-separated environment variable into a list,
+// skipping empty entries.
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GetDSN returns DB_DSN if set, otherwise builds the DSN from the DB_* settings.
+// SQLite pragmas are passed as _pragma parameters so every pooled connection
+// gets them; write transactions take the lock up front (_txlock=immediate)
+// so they wait on busy_timeout instead of failing halfway through.
 func (c *Config) GetDSN() string {
+	if c.DBDSN != "" {
+		return c.DBDSN
+	}
 	if c.DBType == "sqlite" {
-		return c.DBName + ".db"
+		params := url.Values{}
+		params.Add("_pragma", "busy_timeout("+strconv.Itoa(c.SQLiteBusyTimeoutMillis)+")")
+		params.Add("_pragma", "journal_mode("+c.SQLiteJournalMode+")")
+		params.Add("_pragma", "synchronous("+c.SQLiteSynchronous+")")
+		params.Set("_txlock", "immediate")
+		return c.DBName + ".db?" + params.Encode()
 	}
-	return "host=" + c.DBHost + " user=" + c.DBUser + " password=" + c.DBPassword + " dbname=" + c.DBName + " port=" + c.DBPort + " sslmode=disable"
+	return "host=" + c.DBHost + " user=" + c.DBUser + " password=" + c.DBPassword + " dbname=" + c.DBName + " port=" + c.DBPort + " sslmode=" + c.DBSSLMode
 }
 
 func (c *Config) GetMQTTBrokerURL() string {
@@ -1,86 +1,109 @@
 package database
 
 import (
-	"log"
+	"log/slog"
+	"os"
+	"time"
 
 	"iot-backend-cursor/config"
+	"iot-backend-cursor/logging"
 	"iot-backend-cursor/models"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+// InitDB connects to the database, checks the schema version and applies
+// pending migrations (unless DB_AUTO_MIGRATE=false)
 func InitDB(cfg *config.Config) {
-	var err error
-	var dialector gorm.Dialector
-
-	if cfg.DBType == "sqlite" {
-		dialector = sqlite.Open(cfg.GetDSN())
-	} else {
-		dialector = postgres.Open(cfg.GetDSN())
-	}
-
-	// Set logger based on DB type (less verbose for remote DB)
-	logLevel := logger.Info
-	if cfg.DBType == "postgres" {
-		logLevel = logger.Warn // Only log warnings/errors for remote DB
+	if err := Connect(cfg); err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
 	}
 
-	DB, err = gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
-	})
+	slog.Info("database connected", "type", cfg.DBType)
 
+	pending, err := CheckSchema()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		slog.Error("refusing to start", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Database connected successfully")
-
-	// Auto migrate
-	err = DB.AutoMigrate(
-		&models.PakanSchedule{},
-		&models.UVSchedule{},
-		&models.ActionHistory{},
-		&models.Stock{},
-		&models.DeviceStatus{},
-		&models.SensorLog{},
-	)
-
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	if pending > 0 {
+		if !cfg.DBAutoMigrate {
+			slog.Error("database has pending migrations; run \"migrate up\" first", "pending", pending)
+			os.Exit(1)
+		}
+		if _, err := MigrateUp(); err != nil {
+			slog.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	log.Println("Database migrated successfully")
-
-	// Create indexes for better query performance
-	CreateIndexes()
+	slog.Info("database schema is up to date")
 
 	// Initialize stock if not exists
 	var stock models.Stock
 	if err := DB.First(&stock).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			DB.Create(&models.Stock{AmountGram: 0})
-			log.Println("Initialized stock with 0 grams")
+			slog.Info("initialized stock", "amount_gram", 0)
 		}
 	}
 
-	// Initialize device statuses
-	devices := []string{"FEEDER", "UV"}
-	for _, deviceType := range devices {
-		var status models.DeviceStatus
-		if err := DB.Where("device_type = ?", deviceType).First(&status).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				DB.Create(&models.DeviceStatus{
-					DeviceType:  deviceType,
-					Status:      "IDLE",
-					Remaining:   0,
-					LastUpdated: models.DeviceStatus{}.LastUpdated,
-				})
-			}
+	// Device statuses are initialized by devices.InitDevices for every registered type
+}
+
+// Connect opens the database without touching the schema
+func Connect(cfg *config.Config) error {
+	var dialector gorm.Dialector
+
+	if cfg.DBType == "sqlite" {
+		dialector = sqlite.Open(cfg.GetDSN())
+	} else {
+		dialector = postgres.Open(cfg.GetDSN())
+	}
+
+	// SQL logging goes through slog (DB_LOG_LEVEL, default: slow queries and errors)
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logging.GormLogger(cfg.DBLogLevel),
+	})
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeMinutes) * time.Minute)
+	sqlDB.SetConnMaxIdleTime(time.Duration(cfg.DBConnMaxIdleMinutes) * time.Minute)
+
+	// SQLite allows one writer at a time; retry writes that still hit a lock
+	// after busy_timeout (e.g. the UV countdown racing the scheduler)
+	if cfg.DBType == "sqlite" && cfg.DBBusyRetries > 0 {
+		db.ConnPool = &retryPool{
+			DB:      sqlDB,
+			retries: cfg.DBBusyRetries,
+			wait:    time.Duration(cfg.DBBusyRetryMillis) * time.Millisecond,
 		}
+		db.Statement.ConnPool = db.ConnPool
+	}
+
+	DB = db
+	return nil
+}
+
+// Close closes the database connection pool
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
 	}
+	return sqlDB.Close()
 }
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var allModels = []interface{}{
+	&models.PakanSchedule{}, &models.UVSchedule{}, &models.ActionHistory{}, &models.Stock{},
+	&models.DeviceStatus{}, &models.SensorLog{}, &models.SensorReading{}, &models.SensorRollup{},
+	&models.SensorCalibration{}, &models.User{}, &models.APIKey{}, &models.Role{}, &models.AuditLog{},
+	&models.AlertRule{}, &models.Alert{}, &models.NotificationChannel{}, &models.NotificationDelivery{},
+	&models.AutomationRule{}, &models.ActionEvent{},
+}
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+}
+
+// TestMigrationsMatchModels fails when a model field has no column after
+// migrating, i.e. a model changed without a migration
+func TestMigrationsMatchModels(t *testing.T) {
+	setupDB(t)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !DB.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s.%s has no migration", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	setupDB(t)
+	applied, err := MigrateUp()
+	if err != nil || applied == 0 {
+		t.Fatalf("MigrateUp() = %d, %v", applied, err)
+	}
+
+	if again, err := MigrateUp(); err != nil || again != 0 {
+		t.Fatalf("second MigrateUp() = %d, %v, want 0", again, err)
+	}
+
+	reverted, err := MigrateDown(applied)
+	if err != nil || reverted != applied {
+		t.Fatalf("MigrateDown() = %d, %v, want %d", reverted, err, applied)
+	}
+	if DB.Migrator().HasTable("action_histories") {
+		t.Error("action_histories still exists after reverting all migrations")
+	}
+
+	if pending, err := CheckSchema(); err != nil || pending != applied {
+		t.Errorf("CheckSchema() = %d, %v, want %d pending", pending, err, applied)
+	}
+}
+
+// Models as they were before versioned migrations, when InitDB ran
+// AutoMigrate and CreateIndexes
+type baselinePakanSchedule struct {
+	ID         uint   `gorm:"primaryKey"`
+	DayName    string `gorm:"not null"`
+	Time       string `gorm:"not null"`
+	AmountGram int    `gorm:"default:10"`
+	IsActive   bool   `gorm:"default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type baselineUVSchedule struct {
+	ID        uint   `gorm:"primaryKey"`
+	DayName   string `gorm:"not null"`
+	StartTime string `gorm:"not null"`
+	EndTime   string `gorm:"not null"`
+	IsActive  bool   `gorm:"default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type baselineActionHistory struct {
+	ID            uint      `gorm:"primaryKey"`
+	DeviceType    string    `gorm:"not null"`
+	TriggerSource string    `gorm:"not null"`
+	StartTime     time.Time `gorm:"not null"`
+	EndTime       *time.Time
+	Status        string `gorm:"not null;default:PENDING"`
+	Value         int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+type baselineSensorLog struct {
+	ID          uint    `gorm:"primaryKey"`
+	Temperature float64 `gorm:"not null"`
+	Humidity    float64
+	RecordedAt  time.Time `gorm:"index;not null"`
+}
+
+func (baselinePakanSchedule) TableName() string { return "pakan_schedules" }
+func (baselineUVSchedule) TableName() string    { return "uv_schedules" }
+func (baselineActionHistory) TableName() string { return "action_histories" }
+func (baselineSensorLog) TableName() string     { return "sensor_logs" }
+
+func TestMigrateUpgradesBaselineDatabase(t *testing.T) {
+	setupDB(t)
+	if err := DB.AutoMigrate(&baselinePakanSchedule{}, &baselineUVSchedule{}, &baselineActionHistory{},
+		&models.Stock{}, &models.DeviceStatus{}, &baselineSensorLog{}); err != nil {
+		t.Fatal(err)
+	}
+	// DeviceStatus gained columns since; drop them to get the baseline table
+	for _, column := range []string{"override_mode", "override_until"} {
+		if err := DB.Migrator().DropColumn(&models.DeviceStatus{}, column); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_action_histories_lookup ON action_histories(device_type, trigger_source, status, start_time DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_action_histories_time ON action_histories(created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_sensor_logs_time ON sensor_logs(recorded_at DESC)",
+	} {
+		if err := DB.Exec(index).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	DB.Create(&models.Stock{AmountGram: 250})
+	DB.Create(&baselinePakanSchedule{DayName: "Mon", Time: "08:00", AmountGram: 15, IsActive: true})
+	DB.Create(&baselineUVSchedule{DayName: "Mon", StartTime: "18:00", EndTime: "19:00", IsActive: true})
+	DB.Create(&baselineActionHistory{DeviceType: "UV", TriggerSource: "SCHEDULE", StartTime: time.Now(), Status: "SUCCESS"})
+
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := CheckSchema(); err != nil || pending != 0 {
+		t.Fatalf("CheckSchema() = %d, %v after upgrade", pending, err)
+	}
+
+	var stock models.Stock
+	if err := DB.First(&stock).Error; err != nil || stock.AmountGram != 250 {
+		t.Errorf("stock = %+v, %v; existing data must be kept", stock, err)
+	}
+	var feed models.PakanSchedule
+	if err := DB.First(&feed).Error; err != nil || feed.DeviceType != "FEEDER" || feed.AmountGram != 15 {
+		t.Errorf("feeder schedule = %+v, %v; want device type FEEDER", feed, err)
+	}
+	var uv models.UVSchedule
+	if err := DB.First(&uv).Error; err != nil || uv.DeviceType != "UV" {
+		t.Errorf("uv schedule = %+v, %v; want device type UV", uv, err)
+	}
+	var events int64
+	DB.Model(&models.ActionEvent{}).Count(&events)
+	if events != 2 {
+		t.Errorf("%d backfilled action events, want 2", events)
+	}
+}
+
+func TestCheckSchemaRejectsNewerSchema(t *testing.T) {
+	setupDB(t)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	DB.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)")
+
+	if _, err := CheckSchema(); err == nil {
+		t.Error("CheckSchema() accepted a newer schema")
+	}
+}
+
+func TestMigrationsHaveBothDialects(t *testing.T) {
+	sqliteMigrations, err := Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgresMigrations, err := Migrations("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqliteMigrations) != len(postgresMigrations) {
+		t.Fatalf("%d sqlite and %d postgres migrations", len(sqliteMigrations), len(postgresMigrations))
+	}
+	for i := range sqliteMigrations {
+		s, p := sqliteMigrations[i], postgresMigrations[i]
+		if s.Version != p.Version || s.Name != p.Name || s.Down == "" || p.Down == "" {
+			t.Errorf("migration %04d_%s differs between dialects or has no down file", s.Version, s.Name)
+		}
+	}
+}
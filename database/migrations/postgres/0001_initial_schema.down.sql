@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS sensor_logs;
+DROP TABLE IF EXISTS device_statuses;
+DROP TABLE IF EXISTS stocks;
+DROP TABLE IF EXISTS action_histories;
+DROP TABLE IF EXISTS uv_schedules;
+DROP TABLE IF EXISTS pakan_schedules;
@@ -0,0 +1,62 @@
+-- Initial schema, matching what AutoMigrate and CreateIndexes created before
+-- versioned migrations. IF NOT EXISTS lets those databases adopt it unchanged.
+
+CREATE TABLE IF NOT EXISTS pakan_schedules (
+    id bigserial PRIMARY KEY,
+    day_name text NOT NULL,
+    "time" text NOT NULL,
+    amount_gram bigint DEFAULT 10,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS uv_schedules (
+    id bigserial PRIMARY KEY,
+    day_name text NOT NULL,
+    start_time text NOT NULL,
+    end_time text NOT NULL,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS action_histories (
+    id bigserial PRIMARY KEY,
+    device_type text NOT NULL,
+    trigger_source text NOT NULL,
+    start_time timestamptz NOT NULL,
+    end_time timestamptz,
+    status text NOT NULL DEFAULT 'PENDING',
+    value bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_action_histories_deleted_at ON action_histories(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_action_histories_lookup ON action_histories(device_type, trigger_source, status, start_time DESC);
+CREATE INDEX IF NOT EXISTS idx_action_histories_time ON action_histories(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS stocks (
+    id bigserial PRIMARY KEY,
+    amount_gram bigint DEFAULT 0,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS device_statuses (
+    id bigserial PRIMARY KEY,
+    device_type text NOT NULL,
+    status text,
+    remaining bigint,
+    last_updated timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_statuses_device_type ON device_statuses(device_type);
+
+CREATE TABLE IF NOT EXISTS sensor_logs (
+    id bigserial PRIMARY KEY,
+    temperature decimal NOT NULL,
+    humidity decimal,
+    recorded_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sensor_logs_recorded_at ON sensor_logs(recorded_at);
+CREATE INDEX IF NOT EXISTS idx_sensor_logs_time ON sensor_logs(recorded_at DESC);
@@ -0,0 +1,11 @@
+-- Roles with per-route permissions
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    description text,
+    permissions text,
+    is_builtin boolean DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles(name);
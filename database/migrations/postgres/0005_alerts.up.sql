@@ -0,0 +1,35 @@
+-- Alert rules and fired alerts
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    metric text NOT NULL,
+    type text NOT NULL,
+    operator text,
+    threshold decimal,
+    hysteresis decimal,
+    window_minutes bigint,
+    stale_minutes bigint,
+    severity text DEFAULT 'WARNING',
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id bigserial PRIMARY KEY,
+    rule_id bigint NOT NULL,
+    rule_name text,
+    metric text,
+    severity text,
+    status text NOT NULL,
+    value decimal,
+    message text,
+    occurrences bigint DEFAULT 1,
+    fired_at timestamptz,
+    last_seen_at timestamptz,
+    acknowledged_at timestamptz,
+    acknowledged_by text,
+    resolved_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_alerts_status ON alerts(status);
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_id ON alerts(rule_id);
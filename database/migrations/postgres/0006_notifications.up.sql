@@ -0,0 +1,29 @@
+-- Notification channels and their delivery log
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    type text NOT NULL,
+    config text,
+    event_types text,
+    rate_limit_seconds bigint,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id bigserial PRIMARY KEY,
+    channel_id bigint NOT NULL,
+    channel_name text,
+    event_type text,
+    title text,
+    message text,
+    status text NOT NULL,
+    attempts bigint,
+    last_error text,
+    sent_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created_at ON notification_deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_event_type ON notification_deliveries(event_type);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel_id ON notification_deliveries(channel_id);
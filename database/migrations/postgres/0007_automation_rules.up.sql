@@ -0,0 +1,15 @@
+-- Automation rules
+CREATE TABLE IF NOT EXISTS automation_rules (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    trigger_type text NOT NULL,
+    "trigger" text,
+    conditions text,
+    actions text NOT NULL,
+    cooldown_seconds bigint,
+    is_active boolean DEFAULT true,
+    last_fired_at timestamptz,
+    last_result text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
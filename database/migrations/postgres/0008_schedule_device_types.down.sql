@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_uv_schedules_device_type;
+ALTER TABLE uv_schedules DROP COLUMN device_type;
+DROP INDEX IF EXISTS idx_pakan_schedules_device_type;
+ALTER TABLE pakan_schedules DROP COLUMN device_type;
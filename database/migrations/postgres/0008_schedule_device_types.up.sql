@@ -0,0 +1,5 @@
+-- Schedules belong to a registered device type; existing rows keep their device
+ALTER TABLE pakan_schedules ADD COLUMN device_type text NOT NULL DEFAULT 'FEEDER';
+CREATE INDEX IF NOT EXISTS idx_pakan_schedules_device_type ON pakan_schedules(device_type);
+ALTER TABLE uv_schedules ADD COLUMN device_type text NOT NULL DEFAULT 'UV';
+CREATE INDEX IF NOT EXISTS idx_uv_schedules_device_type ON uv_schedules(device_type);
@@ -0,0 +1,14 @@
+-- Generic sensor readings (pH, TDS, water temperature, water level)
+CREATE TABLE IF NOT EXISTS sensor_readings (
+    id bigserial PRIMARY KEY,
+    sensor_id text NOT NULL,
+    metric text NOT NULL,
+    unit text,
+    value decimal,
+    raw_value decimal,
+    quality text NOT NULL DEFAULT 'GOOD',
+    recorded_at timestamptz NOT NULL,
+    received_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_metric_time ON sensor_readings(metric, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_sensor_id ON sensor_readings(sensor_id);
@@ -0,0 +1,13 @@
+-- Hourly and daily sensor rollups
+CREATE TABLE IF NOT EXISTS sensor_rollups (
+    id bigserial PRIMARY KEY,
+    metric text NOT NULL,
+    bucket text NOT NULL,
+    bucket_start timestamptz NOT NULL,
+    min decimal,
+    max decimal,
+    avg decimal,
+    count bigint,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sensor_rollups_bucket ON sensor_rollups(metric, bucket, bucket_start);
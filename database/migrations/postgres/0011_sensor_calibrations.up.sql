@@ -0,0 +1,11 @@
+-- Per-sensor calibration offsets and scales
+CREATE TABLE IF NOT EXISTS sensor_calibrations (
+    id bigserial PRIMARY KEY,
+    sensor_id text NOT NULL,
+    metric text NOT NULL,
+    "offset" decimal,
+    scale decimal DEFAULT 1,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sensor_calibrations_sensor_metric ON sensor_calibrations(sensor_id, metric);
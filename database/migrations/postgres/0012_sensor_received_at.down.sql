@@ -0,0 +1 @@
+ALTER TABLE sensor_logs DROP COLUMN received_at;
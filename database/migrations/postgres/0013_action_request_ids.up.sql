@@ -0,0 +1,2 @@
+-- Request or job that created an action, for log correlation
+ALTER TABLE action_histories ADD COLUMN request_id text;
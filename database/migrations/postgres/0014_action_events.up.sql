@@ -0,0 +1,21 @@
+-- Status transitions of actions (see models.ActionStatus)
+CREATE TABLE IF NOT EXISTS action_events (
+    id bigserial PRIMARY KEY,
+    action_id bigint NOT NULL,
+    from_status text,
+    to_status text NOT NULL,
+    reason text,
+    request_id text,
+    at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_action_events_action_id ON action_events(action_id);
+
+-- Backfill a timeline for existing actions: creation at start_time and,
+-- for ended actions, the final status at end_time
+INSERT INTO action_events (action_id, from_status, to_status, reason, request_id, at)
+SELECT id, '', CASE WHEN status = 'PENDING' THEN 'PENDING' ELSE 'RUNNING' END, 'backfilled', request_id, start_time
+FROM action_histories;
+INSERT INTO action_events (action_id, from_status, to_status, reason, request_id, at)
+SELECT id, 'RUNNING', status, 'backfilled', '', COALESCE(end_time, updated_at, start_time)
+FROM action_histories
+WHERE status NOT IN ('PENDING', 'RUNNING');
@@ -0,0 +1,2 @@
+ALTER TABLE device_statuses DROP COLUMN override_until;
+ALTER TABLE device_statuses DROP COLUMN override_mode;
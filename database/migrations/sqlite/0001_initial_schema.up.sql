@@ -0,0 +1,62 @@
+-- Initial schema, matching what AutoMigrate and CreateIndexes created before
+-- versioned migrations. IF NOT EXISTS lets those databases adopt it unchanged.
+
+CREATE TABLE IF NOT EXISTS pakan_schedules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    day_name text NOT NULL,
+    "time" text NOT NULL,
+    amount_gram integer DEFAULT 10,
+    is_active numeric DEFAULT true,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS uv_schedules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    day_name text NOT NULL,
+    start_time text NOT NULL,
+    end_time text NOT NULL,
+    is_active numeric DEFAULT true,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS action_histories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    device_type text NOT NULL,
+    trigger_source text NOT NULL,
+    start_time datetime NOT NULL,
+    end_time datetime,
+    status text NOT NULL DEFAULT 'PENDING',
+    value integer,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_action_histories_deleted_at ON action_histories(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_action_histories_lookup ON action_histories(device_type, trigger_source, status, start_time DESC);
+CREATE INDEX IF NOT EXISTS idx_action_histories_time ON action_histories(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS stocks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    amount_gram integer DEFAULT 0,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS device_statuses (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    device_type text NOT NULL,
+    status text,
+    remaining integer,
+    last_updated datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_statuses_device_type ON device_statuses(device_type);
+
+CREATE TABLE IF NOT EXISTS sensor_logs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    temperature real NOT NULL,
+    humidity real,
+    recorded_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sensor_logs_recorded_at ON sensor_logs(recorded_at);
+CREATE INDEX IF NOT EXISTS idx_sensor_logs_time ON sensor_logs(recorded_at DESC);
@@ -0,0 +1,11 @@
+-- Roles with per-route permissions
+CREATE TABLE IF NOT EXISTS roles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    description text,
+    permissions text,
+    is_builtin numeric DEFAULT false,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles(name);
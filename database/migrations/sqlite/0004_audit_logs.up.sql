@@ -0,0 +1,21 @@
+-- Audit log of mutating API requests
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    username text,
+    auth_method text,
+    method text NOT NULL,
+    endpoint text NOT NULL,
+    path text,
+    entity_type text,
+    entity_id text,
+    "before" text,
+    "after" text,
+    diff text,
+    client_ip text,
+    status_code integer,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_entity_type ON audit_logs(entity_type);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
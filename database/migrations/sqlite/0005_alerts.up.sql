@@ -0,0 +1,35 @@
+-- Alert rules and fired alerts
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    metric text NOT NULL,
+    type text NOT NULL,
+    operator text,
+    threshold real,
+    hysteresis real,
+    window_minutes integer,
+    stale_minutes integer,
+    severity text DEFAULT 'WARNING',
+    is_active numeric DEFAULT true,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    rule_id integer NOT NULL,
+    rule_name text,
+    metric text,
+    severity text,
+    status text NOT NULL,
+    value real,
+    message text,
+    occurrences integer DEFAULT 1,
+    fired_at datetime,
+    last_seen_at datetime,
+    acknowledged_at datetime,
+    acknowledged_by text,
+    resolved_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_alerts_status ON alerts(status);
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_id ON alerts(rule_id);
@@ -0,0 +1,29 @@
+-- Notification channels and their delivery log
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    type text NOT NULL,
+    config text,
+    event_types text,
+    rate_limit_seconds integer,
+    is_active numeric DEFAULT true,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    channel_id integer NOT NULL,
+    channel_name text,
+    event_type text,
+    title text,
+    message text,
+    status text NOT NULL,
+    attempts integer,
+    last_error text,
+    sent_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created_at ON notification_deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_event_type ON notification_deliveries(event_type);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel_id ON notification_deliveries(channel_id);
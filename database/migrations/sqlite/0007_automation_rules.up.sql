@@ -0,0 +1,15 @@
+-- Automation rules
+CREATE TABLE IF NOT EXISTS automation_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    trigger_type text NOT NULL,
+    "trigger" text,
+    conditions text,
+    actions text NOT NULL,
+    cooldown_seconds integer,
+    is_active numeric DEFAULT true,
+    last_fired_at datetime,
+    last_result text,
+    created_at datetime,
+    updated_at datetime
+);
@@ -0,0 +1,14 @@
+-- Generic sensor readings (pH, TDS, water temperature, water level)
+CREATE TABLE IF NOT EXISTS sensor_readings (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    sensor_id text NOT NULL,
+    metric text NOT NULL,
+    unit text,
+    value real,
+    raw_value real,
+    quality text NOT NULL DEFAULT 'GOOD',
+    recorded_at datetime NOT NULL,
+    received_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_metric_time ON sensor_readings(metric, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_sensor_readings_sensor_id ON sensor_readings(sensor_id);
@@ -0,0 +1,13 @@
+-- Hourly and daily sensor rollups
+CREATE TABLE IF NOT EXISTS sensor_rollups (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    metric text NOT NULL,
+    bucket text NOT NULL,
+    bucket_start datetime NOT NULL,
+    min real,
+    max real,
+    avg real,
+    count integer,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sensor_rollups_bucket ON sensor_rollups(metric, bucket, bucket_start);
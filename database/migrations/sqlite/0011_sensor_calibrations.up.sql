@@ -0,0 +1,11 @@
+-- Per-sensor calibration offsets and scales
+CREATE TABLE IF NOT EXISTS sensor_calibrations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    sensor_id text NOT NULL,
+    metric text NOT NULL,
+    "offset" real,
+    scale real DEFAULT 1,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sensor_calibrations_sensor_metric ON sensor_calibrations(sensor_id, metric);
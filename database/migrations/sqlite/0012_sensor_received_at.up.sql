@@ -0,0 +1,2 @@
+-- Server arrival time of legacy readings; recorded_at is the device timestamp
+ALTER TABLE sensor_logs ADD COLUMN received_at datetime;
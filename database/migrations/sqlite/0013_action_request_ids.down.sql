@@ -0,0 +1 @@
+ALTER TABLE action_histories DROP COLUMN request_id;
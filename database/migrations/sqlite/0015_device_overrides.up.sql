@@ -0,0 +1,3 @@
+-- Schedule override of on/off devices (manual run, pause, force off)
+ALTER TABLE device_statuses ADD COLUMN override_mode text;
+ALTER TABLE device_statuses ADD COLUMN override_until datetime;
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"iot-backend-cursor/logging"
+)
+
+// SQLite result codes for a locked database (extended codes keep these in the low byte)
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// IsBusy reports whether err is SQLite's "database is locked"
+func IsBusy(err error) bool {
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return false
+	}
+	code := coded.Code() & 0xff
+	return code == sqliteBusy || code == sqliteLocked
+}
+
+// retryPool wraps the connection pool and retries statements and BEGINs that
+// fail because another connection holds the write lock. Only statements run
+// outside a transaction and the BEGIN itself are retried: both fail before
+// anything was written, so running them again is safe. Statements inside a
+// transaction never see busy because transactions begin immediate.
+type retryPool struct {
+	*sql.DB
+	retries int
+	wait    time.Duration
+}
+
+// retry runs fn until it succeeds, fails with a non-busy error or runs out of retries
+func (p *retryPool) retry(ctx context.Context, fn func() error) error {
+	wait := p.wait
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsBusy(err) || attempt >= p.retries {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("database busy, retrying", "attempt", attempt+1, "wait", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+func (p *retryPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := p.retry(ctx, func() (err error) {
+		result, err = p.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryContext is retried too: GORM inserts with RETURNING through it
+func (p *retryPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := p.retry(ctx, func() (err error) {
+		rows, err = p.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (p *retryPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := p.retry(ctx, func() (err error) {
+		tx, err = p.DB.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+// GetDBConn lets gorm.DB.DB() return the wrapped pool
+func (p *retryPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
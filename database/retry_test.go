@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/config"
+)
+
+// lockDatabase holds the SQLite write lock on a separate connection until release is called
+func lockDatabase(t *testing.T, path string) (release func()) {
+	t.Helper()
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := other.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "COMMIT")
+		conn.Close()
+		other.Close()
+	}
+}
+
+func connectSQLite(t *testing.T, retries int) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test")
+	cfg := &config.Config{
+		DBType:                  "sqlite",
+		DBName:                  name,
+		DBLogLevel:              "silent",
+		DBMaxOpenConns:          4,
+		DBBusyRetries:           retries,
+		DBBusyRetryMillis:       50,
+		SQLiteJournalMode:       "WAL",
+		SQLiteSynchronous:       "NORMAL",
+		SQLiteBusyTimeoutMillis: 10,
+	}
+	if err := Connect(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+
+	if err := DB.Exec("CREATE TABLE counters (n integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	return name + ".db"
+}
+
+func TestWriteRetriesWhileLocked(t *testing.T) {
+	release := lockDatabase(t, connectSQLite(t, 5))
+	time.AfterFunc(100*time.Millisecond, release)
+
+	if err := DB.Exec("INSERT INTO counters (n) VALUES (1)").Error; err != nil {
+		t.Fatalf("write was not retried: %v", err)
+	}
+
+	var mode string
+	DB.Raw("PRAGMA journal_mode").Scan(&mode)
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+}
+
+func TestWriteFailsBusyWithoutRetries(t *testing.T) {
+	release := lockDatabase(t, connectSQLite(t, 0))
+	defer release()
+
+	err := DB.Exec("INSERT INTO counters (n) VALUES (1)").Error
+	if !IsBusy(err) {
+		t.Fatalf("expected busy error, got %v", err)
+	}
+}
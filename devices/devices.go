@@ -0,0 +1,357 @@
+package devices
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Built-in device type names
+const (
+	Feeder  = "FEEDER"
+	UV      = "UV"
+	Heater  = "HEATER"
+	AirPump = "AIR_PUMP"
+	LED     = "LED"
+)
+
+// Capabilities a device type can declare
+const (
+	CapOnOff    = "on_off"   // can be turned ON and OFF
+	CapDuration = "duration" // ON accepts a duration and is turned off on expiry
+	CapDose     = "dose"     // dispenses an amount per command
+	CapStock    = "stock"    // successful doses are taken from the food stock
+)
+
+// Logical command and status fields, mapped to payload keys by the schemas
+const (
+	FieldAction    = "action"
+	FieldState     = "state"
+	FieldDuration  = "duration"
+	FieldAmount    = "amount"
+	FieldRemaining = "remaining"
+)
+
+// Type describes an actuator: what it can do and how to talk to it over MQTT
+type Type struct {
+	Name          string            `json:"name" yaml:"name"`
+	Label         string            `json:"label" yaml:"label"`
+	Capabilities  []string          `json:"capabilities" yaml:"capabilities"`
+	CommandTopic  string            `json:"command_topic" yaml:"command_topic"`
+	StatusTopic   string            `json:"status_topic,omitempty" yaml:"status_topic"`
+	ReportType    string            `json:"report_type,omitempty" yaml:"report_type"`     // "type" value in aquarium/device/report
+	DoseAction    string            `json:"dose_action,omitempty" yaml:"dose_action"`     // constant "action" value for dose commands
+	CommandSchema map[string]string `json:"command_schema" yaml:"command_schema"`         // logical field -> payload key
+	StatusSchema  map[string]string `json:"status_schema,omitempty" yaml:"status_schema"` // logical field -> payload key
+	BuiltIn       bool              `json:"built_in" yaml:"-"`
+}
+
+// Command is a device-independent command
+type Command struct {
+	State       string // ON, OFF (on/off devices)
+	DurationSec int    // 0 means until turned off
+	Amount      int    // amount to dispense (dose devices)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]*Type)
+)
+
+// builtinTypes are registered before the config file is loaded; the file may override them
+var builtinTypes = []Type{
+	{
+		Name:          Feeder,
+		Label:         "Fish feeder",
+		Capabilities:  []string{CapDose, CapStock},
+		CommandTopic:  "aquarium/feeder/command",
+		StatusTopic:   "aquarium/feeder/status",
+		ReportType:    "FEED",
+		DoseAction:    "FEED",
+		CommandSchema: map[string]string{FieldAction: "action", FieldAmount: "dose"},
+		StatusSchema:  map[string]string{FieldState: "status"},
+	},
+	{
+		Name:          UV,
+		Label:         "UV sterilizer",
+		Capabilities:  []string{CapOnOff, CapDuration},
+		CommandTopic:  "aquarium/uv/command",
+		StatusTopic:   "aquarium/uv/status",
+		ReportType:    "UV",
+		CommandSchema: map[string]string{FieldState: "state", FieldDuration: "duration_sec"},
+		StatusSchema:  map[string]string{FieldState: "state", FieldRemaining: "remaining"},
+	},
+	{
+		Name:          Heater,
+		Label:         "Heater",
+		Capabilities:  []string{CapOnOff, CapDuration},
+		CommandTopic:  "aquarium/heater/command",
+		StatusTopic:   "aquarium/heater/status",
+		CommandSchema: map[string]string{FieldState: "state", FieldDuration: "duration_sec"},
+		StatusSchema:  map[string]string{FieldState: "state"},
+	},
+	{
+		Name:          AirPump,
+		Label:         "Air pump",
+		Capabilities:  []string{CapOnOff, CapDuration},
+		CommandTopic:  "aquarium/airpump/command",
+		StatusTopic:   "aquarium/airpump/status",
+		CommandSchema: map[string]string{FieldState: "state", FieldDuration: "duration_sec"},
+		StatusSchema:  map[string]string{FieldState: "state"},
+	},
+	{
+		Name:          LED,
+		Label:         "LED light",
+		Capabilities:  []string{CapOnOff, CapDuration},
+		CommandTopic:  "aquarium/led/command",
+		StatusTopic:   "aquarium/led/status",
+		CommandSchema: map[string]string{FieldState: "state", FieldDuration: "duration_sec"},
+		StatusSchema:  map[string]string{FieldState: "state"},
+	},
+}
+
+// fileConfig is the layout of DEVICE_TYPES_FILE
+type fileConfig struct {
+	DeviceTypes []Type `yaml:"device_types"`
+}
+
+// InitDevices registers the built-in device types, loads extra types from
+// DEVICE_TYPES_FILE and makes sure every type has a status row
+func InitDevices(cfg *config.Config) {
+	for _, t := range builtinTypes {
+		t.BuiltIn = true
+		if err := Register(t); err != nil {
+			slog.Error("invalid built-in device type", "device_type", t.Name, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.DeviceTypesFile != "" {
+		if err := LoadFile(cfg.DeviceTypesFile); err != nil {
+			slog.Error("failed to load device types", "file", cfg.DeviceTypesFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, t := range All() {
+		ensureStatus(t)
+	}
+	slog.Info("registered device types", "count", len(All()))
+}
+
+// LoadFile registers the device types listed in a YAML file
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return err
+	}
+
+	for _, t := range fc.DeviceTypes {
+		if err := Register(t); err != nil {
+			return fmt.Errorf("device type %q: %w", t.Name, err)
+		}
+		slog.Info("registered device type", "device_type", strings.ToUpper(t.Name), "file", path)
+	}
+	return nil
+}
+
+// Register validates a device type and adds it to the registry, replacing any type with the same name
+func Register(t Type) error {
+	t.Name = strings.ToUpper(strings.TrimSpace(t.Name))
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.Label == "" {
+		t.Label = t.Name
+	}
+	if t.CommandTopic == "" {
+		return fmt.Errorf("command_topic is required")
+	}
+	for _, c := range t.Capabilities {
+		if !isCapability(c) {
+			return fmt.Errorf("unknown capability: %s", c)
+		}
+	}
+	if t.HasCapability(CapOnOff) == t.HasCapability(CapDose) {
+		return fmt.Errorf("device must have exactly one of %s or %s", CapOnOff, CapDose)
+	}
+	if t.CommandSchema == nil {
+		t.CommandSchema = map[string]string{}
+	}
+	if t.StatusSchema == nil {
+		t.StatusSchema = map[string]string{}
+	}
+
+	mu.Lock()
+	registry[t.Name] = &t
+	mu.Unlock()
+	return nil
+}
+
+// Get returns a registered device type by name (case-insensitive)
+func Get(name string) (*Type, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := registry[strings.ToUpper(name)]
+	return t, ok
+}
+
+// All returns the registered device types sorted by name
+func All() []*Type {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	types := make([]*Type, 0, len(registry))
+	for _, t := range registry {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// WithCapability returns the registered device types that declare a capability
+func WithCapability(capability string) []*Type {
+	var types []*Type
+	for _, t := range All() {
+		if t.HasCapability(capability) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// ByStatusTopic returns the device type publishing status on a topic
+func ByStatusTopic(topic string) (*Type, bool) {
+	for _, t := range All() {
+		if t.StatusTopic != "" && t.StatusTopic == topic {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ByReportType returns the device type for a "type" in aquarium/device/report,
+// falling back to the device name itself
+func ByReportType(reportType string) (*Type, bool) {
+	for _, t := range All() {
+		if strings.EqualFold(t.ReportType, reportType) {
+			return t, true
+		}
+	}
+	return Get(reportType)
+}
+
+// HasCapability reports whether the device type declares a capability
+func (t *Type) HasCapability(capability string) bool {
+	for _, c := range t.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// IdleStatus is the status of the device when nothing is running
+func (t *Type) IdleStatus() string {
+	if t.HasCapability(CapDose) {
+		return "IDLE"
+	}
+	return "OFF"
+}
+
+// CommandPayload builds the MQTT payload for a command using the command schema
+func (t *Type) CommandPayload(cmd Command) map[string]interface{} {
+	payload := make(map[string]interface{})
+	if t.HasCapability(CapDose) {
+		if t.DoseAction != "" {
+			payload[t.commandKey(FieldAction)] = t.DoseAction
+		}
+		payload[t.commandKey(FieldAmount)] = cmd.Amount
+		return payload
+	}
+
+	payload[t.commandKey(FieldState)] = cmd.State
+	if t.HasCapability(CapDuration) {
+		payload[t.commandKey(FieldDuration)] = cmd.DurationSec
+	}
+	return payload
+}
+
+// ParseStatus reads the state and remaining seconds from a status payload using the status schema
+func (t *Type) ParseStatus(payload []byte) (state string, remaining int, err error) {
+	var data map[string]interface{}
+	if err = json.Unmarshal(payload, &data); err != nil {
+		return "", 0, err
+	}
+
+	state, _ = data[t.statusKey(FieldState)].(string)
+	if state == "" {
+		return "", 0, fmt.Errorf("missing %q in status payload", t.statusKey(FieldState))
+	}
+	if r, ok := data[t.statusKey(FieldRemaining)].(float64); ok {
+		remaining = int(r)
+	}
+	return strings.ToUpper(state), remaining, nil
+}
+
+func (t *Type) commandKey(field string) string {
+	if key := t.CommandSchema[field]; key != "" {
+		return key
+	}
+	return defaultKey(field)
+}
+
+func (t *Type) statusKey(field string) string {
+	if key := t.StatusSchema[field]; key != "" {
+		return key
+	}
+	return defaultKey(field)
+}
+
+func defaultKey(field string) string {
+	if field == FieldDuration {
+		return "duration_sec"
+	}
+	return field
+}
+
+func isCapability(c string) bool {
+	switch c {
+	case CapOnOff, CapDuration, CapDose, CapStock:
+		return true
+	}
+	return false
+}
+
+// ensureStatus creates the DeviceStatus row for a device type if missing
+func ensureStatus(t *Type) {
+	var status models.DeviceStatus
+	if err := database.DB.Where("device_type = ?", t.Name).First(&status).Error; err == nil {
+		return
+	}
+
+	status = models.DeviceStatus{
+		DeviceType:  t.Name,
+		Status:      t.IdleStatus(),
+		LastUpdated: time.Now(),
+	}
+	if err := database.DB.Create(&status).Error; err != nil {
+		slog.Error("error creating device status", "device_type", t.Name, "error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/models"
+)
+
+// Type identifies what happened
+type Type string
+
+const (
+	SensorReading  Type = "sensor.reading"  // a sensor value was stored
+	AlertFiring    Type = "alert.firing"    // an alert started firing
+	AlertResolved  Type = "alert.resolved"  // a firing alert was resolved
+	ActionFailed   Type = "action.failed"   // a feeder/UV action ended as FAILED
+	ActionFinished Type = "action.finished" // a feeder/UV action reached any final status
+	StockChanged   Type = "stock.changed"   // food stock changed, Value is the new amount
+)
+
+// Event is passed to subscribers. Only the fields relevant to Type are set.
+type Event struct {
+	Type     Type
+	At       time.Time
+	Metric   string      // sensor metric name, e.g. temperature
+	Value    float64     // sensor value or alert value
+	Message  string      // human readable summary
+	Subject  interface{} // related record, e.g. *models.Alert, *models.ActionHistory
+	Previous float64     // previous value, for StockChanged
+}
+
+// Handler receives published events
+type Handler func(Event)
+
+var (
+	mu          sync.RWMutex
+	subscribers = make(map[Type][]Handler)
+)
+
+// Subscribe registers handler for events of type t
+func Subscribe(t Type, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	subscribers[t] = append(subscribers[t], handler)
+}
+
+// Publish delivers e synchronously to every subscriber of e.Type.
+// A panicking subscriber is logged and does not affect the others.
+func Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	mu.RLock()
+	handlers := subscribers[e.Type]
+	mu.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("event handler panicked", "event_type", e.Type, "panic", r)
+				}
+			}()
+			handler(e)
+		}()
+	}
+}
+
+// PublishReading publishes a SensorReading event for one metric value
+func PublishReading(metric string, value float64, at time.Time) {
+	Publish(Event{Type: SensorReading, At: at, Metric: metric, Value: value})
+}
+
+// PublishActionFailed publishes ActionFailed and ActionFinished events for action
+func PublishActionFailed(action *models.ActionHistory, reason string) {
+	Publish(Event{
+		Type:    ActionFailed,
+		Message: fmt.Sprintf("%s action #%d (%s) failed: %s", action.DeviceType, action.ID, action.TriggerSource, reason),
+		Subject: action,
+	})
+	PublishActionFinished(action)
+}
+
+// PublishActionFinished publishes an ActionFinished event for action
+func PublishActionFinished(action *models.ActionHistory) {
+	Publish(Event{
+		Type:    ActionFinished,
+		Message: fmt.Sprintf("%s action #%d (%s) finished: %s", action.DeviceType, action.ID, action.TriggerSource, action.Status),
+		Subject: action,
+	})
+}
+
+// PublishStockChanged publishes a StockChanged event when the amount changed
+func PublishStockChanged(previous, current int) {
+	if previous == current {
+		return
+	}
+	Publish(Event{Type: StockChanged, Value: float64(current), Previous: float64(previous)})
+}
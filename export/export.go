@@ -0,0 +1,139 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported export formats
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+	XLSX   = "xlsx"
+)
+
+// TimeLayout is how times are written to CSV and XLSX cells
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Writer writes rows one at a time so exports never hold the whole result in memory
+type Writer interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+// New returns a Writer for format that writes columns as the header row
+func New(format string, w io.Writer, columns []string) (Writer, error) {
+	switch ParseFormat(format) {
+	case CSV:
+		return newCSVWriter(w, columns)
+	case NDJSON:
+		return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case XLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unsupported format %q (use csv, ndjson or xlsx)", format)
+}
+
+// ParseFormat normalizes a format name; "jsonl" is accepted for NDJSON
+func ParseFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jsonl" {
+		return NDJSON
+	}
+	return format
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch ParseFormat(format) {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// formatValue renders a value as cell text
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case time.Time:
+		return t.Format(TimeLayout)
+	case *time.Time:
+		if t == nil {
+			return ""
+		}
+		return t.Format(TimeLayout)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprint(v)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatValue(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+// Write encodes a row as one JSON object, keeping the column order
+func (nw *ndjsonWriter) Write(values []interface{}) error {
+	nw.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			nw.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(nw.columns[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		nw.w.Write(key)
+		nw.w.WriteByte(':')
+		nw.w.Write(value)
+	}
+	nw.w.WriteString("}\n")
+	return nil
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.w.Flush()
+}
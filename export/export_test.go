@@ -0,0 +1,75 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testColumns = []string{"id", "status", "value", "at"}
+	testAt      = time.Date(2026, 3, 4, 15, 37, 12, 0, time.Local)
+)
+
+func write(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := New(format, &buf, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]interface{}{uint(1), `a "quoted" <tag>`, 2.5, testAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	want := "id,status,value,at\n1,\"a \"\"quoted\"\" <tag>\",2.5,2026-03-04 15:37:12\n"
+	if got := string(write(t, "csv")); got != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+}
+
+func TestNDJSONKeepsColumnOrder(t *testing.T) {
+	got := string(write(t, "jsonl"))
+	if !strings.HasPrefix(got, `{"id":1,"status":"a \"quoted\" \u003ctag\u003e","value":2.5,"at":"2026-03-04T15:37:12`) {
+		t.Errorf("ndjson = %q", got)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := write(t, "xlsx")
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			body, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(body)
+		}
+	}
+
+	for _, want := range []string{"<c><v>1</v></c>", "<c><v>2.5</v></c>", "&#34;quoted&#34; &lt;tag&gt;", "2026-03-04 15:37:12", "</sheetData></worksheet>"} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet missing %q", want)
+		}
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	if _, err := New("pdf", io.Discard, testColumns); err == nil {
+		t.Error("expected an error for pdf")
+	}
+}
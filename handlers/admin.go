@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/auth"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/middleware"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUsers returns all users with pagination
+func GetUsers(c *gin.Context) {
+	var users []models.User
+	var total int64
+
+	// Get pagination params (default: page 1, page_size 20, max 100)
+	pagination := utils.GetPaginationParams(c, 20, 100)
+
+	if err := database.DB.Model(&models.User{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Order("username").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	paginationMeta := utils.BuildPaginationResponse(pagination.Page, pagination.PageSize, total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       users,
+		"pagination": paginationMeta,
+	})
+}
+
+// CreateUserRequest represents the request body for creating a user
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// CreateUser creates a new user with the given role
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+		return
+	}
+	if len(req.Password) < 8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at least 8 characters"})
+		return
+	}
+	if !roleExists(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown role: %s", req.Role)})
+		return
+	}
+
+	var existing models.User
+	if err := database.DB.Where("username = ?", req.Username).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{
+		Username:     req.Username,
+		PasswordHash: hash,
+		Role:         req.Role,
+		IsActive:     true,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "user", user.ID, nil, user)
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUserRequest represents the request body for updating a user.
+// Omitted fields are left unchanged.
+type UpdateUserRequest struct {
+	Role     *string `json:"role"`
+	IsActive *bool   `json:"is_active"`
+	Password *string `json:"password"`
+}
+
+// UpdateUser changes a user's role, active flag or password
+func UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	before := user
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Prevent admins from locking themselves out
+	isSelf := middleware.CurrentUser(c).ID == user.ID
+	if isSelf && req.Role != nil && *req.Role != user.Role {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change your own role"})
+		return
+	}
+	if isSelf && req.IsActive != nil && !*req.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot deactivate your own account"})
+		return
+	}
+
+	if req.Role != nil {
+		if !roleExists(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown role: %s", *req.Role)})
+			return
+		}
+		user.Role = *req.Role
+	}
+
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
+	}
+
+	if req.Password != nil {
+		if len(*req.Password) < 8 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at least 8 characters"})
+			return
+		}
+		hash, err := auth.HashPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user.PasswordHash = hash
+	}
+
+	if err := database.DB.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "user", user.ID, before, user)
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser deletes a user and its API keys
+func DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if middleware.CurrentUser(c).ID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	if err := database.DB.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Delete(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "user", user.ID, user, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// GetRoles returns all roles and the permissions that can be assigned
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        roles,
+		"permissions": auth.AllPermissions,
+	})
+}
+
+// RoleRequest represents the request body for creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreateRole creates a custom role
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if roleExists(req.Name) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: strings.Join(req.Permissions, ","),
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "role", role.Name, nil, role)
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole replaces the description and permissions of a role
+func UpdateRole(c *gin.Context) {
+	name := c.Param("name")
+	var role models.Role
+
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	// The owner role always has every permission and is reset on startup
+	if role.Name == auth.RoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner role cannot be changed"})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The caller must keep the ability to manage users through its own role
+	if role.Name == middleware.CurrentUser(c).Role && !containsString(req.Permissions, auth.PermAdminUsers) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove admin:users from your own role"})
+		return
+	}
+
+	before := role
+	role.Description = req.Description
+	role.Permissions = strings.Join(req.Permissions, ",")
+	if err := database.DB.Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "role", role.Name, before, role)
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role that is not assigned to any user
+func DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	var role models.Role
+
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if role.IsBuiltin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Role is assigned to %d user(s)", count)})
+		return
+	}
+
+	if err := database.DB.Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "role", role.Name, role, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+func roleExists(name string) bool {
+	var count int64
+	database.DB.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+func validatePermissions(perms []string) error {
+	for _, perm := range perms {
+		if !auth.IsValidPermission(perm) {
+			return fmt.Errorf("unknown permission: %s", perm)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
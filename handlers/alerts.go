@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"iot-backend-cursor/alerting"
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/middleware"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAlerts returns alerts with optional status filter and pagination
+func GetAlerts(c *gin.Context) {
+	var alerts []models.Alert
+	var total int64
+
+	// Get pagination params (default: page 1, page_size 50, max 200)
+	pagination := utils.GetPaginationParams(c, 50, 200)
+
+	query := database.DB.Model(&models.Alert{})
+
+	// Filter by status, "open" means FIRING or ACKNOWLEDGED
+	if status := c.Query("status"); status != "" {
+		if strings.EqualFold(status, "open") {
+			query = query.Where("status IN ?", []string{alerting.StatusFiring, alerting.StatusAcknowledged})
+		} else {
+			query = query.Where("status = ?", status)
+		}
+	}
+
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := query.Order("fired_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	paginationMeta := utils.BuildPaginationResponse(pagination.Page, pagination.PageSize, total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       alerts,
+		"pagination": paginationMeta,
+	})
+}
+
+// AcknowledgeAlert marks a firing alert as acknowledged
+func AcknowledgeAlert(c *gin.Context) {
+	id := c.Param("id")
+	var alert models.Alert
+
+	if err := database.DB.First(&alert, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	before := alert
+
+	if err := alerting.Acknowledge(&alert, middleware.CurrentUser(c).Username); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "alert", alert.ID, before, alert)
+	c.JSON(http.StatusOK, alert)
+}
+
+// GetAlertRules returns all alert rules
+func GetAlertRules(c *gin.Context) {
+	var rules []models.AlertRule
+	if err := database.DB.Order("metric, name").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// CreateAlertRule creates a new alert rule
+func CreateAlertRule(c *gin.Context) {
+	rule := models.AlertRule{IsActive: true}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := alerting.ValidateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "alert_rule", rule.ID, nil, rule)
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateAlertRule updates an alert rule
+func UpdateAlertRule(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AlertRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	before := rule
+
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = before.ID
+
+	if err := alerting.ValidateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A disabled rule shouldn't leave alerts open forever
+	if !rule.IsActive {
+		alerting.ResolveRuleAlerts(rule.ID)
+	}
+
+	audit.Record(c, "alert_rule", rule.ID, before, rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteAlertRule deletes an alert rule and resolves its open alert
+func DeleteAlertRule(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AlertRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	alerting.ResolveRuleAlerts(rule.ID)
+
+	audit.Record(c, "alert_rule", rule.ID, rule, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted"})
+}
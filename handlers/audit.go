@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLogResponse exposes the stored JSON snapshots as JSON instead of strings
+type auditLogResponse struct {
+	models.AuditLog
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+	Diff   json.RawMessage `json:"diff"`
+}
+
+// GetAuditLogs returns audit log entries with optional filters and pagination
+func GetAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	var total int64
+
+	// Get pagination params (default: page 1, page_size 50, max 200)
+	pagination := utils.GetPaginationParams(c, 50, 200)
+
+	query := database.DB.Model(&models.AuditLog{})
+
+	// Filter by actor
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	// Filter by entity
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+
+	// Filter by request
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method = ?", method)
+	}
+	if endpoint := c.Query("endpoint"); endpoint != "" {
+		query = query.Where("endpoint = ?", endpoint)
+	}
+	if statusCode := c.Query("status_code"); statusCode != "" {
+		query = query.Where("status_code = ?", statusCode)
+	}
+
+	// Filter by time range
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query = timeRange.Apply(query, "created_at")
+
+	// Count total records
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get paginated results
+	if err := query.Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := make([]auditLogResponse, len(logs))
+	for i, entry := range logs {
+		data[i] = auditLogResponse{
+			AuditLog: entry,
+			Before:   rawJSON(entry.Before),
+			After:    rawJSON(entry.After),
+			Diff:     rawJSON(entry.Diff),
+		}
+	}
+
+	// Build response with pagination metadata
+	paginationMeta := utils.BuildPaginationResponse(pagination.Page, pagination.PageSize, total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       data,
+		"pagination": paginationMeta,
+	})
+}
+
+// rawJSON returns a stored JSON string as raw JSON, or null when empty
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(value)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/auth"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/middleware"
+	"iot-backend-cursor/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginRequest represents the request body for password login
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login verifies credentials and issues a session token
+func Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
+		return
+	}
+
+	user, err := auth.Authenticate(req.Username, req.Password)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, expiresAt, err := auth.IssueToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expiresAt.Format(time.RFC3339),
+		"user":       user,
+	})
+}
+
+// GetMe returns the authenticated user and its permissions
+func GetMe(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	permissions := auth.UserPermissions(user)
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":        user,
+		"permissions": permissions,
+		"auth_method": c.GetString(middleware.ContextAuthMethod),
+	})
+}
+
+// ChangePasswordRequest represents the request body for changing the own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword updates the authenticated user's password
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.NewPassword) < 8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new_password must be at least 8 characters"})
+		return
+	}
+
+	user := middleware.CurrentUser(c)
+	if !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current_password is incorrect"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(user).Update("password_hash", hash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "user", user.ID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// GetAPIKeys returns the API keys owned by the authenticated user
+func GetAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ?", middleware.CurrentUser(c).ID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name" binding:"required"`
+	ExpiresInDays int    `json:"expires_in_days"` // 0 means the key never expires
+}
+
+// CreateAPIKey creates an API key for the authenticated user.
+// The plaintext key is only returned in this response.
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days cannot be negative"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	plaintext, key, err := auth.GenerateAPIKey(middleware.CurrentUser(c), req.Name, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "api_key", key.ID, nil, key)
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     plaintext,
+		"api_key": key,
+	})
+}
+
+// RevokeAPIKey revokes one of the authenticated user's API keys
+func RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	var key models.APIKey
+
+	if err := database.DB.Where("user_id = ?", middleware.CurrentUser(c).ID).First(&key, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	before := key
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := database.DB.Save(&key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	audit.Record(c, "api_key", key.ID, before, key)
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
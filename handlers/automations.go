@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/rules"
+
+	"github.com/gin-gonic/gin"
+)
+
+// automationRequest accepts trigger, conditions and actions as JSON objects
+// rather than strings; they are stored as JSON text on the rule
+type automationRequest struct {
+	Name            string          `json:"name" binding:"required"`
+	TriggerType     string          `json:"trigger_type" binding:"required"`
+	Trigger         json.RawMessage `json:"trigger"`
+	Conditions      json.RawMessage `json:"conditions"`
+	Actions         json.RawMessage `json:"actions" binding:"required"`
+	CooldownSeconds *int            `json:"cooldown_seconds"`
+	IsActive        *bool           `json:"is_active"`
+}
+
+// applyAutomationRequest copies the request onto the rule and validates it
+func applyAutomationRequest(req automationRequest, rule *models.AutomationRule) error {
+	rule.Name = req.Name
+	rule.TriggerType = req.TriggerType
+	rule.Trigger = string(req.Trigger)
+	rule.Conditions = string(req.Conditions)
+	rule.Actions = string(req.Actions)
+	if req.CooldownSeconds != nil {
+		rule.CooldownSeconds = *req.CooldownSeconds
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+
+	_, err := rules.Parse(*rule)
+	return err
+}
+
+// GetAutomations returns all automation rules
+func GetAutomations(c *gin.Context) {
+	var automations []models.AutomationRule
+	if err := database.DB.Order("name").Find(&automations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": automations})
+}
+
+// GetAutomation returns a single automation rule
+func GetAutomation(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AutomationRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Automation rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateAutomation creates a new automation rule
+func CreateAutomation(c *gin.Context) {
+	var req automationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.AutomationRule{CooldownSeconds: 300, IsActive: true}
+	if err := applyAutomationRequest(req, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "automation_rule", rule.ID, nil, rule)
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateAutomation updates an automation rule
+func UpdateAutomation(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AutomationRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Automation rule not found"})
+		return
+	}
+	before := rule
+
+	var req automationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := applyAutomationRequest(req, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "automation_rule", rule.ID, before, rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteAutomation deletes an automation rule
+func DeleteAutomation(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AutomationRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Automation rule not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "automation_rule", rule.ID, rule, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Automation rule deleted"})
+}
+
+// RunAutomation executes a rule's actions now, skipping trigger, conditions and cooldown
+func RunAutomation(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.AutomationRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Automation rule not found"})
+		return
+	}
+
+	result, err := rules.Run(c.Request.Context(), rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "automation_rule", rule.ID, nil, gin.H{"run": result})
+	c.JSON(http.StatusOK, gin.H{"message": "Automation rule executed", "result": result})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/backup"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/sensors"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBackup streams a zip archive of the system state. Sections can be left
+// out with ?exclude=sensors,logs.
+func GetBackup(c *gin.Context) {
+	exclude := utils.QueryList(c, "exclude")
+	for _, section := range exclude {
+		if !containsString(backup.Sections, section) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown section %q, use one of: %s", section, strings.Join(backup.Sections, ", "))})
+			return
+		}
+	}
+
+	filename := "aquarium-backup-" + time.Now().Format("20060102-150405") + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// Headers are sent once the archive starts, so errors can only be logged
+	logger := logging.FromContext(c.Request.Context())
+	manifest, err := backup.Write(c.Writer, backup.Options{Exclude: exclude})
+	if err != nil {
+		logger.Error("backup failed", "error", err)
+		return
+	}
+	logger.Info("backup created", "tables", len(manifest.Tables), "schema_version", manifest.SchemaVersion)
+}
+
+// RestoreBackup replaces the data in a backup archive, sent as the request
+// body or as the "file" field of a multipart form. ?dry_run=true only validates it.
+func RestoreBackup(c *gin.Context) {
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// The archive is read with random access, so spool it to disk first
+	tmp, err := os.CreateTemp("", "aquarium-restore-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read backup: " + err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	manifest, err := backup.Restore(tmp, size, dryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		sensors.ReloadCalibrations()
+		audit.Record(c, "backup", "", nil, gin.H{"created_at": manifest.CreatedAt, "tables": manifest.Tables})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":  dryRun,
+		"manifest": manifest,
+	})
+}
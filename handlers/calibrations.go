@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSensorCalibrations returns the calibration of every sensor that has one
+func GetSensorCalibrations(c *gin.Context) {
+	var calibrations []models.SensorCalibration
+	if err := database.DB.Order("metric, sensor_id").Find(&calibrations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": calibrations})
+}
+
+// UpsertSensorCalibration sets the offset and scale for a sensor/metric pair
+func UpsertSensorCalibration(c *gin.Context) {
+	var req models.SensorCalibration
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := sensors.ValidateCalibration(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var calibration models.SensorCalibration
+	err := database.DB.Where("sensor_id = ? AND metric = ?", req.SensorID, req.Metric).First(&calibration).Error
+	if err != nil {
+		calibration = req
+		if err := database.DB.Create(&calibration).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sensors.ReloadCalibrations()
+
+		audit.Record(c, "sensor_calibration", calibration.ID, nil, calibration)
+		c.JSON(http.StatusCreated, calibration)
+		return
+	}
+
+	before := calibration
+	calibration.Offset = req.Offset
+	calibration.Scale = req.Scale
+	if err := database.DB.Save(&calibration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sensors.ReloadCalibrations()
+
+	audit.Record(c, "sensor_calibration", calibration.ID, before, calibration)
+	c.JSON(http.StatusOK, calibration)
+}
+
+// DeleteSensorCalibration removes a calibration so the sensor's raw values are used again
+func DeleteSensorCalibration(c *gin.Context) {
+	id := c.Param("id")
+	var calibration models.SensorCalibration
+
+	if err := database.DB.First(&calibration, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sensor calibration not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&calibration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sensors.ReloadCalibrations()
+
+	audit.Record(c, "sensor_calibration", calibration.ID, calibration, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Sensor calibration deleted"})
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"net/http"
 
+	"iot-backend-cursor/alerting"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
 	"iot-backend-cursor/models"
 
 	"github.com/gin-gonic/gin"
@@ -17,15 +19,15 @@ func GetDashboard(c *gin.Context) {
 
 	// Get UV status
 	var uvStatus models.DeviceStatus
-	database.DB.Where("device_type = ?", "UV").First(&uvStatus)
+	database.DB.Where("device_type = ?", devices.UV).First(&uvStatus)
 
 	// Get feeder status
 	var feederStatus models.DeviceStatus
-	database.DB.Where("device_type = ?", "FEEDER").First(&feederStatus)
+	database.DB.Where("device_type = ?", devices.Feeder).First(&feederStatus)
 
 	// Check for running manual UV
 	var manualUV models.ActionHistory
-	hasManualUV := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "MANUAL", "RUNNING").
+	hasManualUV := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", devices.UV, "MANUAL", models.ActionRunning).
 		Order("start_time DESC").
 		First(&manualUV).Error == nil
 
@@ -40,6 +42,16 @@ func GetDashboard(c *gin.Context) {
 		}
 	}
 
+	// Get open alerts (firing or acknowledged)
+	var openAlerts []models.Alert
+	database.DB.Where("status IN ?", []string{alerting.StatusFiring, alerting.StatusAcknowledged}).
+		Order("fired_at DESC").
+		Limit(5).
+		Find(&openAlerts)
+
+	var firingCount int64
+	database.DB.Model(&models.Alert{}).Where("status = ?", alerting.StatusFiring).Count(&firingCount)
+
 	response := gin.H{
 		"stock": gin.H{
 			"amount_gram": stock.AmountGram,
@@ -55,6 +67,10 @@ func GetDashboard(c *gin.Context) {
 			"last_updated": feederStatus.LastUpdated,
 		},
 		"environment": environment,
+		"alerts": gin.H{
+			"firing": firingCount,
+			"recent": openAlerts,
+		},
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"time"
 
+	"iot-backend-cursor/audit"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
 	"iot-backend-cursor/models"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +19,8 @@ func SeedDemoData(c *gin.Context) {
 	// database.DB.Exec("DELETE FROM uv_schedules")
 	// database.DB.Exec("DELETE FROM action_history")
 
+	before := demoDataSummary()
+
 	// Set initial stock
 	var stock models.Stock
 	if err := database.DB.First(&stock).Error; err != nil {
@@ -78,11 +82,11 @@ func SeedDemoData(c *gin.Context) {
 			if feedTime.Before(now) {
 				endTime := feedTime.Add(5 * time.Second)
 				action := models.ActionHistory{
-					DeviceType:    "FEEDER",
+					DeviceType:    devices.Feeder,
 					TriggerSource: "SCHEDULE",
 					StartTime:     feedTime,
 					EndTime:       &endTime,
-					Status:        "SUCCESS",
+					Status:        models.ActionSuccess,
 					Value:         10,
 				}
 				database.DB.Create(&action)
@@ -97,17 +101,18 @@ func SeedDemoData(c *gin.Context) {
 				uvEnd = now
 			}
 			action := models.ActionHistory{
-				DeviceType:    "UV",
+				DeviceType:    devices.UV,
 				TriggerSource: "SCHEDULE",
 				StartTime:     uvStart,
 				EndTime:       &uvEnd,
-				Status:        "SUCCESS",
+				Status:        models.ActionSuccess,
 				Value:         0,
 			}
 			database.DB.Create(&action)
 		}
 	}
 
+	audit.Record(c, "demo_data", "seed", before, demoDataSummary())
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Demo data seeded successfully",
 		"stock":   stock.AmountGram,
@@ -120,7 +125,9 @@ func SeedDemoData(c *gin.Context) {
 
 // ClearDemoData clears all demo data
 func ClearDemoData(c *gin.Context) {
-	database.DB.Exec("DELETE FROM action_history")
+	before := demoDataSummary()
+
+	database.DB.Exec("DELETE FROM action_histories")
 	database.DB.Exec("DELETE FROM pakan_schedules")
 	database.DB.Exec("DELETE FROM uv_schedules")
 	
@@ -130,7 +137,26 @@ func ClearDemoData(c *gin.Context) {
 		database.DB.Save(&stock)
 	}
 
+	audit.Record(c, "demo_data", "clear", before, demoDataSummary())
 	c.JSON(http.StatusOK, gin.H{"message": "Demo data cleared"})
 }
 
+// demoDataSummary returns row counts and stock touched by seed/clear, used as audit snapshot
+func demoDataSummary() gin.H {
+	var history, feederSchedules, uvSchedules int64
+	database.DB.Model(&models.ActionHistory{}).Count(&history)
+	database.DB.Model(&models.PakanSchedule{}).Count(&feederSchedules)
+	database.DB.Model(&models.UVSchedule{}).Count(&uvSchedules)
+
+	var stock models.Stock
+	database.DB.First(&stock)
+
+	return gin.H{
+		"action_histories": history,
+		"feeder_schedules": feederSchedules,
+		"uv_schedules":     uvSchedules,
+		"stock_gram":       stock.AmountGram,
+	}
+}
+
 
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/commands"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceCommandRequest is a command for any registered device type
+type DeviceCommandRequest struct {
+	State           string `json:"state"`            // ON, OFF (on/off devices)
+	DurationMinutes int    `json:"duration_minutes"` // optional, 0 stays on until OFF
+	Amount          int    `json:"amount"`           // dose devices (grams for the feeder)
+}
+
+// GetDevices returns all registered device types with their current status
+func GetDevices(c *gin.Context) {
+	var statuses []models.DeviceStatus
+	if err := database.DB.Find(&statuses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	byType := make(map[string]models.DeviceStatus, len(statuses))
+	for _, status := range statuses {
+		byType[status.DeviceType] = status
+	}
+
+	data := make([]gin.H, 0)
+	for _, deviceType := range devices.All() {
+		data = append(data, gin.H{
+			"device": deviceType,
+			"status": byType[deviceType.Name],
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetDevice returns a device type with its current status
+func GetDevice(c *gin.Context) {
+	deviceType, ok := devices.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	var status models.DeviceStatus
+	database.DB.Where("device_type = ?", deviceType.Name).First(&status)
+
+	c.JSON(http.StatusOK, gin.H{
+		"device": deviceType,
+		"status": status,
+	})
+}
+
+// SendDeviceCommand sends an ON/OFF or dose command to a device
+func SendDeviceCommand(c *gin.Context) {
+	deviceType, ok := devices.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	var req DeviceCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if deviceType.HasCapability(devices.CapDose) {
+		action, err := commands.Dose(c.Request.Context(), deviceType, req.Amount, "MANUAL")
+		if action == nil && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+			return
+		}
+
+		audit.Record(c, "action_history", action.ID, nil, action)
+		c.JSON(http.StatusOK, gin.H{
+			"message":   fmt.Sprintf("%s command sent", deviceType.Name),
+			"action_id": action.ID,
+			"amount":    action.Value,
+		})
+		return
+	}
+
+	switch strings.ToUpper(req.State) {
+	case "ON":
+		if req.DurationMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration_minutes cannot be negative"})
+			return
+		}
+
+		action, err := commands.TurnOn(c.Request.Context(), deviceType, req.DurationMinutes*60, "MANUAL")
+		if errors.Is(err, service.ErrForcedOff) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if action == nil && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+			return
+		}
+
+		audit.Record(c, "action_history", action.ID, nil, action)
+		c.JSON(http.StatusOK, gin.H{
+			"message":      fmt.Sprintf("%s turned ON", deviceType.Name),
+			"action_id":    action.ID,
+			"duration_sec": action.Value,
+			"end_time":     action.EndTime,
+		})
+
+	case "OFF":
+		stopped, err := commands.TurnOff(c.Request.Context(), deviceType, models.ActionStopped, "stopped by user")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+			return
+		}
+
+		ids := make([]uint, 0, len(stopped))
+		for _, action := range stopped {
+			ids = append(ids, action.ID)
+		}
+
+		audit.Record(c, "device", deviceType.Name, nil, gin.H{"state": "OFF", "stopped_actions": ids})
+		c.JSON(http.StatusOK, gin.H{
+			"message":         fmt.Sprintf("%s turned OFF", deviceType.Name),
+			"stopped_actions": ids,
+		})
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state must be ON or OFF"})
+	}
+}
+
+// scheduleDeviceType validates the device type of a schedule, defaulting to
+// defaultType, and checks that it supports the schedule kind
+func scheduleDeviceType(name, defaultType, capability string) (string, error) {
+	if name == "" {
+		name = defaultType
+	}
+
+	deviceType, ok := devices.Get(name)
+	if !ok {
+		return "", fmt.Errorf("unknown device_type: %s", name)
+	}
+	if !deviceType.HasCapability(capability) {
+		return "", fmt.Errorf("device_type %s does not support %s schedules", deviceType.Name, capability)
+	}
+	return deviceType.Name, nil
+}
@@ -1,10 +1,11 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 	"os"
 
+	"iot-backend-cursor/logging"
+
 	"github.com/gin-gonic/gin"
 	"gopkg.in/yaml.v3"
 )
@@ -20,7 +21,7 @@ func ServeOpenAPIJSON(c *gin.Context) {
 	// Read YAML file
 	yamlData, err := os.ReadFile("./openapi.yaml")
 	if err != nil {
-		log.Printf("Error reading openapi.yaml: %v", err)
+		logging.FromContext(c.Request.Context()).Error("error reading openapi.yaml", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read OpenAPI specification"})
 		return
 	}
@@ -28,7 +29,7 @@ func ServeOpenAPIJSON(c *gin.Context) {
 	// Parse YAML
 	var data interface{}
 	if err := yaml.Unmarshal(yamlData, &data); err != nil {
-		log.Printf("Error parsing YAML: %v", err)
+		logging.FromContext(c.Request.Context()).Error("error parsing openapi.yaml", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse OpenAPI specification"})
 		return
 	}
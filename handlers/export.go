@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/export"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client
+const exportFlushEvery = 500
+
+// ExportHistory streams action history as CSV, NDJSON or XLSX. Filters are
+// the same as for GetHistory: from, to, device_type, trigger_source, status.
+func ExportHistory(c *gin.Context) {
+	query, ok := exportRange(c, database.DB.Model(&models.ActionHistory{}), "start_time")
+	if !ok {
+		return
+	}
+
+	query = utils.WhereIn(c, query, "device_type", "device_type")
+	query = utils.WhereIn(c, query, "trigger_source", "trigger_source")
+	query = utils.WhereIn(c, query, "status", "status")
+
+	columns := []string{"id", "device_type", "trigger_source", "status", "value", "start_time", "end_time", "created_at"}
+	streamExport(c, "history", columns, query.Order("start_time ASC, id ASC"), func(rows *sql.Rows) ([]interface{}, error) {
+		var action models.ActionHistory
+		if err := database.DB.ScanRows(rows, &action); err != nil {
+			return nil, err
+		}
+		return []interface{}{action.ID, action.DeviceType, action.TriggerSource, action.Status, action.Value,
+			action.StartTime, action.EndTime, action.CreatedAt}, nil
+	})
+}
+
+// ExportSensors streams sensor data as CSV, NDJSON or XLSX. Without metric
+// the DHT sensor log is exported; with metric (and optional sensor_id,
+// quality) the generic readings are. Both accept from and to.
+func ExportSensors(c *gin.Context) {
+	metric := c.Query("metric")
+	if metric == "" {
+		query, ok := exportRange(c, database.DB.Model(&models.SensorLog{}), "recorded_at")
+		if !ok {
+			return
+		}
+
+		columns := []string{"id", "temperature", "humidity", "recorded_at", "received_at"}
+		streamExport(c, "sensors", columns, query.Order("recorded_at ASC, id ASC"), func(rows *sql.Rows) ([]interface{}, error) {
+			var entry models.SensorLog
+			if err := database.DB.ScanRows(rows, &entry); err != nil {
+				return nil, err
+			}
+			return []interface{}{entry.ID, entry.Temperature, entry.Humidity, entry.RecordedAt, entry.ReceivedAt}, nil
+		})
+		return
+	}
+
+	if !sensors.IsMetric(metric) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown metric: " + metric})
+		return
+	}
+
+	query, ok := exportRange(c, database.DB.Model(&models.SensorReading{}).Where("metric = ?", metric), "recorded_at")
+	if !ok {
+		return
+	}
+	query = utils.WhereIn(c, query, "sensor_id", "sensor_id")
+	query = utils.WhereIn(c, query, "quality", "quality")
+
+	columns := []string{"id", "sensor_id", "metric", "unit", "value", "raw_value", "quality", "recorded_at", "received_at"}
+	streamExport(c, "sensors-"+metric, columns, query.Order("recorded_at ASC, id ASC"), func(rows *sql.Rows) ([]interface{}, error) {
+		var reading models.SensorReading
+		if err := database.DB.ScanRows(rows, &reading); err != nil {
+			return nil, err
+		}
+		return []interface{}{reading.ID, reading.SensorID, reading.Metric, reading.Unit, reading.Value, reading.RawValue,
+			reading.Quality, reading.RecordedAt, reading.ReceivedAt}, nil
+	})
+}
+
+// exportRange applies the optional from/to parameters to column
+func exportRange(c *gin.Context, query *gorm.DB, column string) (*gorm.DB, bool) {
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return timeRange.Apply(query, column), true
+}
+
+// streamExport writes the rows of query to the response one by one in the
+// requested format, flushing regularly so large exports start downloading
+// immediately
+func streamExport(c *gin.Context, name string, columns []string, query *gorm.DB,
+	scan func(rows *sql.Rows) ([]interface{}, error)) {
+	format := export.ParseFormat(c.DefaultQuery("format", export.CSV))
+	if format != export.CSV && format != export.NDJSON && format != export.XLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, ndjson or xlsx"})
+		return
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	if format == export.NDJSON {
+		filename = strings.TrimSuffix(filename, export.NDJSON) + "jsonl"
+	}
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	logger := logging.FromContext(c.Request.Context()).With("export", name, "format", format)
+	writer, err := export.New(format, c.Writer, columns)
+	if err != nil {
+		logger.Error("error starting export", "error", err)
+		return
+	}
+
+	count := 0
+	for rows.Next() {
+		values, err := scan(rows)
+		if err != nil {
+			logger.Error("error reading export row, aborting download", "rows", count, "error", err)
+			abortExport(c)
+			return
+		}
+		if err := writer.Write(values); err != nil {
+			// Usually the client went away
+			logger.Warn("error writing export", "rows", count, "error", err)
+			return
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("error reading export rows, aborting download", "rows", count, "error", err)
+		abortExport(c)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		logger.Warn("error finishing export", "rows", count, "error", err)
+		return
+	}
+	logger.Info("export finished", "rows", count)
+}
+
+// abortExport drops the connection of an export that failed after the 200
+// status was sent, so the client sees a broken download instead of a file
+// that looks complete. The file is not finalized either (an XLSX stays
+// unreadable) for connections that can't be dropped, such as HTTP/2.
+func abortExport(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"net/http"
-	"time"
+	"strings"
 
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/commands"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
 	"iot-backend-cursor/models"
-	"iot-backend-cursor/mqtt"
 	"iot-backend-cursor/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,14 +22,17 @@ func GetFeederSchedules(c *gin.Context) {
 	// Get pagination params (default: page 1, page_size 20, max 100)
 	pagination := utils.GetPaginationParams(c, 20, 100)
 
+	// Filter by device type (default: FEEDER)
+	query := database.DB.Model(&models.PakanSchedule{}).Where("device_type = ?", strings.ToUpper(c.DefaultQuery("device_type", devices.Feeder)))
+
 	// Count total records
-	if err := database.DB.Model(&models.PakanSchedule{}).Count(&total).Error; err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get paginated results ordered by day and time
-	if err := database.DB.Order("day_name, time").
+	if err := query.Order("day_name, time").
 		Offset(pagination.Offset).
 		Limit(pagination.PageSize).
 		Find(&schedules).Error; err != nil {
@@ -52,10 +57,17 @@ func CreateFeederSchedule(c *gin.Context) {
 		return
 	}
 
+	deviceType, err := scheduleDeviceType(schedule.DeviceType, devices.Feeder, devices.CapDose)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.DeviceType = deviceType
+
 	// Validate: max 5 schedules per day
 	var count int64
 	database.DB.Model(&models.PakanSchedule{}).
-		Where("day_name = ? AND is_active = ?", schedule.DayName, true).
+		Where("device_type = ? AND day_name = ? AND is_active = ?", schedule.DeviceType, schedule.DayName, true).
 		Count(&count)
 
 	if count >= 5 {
@@ -73,6 +85,7 @@ func CreateFeederSchedule(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, "feeder_schedule", schedule.ID, nil, schedule)
 	c.JSON(http.StatusCreated, schedule)
 }
 
@@ -85,16 +98,24 @@ func UpdateFeederSchedule(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
 		return
 	}
+	before := schedule
 
 	if err := c.ShouldBindJSON(&schedule); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	deviceType, err := scheduleDeviceType(schedule.DeviceType, devices.Feeder, devices.CapDose)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.DeviceType = deviceType
+
 	// Validate: max 5 schedules per day (excluding current one)
 	var count int64
 	database.DB.Model(&models.PakanSchedule{}).
-		Where("day_name = ? AND is_active = ? AND id != ?", schedule.DayName, true, id).
+		Where("device_type = ? AND day_name = ? AND is_active = ? AND id != ?", schedule.DeviceType, schedule.DayName, true, id).
 		Count(&count)
 
 	if count >= 5 {
@@ -107,16 +128,24 @@ func UpdateFeederSchedule(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, "feeder_schedule", schedule.ID, before, schedule)
 	c.JSON(http.StatusOK, schedule)
 }
 
 // DeleteFeederSchedule deletes a feeding schedule
 func DeleteFeederSchedule(c *gin.Context) {
 	id := c.Param("id")
+	var before models.PakanSchedule
+	found := database.DB.First(&before, id).Error == nil
+
 	if err := database.DB.Delete(&models.PakanSchedule{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	if found {
+		audit.Record(c, "feeder_schedule", before.ID, before, nil)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
 }
 
@@ -135,38 +164,25 @@ func ManualFeed(c *gin.Context) {
 	}
 
 	amountGram := utils.NormalizeFeedAmount(req.AmountGram)
-	doses := utils.CalculateFeedDoses(amountGram)
 
 	// Get last successful feed
 	var lastFeed models.ActionHistory
-	err := database.DB.Where("device_type = ? AND status = ?", "FEEDER", "SUCCESS").
+	err := database.DB.Where("device_type = ? AND status = ?", devices.Feeder, models.ActionSuccess).
 		Order("start_time DESC").
 		First(&lastFeed).Error
 
-	// Create action history entry
-	action := models.ActionHistory{
-		DeviceType:    "FEEDER",
-		TriggerSource: "MANUAL",
-		StartTime:     time.Now(),
-		Status:        "PENDING",
-		Value:         amountGram,
-	}
-
-	if err := database.DB.Create(&action).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Publish MQTT command
-	if err := mqtt.PublishFeederCommand(doses); err != nil {
-		action.Status = "FAILED"
-		database.DB.Save(&action)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+	// Record the action and publish the MQTT command
+	feeder, _ := devices.Get(devices.Feeder)
+	action, doseErr := commands.Dose(c.Request.Context(), feeder, amountGram, "MANUAL")
+	if doseErr != nil {
+		if action == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": doseErr.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+		}
 		return
 	}
-
-	action.Status = "RUNNING"
-	database.DB.Save(&action)
+	audit.Record(c, "action_history", action.ID, nil, action)
 
 	// Prepare response with last feed info
 	response := gin.H{
@@ -188,7 +204,7 @@ func ManualFeed(c *gin.Context) {
 // GetLastFeedInfo returns information about the last successful feed
 func GetLastFeedInfo(c *gin.Context) {
 	var lastFeed models.ActionHistory
-	err := database.DB.Where("device_type = ? AND status = ?", "FEEDER", "SUCCESS").
+	err := database.DB.Where("device_type = ? AND status = ?", devices.Feeder, models.ActionSuccess).
 		Order("start_time DESC").
 		First(&lastFeed).Error
 
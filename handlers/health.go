@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/mqtt"
+	"iot-backend-cursor/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// schedulerMaxTickAge is how long the scheduler may go without running a job
+// before it is considered stuck (check_manual_expiration runs every 10 seconds)
+const schedulerMaxTickAge = time.Minute
+
+var startedAt = time.Now()
+
+// Healthz reports that the process is alive (liveness probe)
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz checks the database, MQTT connection and scheduler (readiness probe)
+func Readyz(c *gin.Context) {
+	checks := gin.H{}
+	ready := true
+
+	dbErr := pingDB(c.Request.Context())
+	checks["database"] = healthCheck(dbErr == nil, dbErr)
+	ready = ready && dbErr == nil
+
+	mqttOK := mqtt.Connected()
+	checks["mqtt"] = gin.H{"ok": mqttOK, "broker": mqtt.BrokerURL()}
+	ready = ready && mqttOK
+
+	tickAge := time.Since(scheduler.LastTick())
+	schedulerOK := scheduler.Running() && tickAge < schedulerMaxTickAge
+	checks["scheduler"] = gin.H{
+		"ok":                    schedulerOK,
+		"running":               scheduler.Running(),
+		"last_tick_age_seconds": int(tickAge.Seconds()),
+	}
+	ready = ready && schedulerOK
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// GetDiagnostics returns runtime details for troubleshooting: MQTT broker,
+// subscriptions and last message per topic, and cron jobs with their next run
+func GetDiagnostics(c *gin.Context) {
+	dbErr := pingDB(c.Request.Context())
+
+	c.JSON(http.StatusOK, gin.H{
+		"started_at":     startedAt.Format(time.RFC3339),
+		"uptime_seconds": int(time.Since(startedAt).Seconds()),
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"database":       healthCheck(dbErr == nil, dbErr),
+		"mqtt": gin.H{
+			"broker":        mqtt.BrokerURL(),
+			"mock":          mqtt.MockMode,
+			"connected":     mqtt.Connected(),
+			"subscriptions": mqtt.Subscriptions(),
+			"last_messages": mqtt.LastMessages(),
+		},
+		"scheduler": gin.H{
+			"running":   scheduler.Running(),
+			"last_tick": scheduler.LastTick().Format(time.RFC3339),
+			"jobs":      scheduler.Jobs(),
+		},
+	})
+}
+
+func pingDB(ctx context.Context) error {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+func healthCheck(ok bool, err error) gin.H {
+	result := gin.H{"ok": ok}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	return result
+}
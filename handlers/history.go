@@ -5,12 +5,19 @@ import (
 
 	"iot-backend-cursor/database"
 	"iot-backend-cursor/models"
+	"iot-backend-cursor/service"
 	"iot-backend-cursor/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetHistory returns action history with optional filters and pagination
+// historySortFields are the fields GetHistory can be sorted by
+var historySortFields = []string{"created_at", "start_time", "value", "id"}
+
+// GetHistory returns action history with optional filters and pagination.
+// device_type, trigger_source and status accept several values (comma-separated
+// or repeated), from/to bound start_time, and sort takes e.g. -start_time.
+// Pass cursor (empty for the first page) for keyset pagination.
 func GetHistory(c *gin.Context) {
 	var history []models.ActionHistory
 	var total int64
@@ -18,36 +25,49 @@ func GetHistory(c *gin.Context) {
 	// Get pagination params (default: page 1, page_size 50, max 200)
 	pagination := utils.GetPaginationParams(c, 50, 200)
 
-	// Build query with filters
-	query := database.DB.Model(&models.ActionHistory{})
-
-	// Filter by device type
-	if deviceType := c.Query("device_type"); deviceType != "" {
-		query = query.Where("device_type = ?", deviceType)
+	sort, err := utils.GetSortParams(c, historySortFields, "-created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Filter by trigger source
-	if triggerSource := c.Query("trigger_source"); triggerSource != "" {
-		query = query.Where("trigger_source = ?", triggerSource)
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Filter by status
-	if status := c.Query("status"); status != "" {
-		query = query.Where("status = ?", status)
+	// Build query with filters
+	query := database.DB.Model(&models.ActionHistory{})
+	query = utils.WhereIn(c, query, "device_type", "device_type")
+	query = utils.WhereIn(c, query, "trigger_source", "trigger_source")
+	query = utils.WhereIn(c, query, "status", "status")
+	query = timeRange.Apply(query, "start_time")
+
+	// Count total records (offset pagination only; keyset pages skip the count)
+	if !pagination.Keyset {
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	// Count total records
-	if err := query.Count(&total).Error; err != nil {
+	page, err := utils.Paginate(query, pagination, sort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := page.Find(&history).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get paginated results
-	if err := query.Order("created_at DESC").
-		Offset(pagination.Offset).
-		Limit(pagination.PageSize).
-		Find(&history).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if pagination.Keyset {
+		cursorMeta := utils.BuildCursorResponse(&history, pagination, sort)
+		c.JSON(http.StatusOK, gin.H{
+			"data":       history,
+			"pagination": cursorMeta,
+		})
 		return
 	}
 
@@ -59,3 +79,23 @@ func GetHistory(c *gin.Context) {
 		"pagination": paginationMeta,
 	})
 }
+
+// GetActionTimeline returns an action with its status changes, oldest first
+func GetActionTimeline(c *gin.Context) {
+	var action models.ActionHistory
+	if err := database.DB.First(&action, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Action not found"})
+		return
+	}
+
+	timeline, err := service.Timeline(action.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":   action,
+		"timeline": timeline,
+	})
+}
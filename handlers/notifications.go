@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/notify"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationChannelRequest represents the request body for creating or updating a channel
+type NotificationChannelRequest struct {
+	Name             string          `json:"name" binding:"required"`
+	Type             string          `json:"type" binding:"required"` // webhook, email, telegram
+	Config           json.RawMessage `json:"config" binding:"required"`
+	EventTypes       []string        `json:"event_types" binding:"required"`
+	RateLimitSeconds int             `json:"rate_limit_seconds"`
+	IsActive         *bool           `json:"is_active"`
+}
+
+// GetNotificationChannels returns all channels with secrets masked
+func GetNotificationChannels(c *gin.Context) {
+	var channels []models.NotificationChannel
+	if err := database.DB.Order("name").Find(&channels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range channels {
+		channels[i] = maskChannel(channels[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        channels,
+		"event_types": notify.EventTypes,
+	})
+}
+
+// CreateNotificationChannel creates a notification channel
+func CreateNotificationChannel(c *gin.Context) {
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channel := models.NotificationChannel{IsActive: true}
+	if err := applyChannelRequest(&channel, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	masked := maskChannel(channel)
+	audit.Record(c, "notification_channel", channel.ID, nil, masked)
+	c.JSON(http.StatusCreated, masked)
+}
+
+// UpdateNotificationChannel replaces a channel's settings
+func UpdateNotificationChannel(c *gin.Context) {
+	id := c.Param("id")
+	var channel models.NotificationChannel
+
+	if err := database.DB.First(&channel, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+	before := maskChannel(channel)
+
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Secrets sent back masked (or left out) keep their stored value
+	req.Config = json.RawMessage(notify.KeepSecrets(string(req.Config), channel.Config))
+
+	if err := applyChannelRequest(&channel, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	masked := maskChannel(channel)
+	audit.Record(c, "notification_channel", channel.ID, before, masked)
+	c.JSON(http.StatusOK, masked)
+}
+
+// DeleteNotificationChannel deletes a notification channel
+func DeleteNotificationChannel(c *gin.Context) {
+	id := c.Param("id")
+	var channel models.NotificationChannel
+
+	if err := database.DB.First(&channel, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "notification_channel", channel.ID, maskChannel(channel), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Channel deleted"})
+}
+
+// TestNotificationChannel sends a test notification and reports the result
+func TestNotificationChannel(c *gin.Context) {
+	id := c.Param("id")
+	var channel models.NotificationChannel
+
+	if err := database.DB.First(&channel, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	delivery, err := notify.SendTest(channel)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":    "Test notification failed: " + err.Error(),
+			"delivery": delivery,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Test notification sent",
+		"delivery": delivery,
+	})
+}
+
+// GetNotificationDeliveries returns the delivery log with optional filters and pagination
+func GetNotificationDeliveries(c *gin.Context) {
+	var deliveries []models.NotificationDelivery
+	var total int64
+
+	// Get pagination params (default: page 1, page_size 50, max 200)
+	pagination := utils.GetPaginationParams(c, 50, 200)
+
+	query := database.DB.Model(&models.NotificationDelivery{})
+
+	if channelID := c.Query("channel_id"); channelID != "" {
+		query = query.Where("channel_id = ?", channelID)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := query.Order("created_at DESC").
+		Offset(pagination.Offset).
+		Limit(pagination.PageSize).
+		Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	paginationMeta := utils.BuildPaginationResponse(pagination.Page, pagination.PageSize, total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       deliveries,
+		"pagination": paginationMeta,
+	})
+}
+
+// applyChannelRequest validates req and copies it onto channel
+func applyChannelRequest(channel *models.NotificationChannel, req NotificationChannelRequest) error {
+	if _, err := notify.BuildChannel(req.Type, string(req.Config)); err != nil {
+		return err
+	}
+
+	for _, eventType := range req.EventTypes {
+		if eventType != "*" && !containsString(notify.EventTypes, eventType) {
+			return fmt.Errorf("unknown event type: %s", eventType)
+		}
+	}
+
+	if req.RateLimitSeconds < 0 {
+		return fmt.Errorf("rate_limit_seconds cannot be negative")
+	}
+
+	channel.Name = strings.TrimSpace(req.Name)
+	channel.Type = req.Type
+	channel.Config = string(req.Config)
+	channel.EventTypes = strings.Join(req.EventTypes, ",")
+	channel.RateLimitSeconds = req.RateLimitSeconds
+	if req.IsActive != nil {
+		channel.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+func maskChannel(channel models.NotificationChannel) models.NotificationChannel {
+	channel.Config = notify.MaskConfig(channel.Config)
+	return channel
+}
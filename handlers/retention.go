@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRetentionDryRun reports how many rows each retention policy would remove now
+func GetRetentionDryRun(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": true,
+		"data":    retention.Run(true),
+	})
+}
+
+// RunRetention applies the retention policies now instead of waiting for the nightly job
+func RunRetention(c *gin.Context) {
+	results := retention.Run(false)
+
+	audit.Record(c, "retention", "", nil, gin.H{"results": results})
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": false,
+		"data":    results,
+	})
+}
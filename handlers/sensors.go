@@ -1,18 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"iot-backend-cursor/audit"
 	"iot-backend-cursor/database"
 	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
 	"iot-backend-cursor/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// GetCurrentSensor returns the latest sensor reading
+// GetSensorMetrics returns the metrics the backend ingests
+func GetSensorMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": sensors.Metrics})
+}
+
+// GetCurrentSensor returns the latest sensor reading. With ?metric= (and
+// optional sensor_id) it returns the latest reading of that metric.
 func GetCurrentSensor(c *gin.Context) {
+	if metric := c.Query("metric"); metric != "" {
+		getCurrentMetric(c, metric)
+		return
+	}
+
 	var sensor models.SensorLog
 	err := database.DB.Order("recorded_at DESC").First(&sensor).Error
 
@@ -28,24 +44,96 @@ func GetCurrentSensor(c *gin.Context) {
 		"temperature":  sensor.Temperature,
 		"humidity":     sensor.Humidity,
 		"last_updated": sensor.RecordedAt,
+		"metrics":      latestMetrics(),
 	})
 }
 
-// GetSensorHistory returns sensor readings history with pagination and time filter
+func getCurrentMetric(c *gin.Context, metric string) {
+	if !sensors.IsMetric(metric) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown metric: " + metric})
+		return
+	}
+
+	reading, err := sensors.Latest(metric, c.Query("sensor_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"exists":  false,
+			"message": "No sensor data available",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"metric":       reading.Metric,
+		"sensor_id":    reading.SensorID,
+		"value":        reading.Value,
+		"unit":         reading.Unit,
+		"last_updated": reading.RecordedAt,
+	})
+}
+
+// latestMetrics returns the latest reading of every metric that has data
+func latestMetrics() gin.H {
+	latest := gin.H{}
+	for _, metric := range sensors.Metrics {
+		if reading, err := sensors.Latest(metric.Name, ""); err == nil {
+			latest[metric.Name] = gin.H{
+				"sensor_id":    reading.SensorID,
+				"value":        reading.Value,
+				"unit":         reading.Unit,
+				"last_updated": reading.RecordedAt,
+			}
+		}
+	}
+	return latest
+}
+
+// GetSensorHistory returns sensor readings history with pagination and time filter.
+// With ?metric= it returns readings of that metric (sensor_id and quality accept
+// several values). period (24h, 7d, 30d) or from/to bound recorded_at, sort
+// takes e.g. -recorded_at, and cursor switches to keyset pagination.
 func GetSensorHistory(c *gin.Context) {
-	var sensors []models.SensorLog
 	var total int64
 
 	// Get pagination params (default: page 1, page_size 100, max 500)
 	pagination := utils.GetPaginationParams(c, 100, 500)
 
-	// Time period filter
-	period := c.Query("period")
-	query := database.DB.Model(&models.SensorLog{})
+	var query *gorm.DB
+	var readings interface{}
+	sortFields := []string{"recorded_at", "temperature", "humidity", "id"}
+
+	if metric := c.Query("metric"); metric != "" {
+		if !sensors.IsMetric(metric) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown metric: " + metric})
+			return
+		}
+		query = database.DB.Model(&models.SensorReading{}).Where("metric = ?", metric)
+		query = utils.WhereIn(c, query, "sensor_id", "sensor_id")
+		// Flagged readings are kept for inspection, e.g. ?quality=SPIKE
+		query = utils.WhereIn(c, query, "quality", "quality")
+		readings = &[]models.SensorReading{}
+		sortFields = []string{"recorded_at", "value", "id"}
+	} else {
+		query = database.DB.Model(&models.SensorLog{})
+		readings = &[]models.SensorLog{}
+	}
 
-	// Apply time filter
+	sort, err := utils.GetSortParams(c, sortFields, "-recorded_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query = timeRange.Apply(query, "recorded_at")
+
+	// Apply time period filter
 	now := time.Now()
-	switch period {
+	switch c.Query("period") {
 	case "24h":
 		query = query.Where("recorded_at >= ?", now.Add(-24*time.Hour))
 	case "7d":
@@ -56,18 +144,30 @@ func GetSensorHistory(c *gin.Context) {
 		// No filter, return all (with pagination)
 	}
 
-	// Count total records
-	if err := query.Count(&total).Error; err != nil {
+	// Count total records (offset pagination only; keyset pages skip the count)
+	if !pagination.Keyset {
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	page, err := utils.Paginate(query, pagination, sort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := page.Find(readings).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get paginated results
-	if err := query.Order("recorded_at DESC").
-		Offset(pagination.Offset).
-		Limit(pagination.PageSize).
-		Find(&sensors).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if pagination.Keyset {
+		cursorMeta := utils.BuildCursorResponse(readings, pagination, sort)
+		c.JSON(http.StatusOK, gin.H{
+			"data":       readings,
+			"pagination": cursorMeta,
+		})
 		return
 	}
 
@@ -75,16 +175,64 @@ func GetSensorHistory(c *gin.Context) {
 	paginationMeta := utils.BuildPaginationResponse(pagination.Page, pagination.PageSize, total)
 
 	c.JSON(http.StatusOK, gin.H{
-		"data":       sensors,
+		"data":       readings,
 		"pagination": paginationMeta,
 	})
 }
 
+// GetSensorAggregate returns min/max/avg/count of a metric per time bucket
+// (5m, 1h, 1d) between from and to (default: last 24 hours)
+func GetSensorAggregate(c *gin.Context) {
+	metric := c.Query("metric")
+	m, ok := sensors.Get(metric)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown metric: " + metric})
+		return
+	}
+
+	bucket := c.DefaultQuery("bucket", "1h")
+	if _, ok := sensors.BucketSizes[bucket]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be 5m, 1h or 1d"})
+		return
+	}
+
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	to := time.Now()
+	if timeRange.To != nil {
+		to = *timeRange.To
+	}
+	from := to.Add(-24 * time.Hour)
+	if timeRange.From != nil {
+		from = *timeRange.From
+	}
+
+	buckets, err := sensors.Aggregate(metric, c.Query("sensor_id"), bucket, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"metric": metric,
+		"unit":   m.Unit,
+		"bucket": bucket,
+		"from":   from,
+		"to":     to,
+		"data":   buckets,
+	})
+}
+
 // InjectSensorData manually injects sensor data (for testing/demo purposes)
 func InjectSensorData(c *gin.Context) {
 	var input struct {
-		Temperature float64 `json:"temperature" binding:"required"`
-		Humidity    float64 `json:"humidity" binding:"required"`
+		Temperature *float64           `json:"temperature"`
+		Humidity    *float64           `json:"humidity"`
+		Metrics     map[string]float64 `json:"metrics"` // other metrics, e.g. {"ph": 7.1}
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -92,33 +240,81 @@ func InjectSensorData(c *gin.Context) {
 		return
 	}
 
-	// Validate ranges
-	if input.Temperature < -40 || input.Temperature > 80 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Temperature must be between -40 and 80 Celsius"})
+	values := make(map[string]float64, len(input.Metrics)+2)
+	for name, value := range input.Metrics {
+		values[name] = value
+	}
+	if input.Temperature != nil || input.Humidity != nil {
+		if input.Temperature == nil || input.Humidity == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "temperature and humidity are both required"})
+			return
+		}
+		values[sensors.Temperature] = *input.Temperature
+		values[sensors.Humidity] = *input.Humidity
+	}
+	if len(values) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "temperature and humidity, or metrics, are required"})
 		return
 	}
-	if input.Humidity < 0 || input.Humidity > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Humidity must be between 0 and 100 percent"})
+
+	for name, value := range values {
+		metric, ok := sensors.Get(name)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown metric: " + name})
+			return
+		}
+		if !metric.InRange(value) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be between %g and %g %s", name, metric.Min, metric.Max, metric.Unit)})
+			return
+		}
+	}
+
+	// Injected readings go through the same checks as MQTT data
+	now := time.Now()
+	readings := make(map[string]*models.SensorReading, len(values))
+	for name, value := range values {
+		reading, err := sensors.Ingest(sensors.Sample{Metric: name, Value: value, At: now})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sensors.ErrDuplicate) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": fmt.Sprintf("%s: %v", name, err)})
+			return
+		}
+		readings[name] = reading
+	}
+
+	response := gin.H{
+		"message":     "Sensor data injected successfully",
+		"readings":    readings,
+		"recorded_at": now,
+	}
+
+	// Like MQTT data, the legacy DHT log only keeps pairs where both readings are good
+	temperature, humidity := readings[sensors.Temperature], readings[sensors.Humidity]
+	if temperature == nil || humidity == nil ||
+		temperature.Quality != sensors.QualityGood || humidity.Quality != sensors.QualityGood {
+		audit.Record(c, "sensor_reading", "", nil, gin.H{"readings": readings})
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	// Create sensor log
 	sensor := models.SensorLog{
-		Temperature: input.Temperature,
-		Humidity:    input.Humidity,
-		RecordedAt:  time.Now(),
+		Temperature: temperature.Value,
+		Humidity:    humidity.Value,
+		RecordedAt:  now,
+		ReceivedAt:  now,
 	}
-
 	if err := database.DB.Create(&sensor).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Sensor data injected successfully",
-		"id":          sensor.ID,
-		"temperature": sensor.Temperature,
-		"humidity":    sensor.Humidity,
-		"recorded_at": sensor.RecordedAt,
-	})
+	audit.Record(c, "sensor_log", sensor.ID, nil, sensor)
+
+	response["id"] = sensor.ID
+	response["temperature"] = sensor.Temperature
+	response["humidity"] = sensor.Humidity
+	c.JSON(http.StatusOK, response)
 }
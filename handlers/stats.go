@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"iot-backend-cursor/stats"
+	"iot-backend-cursor/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStats returns feeding, UV and temperature trends. The range is either
+// ?range=7d (days, default 7d) ending now, or from/to (RFC3339).
+func GetStats(c *gin.Context) {
+	timeRange, err := utils.GetTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	to := time.Now()
+	if timeRange.To != nil {
+		to = *timeRange.To
+	}
+
+	var from time.Time
+	if timeRange.From != nil {
+		from = *timeRange.From
+	} else {
+		days, err := strconv.Atoi(strings.TrimSuffix(c.DefaultQuery("range", "7d"), "d"))
+		if err != nil || days < 1 || days > stats.MaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "range must be a number of days between 1d and 366d"})
+			return
+		}
+		// Include today, so 7d is today and the 6 days before it
+		from = to.AddDate(0, 0, -(days - 1))
+	}
+
+	report, err := stats.Compute(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
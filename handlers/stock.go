@@ -3,10 +3,13 @@ package handlers
 import (
 	"net/http"
 
+	"iot-backend-cursor/audit"
 	"iot-backend-cursor/database"
 	"iot-backend-cursor/models"
+	"iot-backend-cursor/service"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetStock returns current food stock
@@ -22,12 +25,6 @@ func GetStock(c *gin.Context) {
 
 // UpdateStock updates the food stock
 func UpdateStock(c *gin.Context) {
-	var stock models.Stock
-	if err := database.DB.First(&stock).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Stock not found"})
-		return
-	}
-
 	var updateReq struct {
 		AmountGram int `json:"amount_gram" binding:"required"`
 	}
@@ -42,12 +39,16 @@ func UpdateStock(c *gin.Context) {
 		return
 	}
 
-	stock.AmountGram = updateReq.AmountGram
-	if err := database.DB.Save(&stock).Error; err != nil {
+	before, stock, err := service.SetStock(updateReq.AmountGram)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Stock not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	audit.Record(c, "stock", stock.ID, before, stock)
 	c.JSON(http.StatusOK, stock)
 }
-
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/commands"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
 	"iot-backend-cursor/models"
 	"iot-backend-cursor/mqtt"
+	"iot-backend-cursor/scheduler"
+	"iot-backend-cursor/service"
 	"iot-backend-cursor/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,14 +29,17 @@ func GetUVSchedules(c *gin.Context) {
 	// Get pagination params (default: page 1, page_size 20, max 100)
 	pagination := utils.GetPaginationParams(c, 20, 100)
 
+	// Filter by device type (default: UV)
+	query := database.DB.Model(&models.UVSchedule{}).Where("device_type = ?", strings.ToUpper(c.DefaultQuery("device_type", devices.UV)))
+
 	// Count total records
-	if err := database.DB.Model(&models.UVSchedule{}).Count(&total).Error; err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get paginated results ordered by day and start_time
-	if err := database.DB.Order("day_name, start_time").
+	if err := query.Order("day_name, start_time").
 		Offset(pagination.Offset).
 		Limit(pagination.PageSize).
 		Find(&schedules).Error; err != nil {
@@ -52,11 +64,19 @@ func CreateUVSchedule(c *gin.Context) {
 		return
 	}
 
+	deviceType, err := scheduleDeviceType(schedule.DeviceType, devices.UV, devices.CapOnOff)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.DeviceType = deviceType
+
 	if err := database.DB.Create(&schedule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	audit.Record(c, "uv_schedule", schedule.ID, nil, schedule)
 	c.JSON(http.StatusCreated, schedule)
 }
 
@@ -69,27 +89,43 @@ func UpdateUVSchedule(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
 		return
 	}
+	before := schedule
 
 	if err := c.ShouldBindJSON(&schedule); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	deviceType, err := scheduleDeviceType(schedule.DeviceType, devices.UV, devices.CapOnOff)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.DeviceType = deviceType
+
 	if err := database.DB.Save(&schedule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	audit.Record(c, "uv_schedule", schedule.ID, before, schedule)
 	c.JSON(http.StatusOK, schedule)
 }
 
 // DeleteUVSchedule deletes a UV schedule
 func DeleteUVSchedule(c *gin.Context) {
 	id := c.Param("id")
+	var before models.UVSchedule
+	found := database.DB.First(&before, id).Error == nil
+
 	if err := database.DB.Delete(&models.UVSchedule{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	if found {
+		audit.Record(c, "uv_schedule", before.ID, before, nil)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
 }
 
@@ -112,46 +148,30 @@ func ManualUV(c *gin.Context) {
 	}
 
 	durationSec := req.DurationMinutes * 60
-	startTime := time.Now()
-	endTime := startTime.Add(time.Duration(durationSec) * time.Second)
-
-	// Create action history entry
-	action := models.ActionHistory{
-		DeviceType:    "UV",
-		TriggerSource: "MANUAL",
-		StartTime:     startTime,
-		EndTime:       &endTime,
-		Status:        "RUNNING",
-		Value:         durationSec,
-	}
-
-	if err := database.DB.Create(&action).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Publish MQTT command
-	if err := mqtt.PublishUVCommand("ON", durationSec); err != nil {
-		action.Status = "FAILED"
-		database.DB.Save(&action)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+	uv, _ := devices.Get(devices.UV)
+	action, err := commands.TurnOn(c.Request.Context(), uv, durationSec, "MANUAL")
+	if err != nil {
+		if errors.Is(err, service.ErrForcedOff) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if action == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send command to device"})
+		}
 		return
 	}
 
-	// Update device status immediately
-	var deviceStatus models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-		deviceStatus.Status = "ON"
-		deviceStatus.Remaining = 0 // Backend doesn't track remaining, scheduler will turn off
-		deviceStatus.LastUpdated = time.Now()
-		database.DB.Save(&deviceStatus)
+	// The manual run wins over schedules until the end of the current window
+	if err := holdSchedulesForManualRun(c.Request.Context(), action); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("error setting manual override", "action_id", action.ID, "error", err)
 	}
 
+	audit.Record(c, "action_history", action.ID, nil, action)
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "UV command sent",
 		"action_id":    action.ID,
 		"duration_sec": durationSec,
-		"end_time":     endTime.Format(time.RFC3339),
+		"end_time":     action.EndTime.Format(time.RFC3339),
 	})
 }
 
@@ -159,7 +179,7 @@ func ManualUV(c *gin.Context) {
 func StopManualUV(c *gin.Context) {
 	// Find any running UV action (manual or schedule)
 	var action models.ActionHistory
-	err := database.DB.Where("device_type = ? AND status = ?", "UV", "RUNNING").
+	err := database.DB.Where("device_type = ? AND status = ?", devices.UV, models.ActionRunning).
 		Order("start_time DESC").
 		First(&action).Error
 
@@ -168,24 +188,31 @@ func StopManualUV(c *gin.Context) {
 		return
 	}
 
-	// Publish MQTT command to turn off UV
-	if err := mqtt.PublishUVCommand("OFF", 0); err != nil {
+	// Turn off UV and stop every running UV action
+	uv, _ := devices.Get(devices.UV)
+	stopped, err := commands.TurnOff(commands.ActionContext(c.Request.Context(), &action), uv, models.ActionStopped, "stopped by user")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send stop command to device"})
 		return
 	}
 
-	now := time.Now()
-	action.EndTime = &now
-	action.Status = "STOPPED"
-	database.DB.Save(&action)
+	for _, after := range stopped {
+		before := after
+		before.Status = models.ActionRunning
+		before.EndTime = nil
+		audit.Record(c, "action_history", after.ID, before, after)
+	}
 
-	// Update device status
-	var deviceStatus models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-		deviceStatus.Status = "OFF"
-		deviceStatus.Remaining = 0
-		deviceStatus.LastUpdated = now
-		database.DB.Save(&deviceStatus)
+	// Stopping is a manual decision too: schedules stay off for the rest of
+	// the current window
+	if err := holdSchedulesAfterStop(c.Request.Context()); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("error setting manual override", "error", err)
+	}
+
+	now := time.Now()
+	if len(stopped) > 0 {
+		action = stopped[0]
+		now = *action.EndTime
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -199,14 +226,14 @@ func StopManualUV(c *gin.Context) {
 // GetUVStatus returns current UV status
 func GetUVStatus(c *gin.Context) {
 	var status models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "UV").First(&status).Error; err != nil {
+	if err := database.DB.Where("device_type = ?", devices.UV).First(&status).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "UV status not found"})
 		return
 	}
 
 	// Check if there's a running manual UV
 	var manualUV models.ActionHistory
-	hasManual := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "MANUAL", "RUNNING").
+	hasManual := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", devices.UV, "MANUAL", models.ActionRunning).
 		Order("start_time DESC").
 		First(&manualUV).Error == nil
 
@@ -221,5 +248,165 @@ func GetUVStatus(c *gin.Context) {
 		response["manual_end_time"] = manualUV.EndTime
 	}
 
+	override, err := service.ActiveOverride(devices.UV)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response["override"] = override
+
 	c.JSON(http.StatusOK, response)
 }
+
+// UVOverrideRequest represents the request body for a UV schedule override
+type UVOverrideRequest struct {
+	Mode  string  `json:"mode" binding:"required"`
+	Hours float64 `json:"hours"` // PAUSE requires it; MANUAL and FORCE_OFF default to the current window end
+}
+
+// SetUVOverride holds UV schedules back: MANUAL until the end of the current
+// schedule window, PAUSE for a number of hours, FORCE_OFF keeps UV off and
+// refuses manual runs too. Running schedule runs end OVERRIDDEN.
+func SetUVOverride(c *gin.Context) {
+	var req UVOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode is required"})
+		return
+	}
+
+	mode := strings.ToUpper(req.Mode)
+	if !containsString(service.OverrideModes, mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be one of " + strings.Join(service.OverrideModes, ", ")})
+		return
+	}
+	if req.Hours < 0 || (mode == service.OverridePause && req.Hours == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be greater than 0"})
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(req.Hours * float64(time.Hour)))
+	if req.Hours == 0 {
+		end, ok, err := scheduler.WindowEnd(devices.UV, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active UV schedule window, hours is required"})
+			return
+		}
+		until = end
+	}
+
+	before, err := service.ActiveOverride(devices.UV)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Turn UV off first when forced off or when only schedule runs are running
+	var running []models.ActionHistory
+	if err := database.DB.Where("device_type = ? AND status = ?", devices.UV, models.ActionRunning).Find(&running).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switchOff := mode == service.OverrideForceOff || len(running) > 0
+	for _, action := range running {
+		if action.TriggerSource != "SCHEDULE" && mode != service.OverrideForceOff {
+			switchOff = false
+		}
+	}
+	if switchOff {
+		uv, _ := devices.Get(devices.UV)
+		if err := mqtt.PublishCommand(c.Request.Context(), uv, devices.Command{State: "OFF"}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send stop command to device"})
+			return
+		}
+	}
+
+	ended, err := service.SetOverride(c.Request.Context(), devices.UV, mode, until, "override "+mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	override := service.Override{Mode: mode, Until: until}
+	audit.Record(c, "device_override", devices.UV, before, override)
+
+	ids := make([]uint, 0, len(ended))
+	for _, action := range ended {
+		ids = append(ids, action.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "UV override set",
+		"override":      override,
+		"ended_actions": ids,
+	})
+}
+
+// ClearUVOverride removes the UV schedule override; schedules resume on the next check
+func ClearUVOverride(c *gin.Context) {
+	before, err := service.ActiveOverride(devices.UV)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active UV override"})
+		return
+	}
+
+	if err := service.ClearOverride(devices.UV); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(c, "device_override", devices.UV, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "UV override cleared"})
+}
+
+// holdSchedulesForManualRun sets a MANUAL override until the later of the
+// manual run's end and the current schedule window's end, ending running
+// schedule runs OVERRIDDEN. PAUSE and FORCE_OFF overrides are left alone.
+func holdSchedulesForManualRun(ctx context.Context, action *models.ActionHistory) error {
+	override, err := service.ActiveOverride(action.DeviceType)
+	if err != nil || (override != nil && override.Mode != service.OverrideManual) {
+		return err
+	}
+
+	until := *action.EndTime
+	end, ok, err := scheduler.WindowEnd(action.DeviceType, action.StartTime)
+	if err != nil {
+		return err
+	}
+	if ok && end.After(until) {
+		until = end
+	}
+	if override != nil && override.Until.After(until) {
+		until = override.Until
+	}
+	_, err = service.SetOverride(ctx, action.DeviceType, service.OverrideManual, until, "manual run")
+	return err
+}
+
+// holdSchedulesAfterStop keeps UV schedules off until the current window ends
+// once a user stopped UV, and drops a MANUAL override outside any window
+func holdSchedulesAfterStop(ctx context.Context) error {
+	override, err := service.ActiveOverride(devices.UV)
+	if err != nil || (override != nil && override.Mode != service.OverrideManual) {
+		return err
+	}
+
+	end, ok, err := scheduler.WindowEnd(devices.UV, time.Now())
+	if err != nil {
+		return err
+	}
+	if ok {
+		_, err = service.SetOverride(ctx, devices.UV, service.OverrideManual, end, "stopped by user")
+		return err
+	}
+	if override != nil {
+		return service.ClearOverride(devices.UV)
+	}
+	return nil
+}
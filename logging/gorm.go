@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SlowQueryThreshold is the duration after which a query is logged as slow
+const SlowQueryThreshold = 500 * time.Millisecond
+
+// gormLogger writes gorm logs through slog, using the request logger in ctx
+type gormLogger struct {
+	level logger.LogLevel
+}
+
+// GormLogger returns a gorm logger for DB_LOG_LEVEL (silent, error, warn or
+// info). warn logs slow queries and errors; info logs every query at DEBUG.
+func GormLogger(level string) logger.Interface {
+	return &gormLogger{level: parseGormLevel(level)}
+}
+
+func parseGormLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	}
+	return logger.Warn
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		FromContext(ctx).Info(msg, "component", "gorm", "args", args)
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		FromContext(ctx).Warn(msg, "component", "gorm", "args", args)
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		FromContext(ctx).Error(msg, "component", "gorm", "args", args)
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	log := FromContext(ctx)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		sql, rows := fc()
+		log.Error("query failed", "component", "gorm", "error", err, "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case elapsed > SlowQueryThreshold && l.level >= logger.Warn:
+		sql, rows := fc()
+		log.Warn("slow query", "component", "gorm", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		log.Debug("query", "component", "gorm", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+var _ logger.Interface = (*gormLogger)(nil)
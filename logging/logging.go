@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"iot-backend-cursor/config"
+)
+
+type (
+	loggerKey    struct{}
+	requestIDKey struct{}
+)
+
+// InitLogging installs the default slog logger from LOG_LEVEL and
+// LOG_FORMAT. Output of the standard log package goes through it at INFO.
+func InitLogging(cfg *config.Config) {
+	opts := &slog.HandlerOptions{Level: ParseLevel(cfg.LogLevel)}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.LogFormat, "text") {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	log.SetFlags(0) // slog adds the time
+}
+
+// ParseLevel converts debug, info, warn or error to a level (default info)
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// NewRequestID returns a random 16 character hex ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a context carrying id and a logger that adds request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return With(ctx, "request_id", id)
+}
+
+// NewContext starts a context for work that isn't triggered by an HTTP
+// request (scheduler jobs, MQTT messages); its request ID is prefixed with source
+func NewContext(source string) context.Context {
+	return WithRequestID(context.Background(), source+"-"+NewRequestID())
+}
+
+// RequestID returns the request ID carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// With returns a context whose logger adds args (key/value pairs) to every record
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
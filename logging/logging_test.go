@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"":        slog.LevelInfo,
+	}
+	for in, want := range cases {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	ctx := NewContext("scheduler")
+	if !strings.HasPrefix(RequestID(ctx), "scheduler-") {
+		t.Fatalf("request ID %q has no source prefix", RequestID(ctx))
+	}
+
+	FromContext(With(ctx, "action_id", 7)).Info("test")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["request_id"] != RequestID(ctx) || record["action_id"] != float64(7) {
+		t.Errorf("record = %v", record)
+	}
+
+	if RequestID(context.Background()) != "" {
+		t.Error("background context has a request ID")
+	}
+}
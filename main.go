@@ -1,51 +1,169 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"iot-backend-cursor/alerting"
+	"iot-backend-cursor/auth"
+	"iot-backend-cursor/commands"
 	"iot-backend-cursor/config"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/metrics"
+	"iot-backend-cursor/models"
 	"iot-backend-cursor/mqtt"
+	"iot-backend-cursor/notify"
+	"iot-backend-cursor/retention"
 	"iot-backend-cursor/routes"
+	"iot-backend-cursor/rules"
 	"iot-backend-cursor/scheduler"
+	"iot-backend-cursor/sensors"
 )
 
 // init sets the application timezone to Asia/Jakarta (WIB)
 func init() {
 	loc, err := time.LoadLocation("Asia/Jakarta")
 	if err != nil {
-		log.Printf("Warning: Failed to load Asia/Jakarta timezone: %v, using UTC", err)
+		slog.Warn("failed to load Asia/Jakarta timezone, using UTC", "error", err)
 		return
 	}
 	time.Local = loc
-	log.Println("✅ Timezone set to Asia/Jakarta (WIB)")
+	slog.Info("timezone set", "location", loc.String())
 }
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	// Structured logging (LOG_LEVEL, LOG_FORMAT)
+	logging.InitLogging(cfg)
+
+	// CLI subcommands (e.g. "migrate up") run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1:]))
+	}
+
 	// Initialize database
 	database.InitDB(cfg)
 
+	// Initialize Prometheus metrics
+	metrics.InitMetrics(cfg)
+
+	// Initialize authentication (token signing, bootstrap admin)
+	auth.InitAuth(cfg)
+
+	// Register device types (built-in and DEVICE_TYPES_FILE)
+	devices.InitDevices(cfg)
+
+	// Configure sensor timestamp validation
+	sensors.InitSensors(cfg)
+
 	// Initialize MQTT client (or mock if demo mode)
 	if cfg.DemoMode {
 		mqtt.InitMockMQTT()
-		log.Println("Running in DEMO MODE - No MQTT broker required")
+		slog.Info("running in demo mode, no MQTT broker required")
 	} else {
 		mqtt.InitMQTT(cfg)
 	}
 
+	// Initialize notification delivery
+	notify.InitNotifier(cfg)
+
+	// Initialize alert rule evaluation
+	alerting.InitAlerting()
+
+	// Initialize automation rules engine
+	rules.InitRules()
+
+	// Initialize data retention policies
+	retention.InitRetention(cfg)
+
 	// Initialize scheduler
 	scheduler.InitScheduler()
 
 	// Setup routes
-	r := routes.SetupRoutes()
+	r := routes.SetupRoutes(cfg)
+	srv := &http.Server{
+		Addr:    ":" + cfg.ServerPort,
+		Handler: r,
+	}
 
 	// Start server
-	log.Printf("Server starting on port %s", cfg.ServerPort)
-	if err := r.Run(":" + cfg.ServerPort); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		slog.Info("server starting", "port", cfg.ServerPort)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM (Ctrl+C, docker stop, Railway/k8s redeploy)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	shutdown(cfg, srv)
+}
+
+// shutdown stops components in dependency order: no new requests or jobs
+// first, then outstanding device commands and notifications, then the
+// MQTT connection and the database. Each step shares SHUTDOWN_TIMEOUT_SECONDS.
+func shutdown(cfg *config.Config, srv *http.Server) {
+	slog.Info("shutting down", "timeout_seconds", cfg.ShutdownTimeoutSeconds)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("HTTP server shutdown", "error", err)
+	}
+
+	if err := scheduler.Stop(ctx); err != nil {
+		slog.Error("scheduler shutdown: running jobs did not finish", "error", err)
+	}
+
+	if cfg.ShutdownUVOff {
+		turnOffUV(logging.WithRequestID(ctx, "shutdown"))
+	}
+
+	if err := notify.Shutdown(ctx); err != nil {
+		slog.Error("notifier shutdown: queued notifications not delivered", "error", err)
+	}
+
+	if err := mqtt.Shutdown(ctx); err != nil {
+		slog.Error("MQTT shutdown", "error", err)
+	}
+
+	if err := database.Close(); err != nil {
+		slog.Error("database close", "error", err)
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// turnOffUV sends a safety OFF command if the UV is on, since the scheduler
+// won't turn it off while the backend is down
+func turnOffUV(ctx context.Context) {
+	uv, ok := devices.Get(devices.UV)
+	if !ok {
+		return
+	}
+
+	var status models.DeviceStatus
+	if err := database.DB.Where("device_type = ?", uv.Name).First(&status).Error; err != nil || status.Status != "ON" {
+		return
+	}
+
+	if _, err := commands.TurnOff(ctx, uv, models.ActionStopped, "shutdown"); err != nil {
+		logging.FromContext(ctx).Error("UV safety OFF failed", "error", err)
+		return
 	}
+	logging.FromContext(ctx).Info("UV turned off for shutdown")
 }
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"log/slog"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	stockDesc = prometheus.NewDesc(namespace+"_stock_grams",
+		"Current food stock in grams.", nil, nil)
+	sensorDesc = prometheus.NewDesc(namespace+"_sensor_value",
+		"Latest good reading per metric and sensor.", []string{"metric", "sensor_id", "unit"}, nil)
+	sensorTimeDesc = prometheus.NewDesc(namespace+"_sensor_last_reading_timestamp_seconds",
+		"Time of the latest good reading per metric and sensor.", []string{"metric", "sensor_id"}, nil)
+	deviceOnlineDesc = prometheus.NewDesc(namespace+"_device_online",
+		"Whether the device reported within the online window.", []string{"device_type"}, nil)
+	deviceSeenDesc = prometheus.NewDesc(namespace+"_device_last_seen_timestamp_seconds",
+		"Time the device status was last updated.", []string{"device_type"}, nil)
+)
+
+// stateCollector reads current state from the database at scrape time
+type stateCollector struct {
+	onlineWindow time.Duration
+}
+
+func (sc *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stockDesc
+	ch <- sensorDesc
+	ch <- sensorTimeDesc
+	ch <- deviceOnlineDesc
+	ch <- deviceSeenDesc
+}
+
+func (sc *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	var stock models.Stock
+	if err := database.DB.First(&stock).Error; err == nil {
+		ch <- prometheus.MustNewConstMetric(stockDesc, prometheus.GaugeValue, float64(stock.AmountGram))
+	}
+
+	// Latest good reading per metric and sensor
+	var latest []models.SensorReading
+	err := database.DB.Raw(`SELECT r.* FROM sensor_readings r
+		JOIN (SELECT metric, sensor_id, MAX(recorded_at) AS recorded_at FROM sensor_readings WHERE quality = ? GROUP BY metric, sensor_id) m
+		ON r.metric = m.metric AND r.sensor_id = m.sensor_id AND r.recorded_at = m.recorded_at
+		WHERE r.quality = ?`, sensors.QualityGood, sensors.QualityGood).Scan(&latest).Error
+	if err != nil {
+		slog.Error("error collecting sensor metrics", "error", err)
+	}
+	seen := make(map[string]bool, len(latest))
+	for _, r := range latest {
+		// Two readings with the same timestamp would be a duplicate series
+		if key := r.Metric + "|" + r.SensorID; !seen[key] {
+			seen[key] = true
+			ch <- prometheus.MustNewConstMetric(sensorDesc, prometheus.GaugeValue, r.Value, r.Metric, r.SensorID, r.Unit)
+			ch <- prometheus.MustNewConstMetric(sensorTimeDesc, prometheus.GaugeValue, float64(r.RecordedAt.Unix()), r.Metric, r.SensorID)
+		}
+	}
+
+	var statuses []models.DeviceStatus
+	if err := database.DB.Find(&statuses).Error; err != nil {
+		slog.Error("error collecting device metrics", "error", err)
+		return
+	}
+	for _, s := range statuses {
+		online := 0.0
+		if !s.LastUpdated.IsZero() && time.Since(s.LastUpdated) <= sc.onlineWindow {
+			online = 1
+		}
+		ch <- prometheus.MustNewConstMetric(deviceOnlineDesc, prometheus.GaugeValue, online, s.DeviceType)
+		if !s.LastUpdated.IsZero() {
+			ch <- prometheus.MustNewConstMetric(deviceSeenDesc, prometheus.GaugeValue, float64(s.LastUpdated.Unix()), s.DeviceType)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "aquarium"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// MQTTReceived counts MQTT messages received per topic
+	MQTTReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_received_total",
+		Help:      "MQTT messages received per topic.",
+	}, []string{"topic"})
+
+	// MQTTPublished counts MQTT messages published per topic
+	MQTTPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_published_total",
+		Help:      "MQTT messages published successfully per topic.",
+	}, []string{"topic"})
+
+	// MQTTPublishFailures counts failed MQTT publishes per topic
+	MQTTPublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_publish_failures_total",
+		Help:      "MQTT publishes that failed per topic.",
+	}, []string{"topic"})
+
+	// MQTTConnected is 1 while the MQTT client is connected (always 1 in demo mode)
+	MQTTConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mqtt_connected",
+		Help:      "Whether the MQTT client is connected.",
+	})
+
+	schedulerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scheduler_job_duration_seconds",
+		Help:      "Duration of scheduler job runs.",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30, 120},
+	}, []string{"job"})
+
+	// SchedulesFired counts schedules that triggered a device
+	SchedulesFired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scheduler_schedules_fired_total",
+		Help:      "Schedules that triggered a device action.",
+	}, []string{"device_type"})
+
+	// SchedulesSkipped counts due schedules that did not trigger, by reason
+	SchedulesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scheduler_schedules_skipped_total",
+		Help:      "Due schedules that were skipped, by reason.",
+	}, []string{"device_type", "reason"})
+
+	actionOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_finished_total",
+		Help:      "Device actions that reached a final status.",
+	}, []string{"device_type", "status"})
+)
+
+// InitMetrics registers the state collector and counts action outcomes from the event bus
+func InitMetrics(cfg *config.Config) {
+	prometheus.MustRegister(&stateCollector{onlineWindow: time.Duration(cfg.DeviceOnlineMinutes) * time.Minute})
+
+	events.Subscribe(events.ActionFinished, func(e events.Event) {
+		if action, ok := e.Subject.(*models.ActionHistory); ok {
+			actionOutcomes.WithLabelValues(action.DeviceType, string(action.Status)).Inc()
+		}
+	})
+}
+
+// Middleware records request count and latency per route template (e.g. /api/v1/devices/:id)
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Job wraps a scheduler job so its run time is recorded under name
+func Job(name string, job func()) func() {
+	return func() {
+		start := time.Now()
+		defer func() {
+			schedulerDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		}()
+		job()
+	}
+}
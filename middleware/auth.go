@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"iot-backend-cursor/auth"
+	"iot-backend-cursor/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys set by RequireAuth
+const (
+	ContextUser       = "auth_user"
+	ContextAPIKey     = "auth_api_key"
+	ContextAuthMethod = "auth_method"
+)
+
+// Authentication methods stored under ContextAuthMethod
+const (
+	AuthMethodToken  = "token"
+	AuthMethodAPIKey = "api_key"
+)
+
+// RequireAuth rejects requests without a valid session token or API key.
+// Credentials are read from "Authorization: Bearer <token|key>" or "X-API-Key".
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := c.GetHeader("X-API-Key")
+		if credential == "" {
+			header := c.GetHeader("Authorization")
+			if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+				credential = strings.TrimSpace(header[7:])
+			}
+		}
+
+		if credential == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if strings.HasPrefix(credential, auth.APIKeyPrefix) {
+			user, key, err := auth.ParseAPIKey(credential)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(ContextUser, user)
+			c.Set(ContextAPIKey, key)
+			c.Set(ContextAuthMethod, AuthMethodAPIKey)
+			c.Next()
+			return
+		}
+
+		user, err := auth.ParseToken(credential)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ContextUser, user)
+		c.Set(ContextAuthMethod, AuthMethodToken)
+		c.Next()
+	}
+}
+
+// CurrentUser returns the authenticated user, or nil for anonymous requests
+func CurrentUser(c *gin.Context) *models.User {
+	if value, ok := c.Get(ContextUser); ok {
+		if user, ok := value.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// RequirePermission rejects authenticated requests whose role lacks perm.
+// Must be registered after RequireAuth.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if !auth.HasPermission(user, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "Permission denied",
+				"permission": perm,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+// ActionStatus is the lifecycle state of an ActionHistory
+type ActionStatus string
+
+const (
+	ActionPending    ActionStatus = "PENDING"    // recorded, command not sent yet
+	ActionRunning    ActionStatus = "RUNNING"    // command sent, device working
+	ActionSuccess    ActionStatus = "SUCCESS"    // device reported success or the run ended on time
+	ActionFailed     ActionStatus = "FAILED"     // command could not be sent or the device reported failure
+	ActionStopped    ActionStatus = "STOPPED"    // stopped early by a user, rule or shutdown
+	ActionOverridden ActionStatus = "OVERRIDDEN" // ended because a manual override took priority
+)
+
+// actionTransitions lists the statuses each status may change to. The empty
+// status is a new action; terminal statuses have no entry.
+var actionTransitions = map[ActionStatus][]ActionStatus{
+	"":            {ActionPending, ActionRunning},
+	ActionPending: {ActionRunning, ActionSuccess, ActionFailed, ActionStopped, ActionOverridden},
+	ActionRunning: {ActionSuccess, ActionFailed, ActionStopped, ActionOverridden},
+}
+
+// ActiveActionStatuses are the statuses of actions that have not ended
+var ActiveActionStatuses = []ActionStatus{ActionPending, ActionRunning}
+
+// CanTransitionTo reports whether an action in status s may change to next
+func (s ActionStatus) CanTransitionTo(next ActionStatus) bool {
+	for _, allowed := range actionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether the action has ended
+func (s ActionStatus) IsTerminal() bool {
+	return s != "" && len(actionTransitions[s]) == 0
+}
@@ -6,42 +6,56 @@ import (
 	"gorm.io/gorm"
 )
 
-// PakanSchedule represents the feeding schedule
+// PakanSchedule represents the feeding schedule (or any dose device)
 type PakanSchedule struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
-	DayName    string    `json:"day_name" gorm:"not null"` // Mon, Tue, Wed, Thu, Fri, Sat, Sun
-	Time       string    `json:"time" gorm:"not null"`     // HH:MM format
+	DeviceType string    `json:"device_type" gorm:"not null;default:FEEDER;index"` // dose device
+	DayName    string    `json:"day_name" gorm:"not null"`                         // Mon, Tue, Wed, Thu, Fri, Sat, Sun
+	Time       string    `json:"time" gorm:"not null"`                             // HH:MM format
 	AmountGram int       `json:"amount_gram" gorm:"default:10"`
 	IsActive   bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
-// UVSchedule represents the UV sterilizer schedule
+// UVSchedule represents the UV sterilizer schedule (or any on/off device)
 type UVSchedule struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	DayName   string    `json:"day_name" gorm:"not null"`   // Mon, Tue, Wed, Thu, Fri, Sat, Sun
-	StartTime string    `json:"start_time" gorm:"not null"` // HH:MM format
-	EndTime   string    `json:"end_time" gorm:"not null"`   // HH:MM format
-	IsActive  bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	DeviceType string    `json:"device_type" gorm:"not null;default:UV;index"` // on/off device
+	DayName    string    `json:"day_name" gorm:"not null"`                     // Mon, Tue, Wed, Thu, Fri, Sat, Sun
+	StartTime  string    `json:"start_time" gorm:"not null"`                   // HH:MM format
+	EndTime    string    `json:"end_time" gorm:"not null"`                     // HH:MM format
+	IsActive   bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 // ActionHistory represents the log of all actions
 type ActionHistory struct {
 	ID            uint           `json:"id" gorm:"primaryKey"`
-	DeviceType    string         `json:"device_type" gorm:"not null"`    // FEEDER, UV
-	TriggerSource string         `json:"trigger_source" gorm:"not null"` // SCHEDULE, MANUAL
+	DeviceType    string         `json:"device_type" gorm:"not null"`    // FEEDER, UV, HEATER, AIR_PUMP, LED, ...
+	TriggerSource string         `json:"trigger_source" gorm:"not null"` // SCHEDULE, MANUAL, AUTOMATION
 	StartTime     time.Time      `json:"start_time" gorm:"not null"`
 	EndTime       *time.Time     `json:"end_time"`                               // nullable
-	Status        string         `json:"status" gorm:"not null;default:PENDING"` // PENDING, RUNNING, SUCCESS, FAILED, OVERRIDDEN
+	Status        ActionStatus   `json:"status" gorm:"not null;default:PENDING"` // see ActionStatus; changed only through the service package
 	Value         int            `json:"value"`                                  // grams for feeder, seconds for UV
+	RequestID     string         `json:"request_id,omitempty"`                   // HTTP request or job that created the action, for log correlation
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// ActionEvent records one status transition of an action, forming its timeline
+type ActionEvent struct {
+	ID         uint         `json:"id" gorm:"primaryKey"`
+	ActionID   uint         `json:"action_id" gorm:"not null;index"`
+	FromStatus ActionStatus `json:"from_status"` // empty when the action was created
+	ToStatus   ActionStatus `json:"to_status" gorm:"not null"`
+	Reason     string       `json:"reason,omitempty"`     // why the status changed
+	RequestID  string       `json:"request_id,omitempty"` // HTTP request or job that caused the change
+	At         time.Time    `json:"at" gorm:"not null"`
+}
+
 // Stock represents the food stock
 type Stock struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
@@ -52,16 +66,194 @@ type Stock struct {
 // DeviceStatus represents current device status
 type DeviceStatus struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	DeviceType  string    `json:"device_type" gorm:"uniqueIndex;not null"` // FEEDER, UV
+	DeviceType  string    `json:"device_type" gorm:"uniqueIndex;not null"` // registered device type
 	Status      string    `json:"status"`                                  // IDLE, DISPENSING, ON, OFF
-	Remaining   int       `json:"remaining"`                               // remaining seconds for UV
+	Remaining   int       `json:"remaining"`                               // remaining seconds for on/off devices
 	LastUpdated time.Time `json:"last_updated"`
+
+	// Schedule override of on/off devices (MANUAL, PAUSE, FORCE_OFF), see
+	// service.SetOverride. Kept after expiry, so only service.ActiveOverride is reported.
+	OverrideMode  string     `json:"-"`
+	OverrideUntil *time.Time `json:"-"`
 }
 
 // SensorLog represents temperature and humidity readings
 type SensorLog struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	Temperature float64   `json:"temperature" gorm:"not null"` // Temperature in Celsius
-	Humidity    float64   `json:"humidity"`                    // Humidity in percentage (optional)
-	RecordedAt  time.Time `json:"recorded_at" gorm:"index;not null"`
+	Temperature float64   `json:"temperature" gorm:"not null"`       // Temperature in Celsius
+	Humidity    float64   `json:"humidity"`                          // Humidity in percentage (optional)
+	RecordedAt  time.Time `json:"recorded_at" gorm:"index;not null"` // device time when valid, otherwise server time
+	ReceivedAt  time.Time `json:"received_at"`                       // server time the message arrived
+}
+
+// SensorReading is a single value of any metric (pH, TDS, water level, ...) from a sensor
+type SensorReading struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SensorID   string    `json:"sensor_id" gorm:"index;not null"`                                         // dht22, ph, ds18b20 probe address, ...
+	Metric     string    `json:"metric" gorm:"not null;index:idx_sensor_readings_metric_time,priority:1"` // temperature, humidity, ph, tds, water_temperature, water_level
+	Unit       string    `json:"unit"`
+	Value      float64   `json:"value"`                                                                        // calibrated value
+	RawValue   float64   `json:"raw_value"`                                                                    // value as received from the sensor
+	Quality    string    `json:"quality" gorm:"not null;default:GOOD"`                                         // GOOD, OUT_OF_RANGE, SPIKE
+	RecordedAt time.Time `json:"recorded_at" gorm:"not null;index:idx_sensor_readings_metric_time,priority:2"` // device time when valid, otherwise server time
+	ReceivedAt time.Time `json:"received_at"`                                                                  // server time the message arrived
+}
+
+// SensorCalibration corrects readings of one sensor: value = raw * scale + offset
+type SensorCalibration struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SensorID  string    `json:"sensor_id" gorm:"not null;uniqueIndex:idx_sensor_calibrations_sensor_metric"`
+	Metric    string    `json:"metric" gorm:"not null;uniqueIndex:idx_sensor_calibrations_sensor_metric"`
+	Offset    float64   `json:"offset"`
+	Scale     float64   `json:"scale" gorm:"default:1"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SensorRollup holds per-bucket statistics of a metric, kept longer than raw readings
+type SensorRollup struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Metric      string    `json:"metric" gorm:"not null;uniqueIndex:idx_sensor_rollups_bucket,priority:1"`
+	Bucket      string    `json:"bucket" gorm:"not null;uniqueIndex:idx_sensor_rollups_bucket,priority:2"` // 1h, 1d
+	BucketStart time.Time `json:"bucket_start" gorm:"not null;uniqueIndex:idx_sensor_rollups_bucket,priority:3"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	Count       int64     `json:"count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// User represents an account that can log in to the REST API
+type User struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Username     string     `json:"username" gorm:"uniqueIndex;not null"`
+	PasswordHash string     `json:"-" gorm:"not null"`
+	Role         string     `json:"role" gorm:"not null;default:viewer"` // owner, caretaker, viewer or a custom role
+	IsActive     bool       `json:"is_active" gorm:"default:true"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// APIKey represents a long-lived key for integrations, acting on behalf of a user
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`        // first characters of the key, for identification
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"` // SHA-256 of the full key
+	ExpiresAt  *time.Time `json:"expires_at"`                    // nullable, never expires if empty
+	LastUsedAt *time.Time `json:"last_used_at"`                  // nullable
+	RevokedAt  *time.Time `json:"revoked_at"`                    // nullable
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Role groups permissions that can be granted to users
+type Role struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description"`
+	Permissions string    `json:"permissions"` // comma-separated, e.g. "schedule:write,device:control"
+	IsBuiltin   bool      `json:"is_builtin" gorm:"default:false"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AuditLog records a mutating API request: who made it, what changed and from where
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     *uint     `json:"user_id" gorm:"index"` // nullable for unauthenticated requests
+	Username   string    `json:"username"`
+	AuthMethod string    `json:"auth_method"`              // token, api_key
+	Method     string    `json:"method" gorm:"not null"`   // POST, PUT, DELETE
+	Endpoint   string    `json:"endpoint" gorm:"not null"` // route pattern, e.g. /api/v1/feeder/schedules/:id
+	Path       string    `json:"path"`                     // requested path
+	EntityType string    `json:"entity_type" gorm:"index"` // feeder_schedule, uv_schedule, stock, ...
+	EntityID   string    `json:"entity_id"`
+	Before     string    `json:"before"` // JSON snapshot before the change
+	After      string    `json:"after"`  // JSON snapshot after the change
+	Diff       string    `json:"diff"`   // JSON object of changed fields {"field": {"from": x, "to": y}}
+	ClientIP   string    `json:"client_ip"`
+	StatusCode int       `json:"status_code"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// AlertRule defines when an alert fires for a sensor metric
+type AlertRule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Name          string    `json:"name" gorm:"not null"`
+	Metric        string    `json:"metric" gorm:"not null"`          // temperature, humidity
+	Type          string    `json:"type" gorm:"not null"`            // THRESHOLD, RATE_OF_CHANGE, STALE
+	Operator      string    `json:"operator"`                        // GT, LT (THRESHOLD and RATE_OF_CHANGE)
+	Threshold     float64   `json:"threshold"`                       // value limit, or change within window for RATE_OF_CHANGE
+	Hysteresis    float64   `json:"hysteresis"`                      // margin past the threshold required to resolve
+	WindowMinutes int       `json:"window_minutes"`                  // RATE_OF_CHANGE look-back window
+	StaleMinutes  int       `json:"stale_minutes"`                   // STALE: fire when no reading for this long
+	Severity      string    `json:"severity" gorm:"default:WARNING"` // INFO, WARNING, CRITICAL
+	IsActive      bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Alert is one occurrence of an alert rule, from firing until resolved
+type Alert struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	RuleID         uint       `json:"rule_id" gorm:"index;not null"`
+	RuleName       string     `json:"rule_name"`
+	Metric         string     `json:"metric"`
+	Severity       string     `json:"severity"`
+	Status         string     `json:"status" gorm:"index;not null"` // FIRING, ACKNOWLEDGED, RESOLVED
+	Value          float64    `json:"value"`                        // latest value that breached the rule
+	Message        string     `json:"message"`
+	Occurrences    int        `json:"occurrences" gorm:"default:1"` // breaching evaluations deduplicated into this alert
+	FiredAt        time.Time  `json:"fired_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"` // nullable
+	AcknowledgedBy string     `json:"acknowledged_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"` // nullable
+}
+
+// NotificationChannel is a configured destination for notifications
+type NotificationChannel struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Name             string    `json:"name" gorm:"not null"`
+	Type             string    `json:"type" gorm:"not null"` // webhook, email, telegram
+	Config           string    `json:"config"`               // JSON settings for the channel type
+	EventTypes       string    `json:"event_types"`          // comma-separated, e.g. "alert.firing,stock.low", "*" for all
+	RateLimitSeconds int       `json:"rate_limit_seconds"`   // minimum interval between notifications of the same event type
+	IsActive         bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// NotificationDelivery logs one attempt to notify a channel about an event
+type NotificationDelivery struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ChannelID   uint       `json:"channel_id" gorm:"index;not null"`
+	ChannelName string     `json:"channel_name"`
+	EventType   string     `json:"event_type" gorm:"index"`
+	Title       string     `json:"title"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status" gorm:"not null"` // PENDING, SENT, FAILED, RATE_LIMITED
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error"`
+	SentAt      *time.Time `json:"sent_at"` // nullable
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+}
+
+// AutomationRule is an if-this-then-that rule: when the trigger fires and all
+// conditions hold, the actions are executed
+type AutomationRule struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Name            string     `json:"name" gorm:"not null"`
+	TriggerType     string     `json:"trigger_type" gorm:"not null"` // SENSOR, ACTION_STATUS, DEVICE_OFFLINE, TIME
+	Trigger         string     `json:"trigger"`                      // JSON trigger settings
+	Conditions      string     `json:"conditions"`                   // JSON array of conditions
+	Actions         string     `json:"actions" gorm:"not null"`      // JSON array of actions
+	CooldownSeconds int        `json:"cooldown_seconds"`             // minimum seconds between firings
+	IsActive        bool       `json:"is_active" gorm:"default:true"`
+	LastFiredAt     *time.Time `json:"last_fired_at"` // nullable
+	LastResult      string     `json:"last_result"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
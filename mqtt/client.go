@@ -1,58 +1,54 @@
 package mqtt
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 
 	"iot-backend-cursor/config"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/metrics"
 	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+	"iot-backend-cursor/service"
+	"iot-backend-cursor/utils"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var Client mqtt.Client
 
-type FeederCommand struct {
-	Action string `json:"action"` // FEED
-	Dose   int    `json:"dose"`   // number of doses
-}
-
-type UVCommand struct {
-	State       string `json:"state"`        // ON, OFF
-	DurationSec int    `json:"duration_sec"` // duration in seconds (0 for schedule)
-}
-
-type FeederStatus struct {
-	Status string `json:"status"` // IDLE, DISPENSING
-}
-
-type UVStatus struct {
-	State     string `json:"state"`     // ON, OFF
-	Remaining int    `json:"remaining"` // remaining seconds
-}
-
 type DeviceReport struct {
 	Result   string `json:"result"`    // SUCCESS, FAILED
-	Type     string `json:"type"`      // FEED, UV
+	Type     string `json:"type"`      // report type of the device (FEED, UV) or device name
 	FeedGram int    `json:"feed_gram"` // grams of food (for FEED type)
 }
 
 type SensorData struct {
-	Temperature float64 `json:"temp"`     // Temperature in Celsius
-	Humidity    float64 `json:"hum"`      // Humidity in percentage
-	RTCTime     string  `json:"rtc_time"` // RTC time (for monitoring, optional)
+	Temperature *float64 `json:"temp"`     // Temperature in Celsius; null when the DHT read failed
+	Humidity    *float64 `json:"hum"`      // Humidity in percentage; null when the DHT read failed
+	RTCTime     string   `json:"rtc_time"` // RTC time of day, used when a buffered reading has no timestamp (optional)
+
+	// Device timestamp: epoch seconds/milliseconds or ISO 8601 (optional)
+	Timestamp interface{} `json:"timestamp"`
 }
 
 func InitMQTT(cfg *config.Config) {
-	brokerURL := cfg.GetMQTTBrokerURL()
-	log.Printf("🔌 Connecting to MQTT broker: %s (Client ID: %s)", brokerURL, cfg.MQTTClientID)
+	url := cfg.GetMQTTBrokerURL()
+	diagMu.Lock()
+	brokerURL = url
+	diagMu.Unlock()
+	slog.Info("connecting to MQTT broker", "broker", url, "client_id", cfg.MQTTClientID)
 
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
+	opts.AddBroker(url)
 	opts.SetClientID(cfg.MQTTClientID)
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetDefaultPublishHandler(messageHandler)
@@ -60,17 +56,21 @@ func InitMQTT(cfg *config.Config) {
 	opts.SetAutoReconnect(true)
 	opts.SetConnectRetry(true)
 	opts.SetConnectRetryInterval(5 * time.Second)
+	opts.SetOnConnectHandler(func(mqtt.Client) { metrics.MQTTConnected.Set(1) })
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		metrics.MQTTConnected.Set(0)
+		slog.Error("MQTT connection lost", "error", err)
+	})
 
 	// Set username and password if provided
 	if cfg.MQTTUser != "" {
 		opts.SetUsername(cfg.MQTTUser)
-		log.Printf("🔐 MQTT User: %s", cfg.MQTTUser)
+		slog.Info("MQTT credentials set", "user", cfg.MQTTUser, "password_set", cfg.MQTTPass != "")
 		if cfg.MQTTPass != "" {
 			opts.SetPassword(cfg.MQTTPass)
-			log.Printf("🔑 MQTT Password: [SET]")
 		}
 	} else {
-		log.Println("⚠️  MQTT User not set!")
+		slog.Warn("MQTT user not set")
 	}
 
 	// Configure TLS for secure connections (port 8883)
@@ -79,226 +79,339 @@ func InitMQTT(cfg *config.Config) {
 			InsecureSkipVerify: true, // Skip certificate verification (like ESP32)
 		}
 		opts.SetTLSConfig(tlsConfig)
-		log.Println("🔒 MQTT TLS enabled for secure connection")
+		slog.Info("MQTT TLS enabled")
 	}
 
 	Client = mqtt.NewClient(opts)
 
-	log.Println("⏳ Connecting to MQTT broker...")
 	if token := Client.Connect(); token.Wait() && token.Error() != nil {
-		log.Printf("❌ Failed to connect to MQTT broker: %v", token.Error())
-		log.Fatal("MQTT connection failed")
+		slog.Error("failed to connect to MQTT broker", "error", token.Error())
+		os.Exit(1)
 	}
 
-	log.Println("✅ Connected to MQTT broker successfully!")
+	slog.Info("connected to MQTT broker")
 
 	// Subscribe to status topics
 	subscribeToTopics()
 }
 
+// Shutdown waits for simulated device tasks in mock mode, or disconnects from
+// the broker after giving in-flight publishes time to complete
+func Shutdown(ctx context.Context) error {
+	if MockMode {
+		close(mockStop)
+		done := make(chan struct{})
+		go func() {
+			mockWG.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else if Client != nil && Client.IsConnected() {
+		Client.Disconnect(250)
+	}
+
+	metrics.MQTTConnected.Set(0)
+	return nil
+}
+
 func subscribeToTopics() {
-	log.Println("📡 Subscribing to MQTT topics...")
 	topics := []string{
-		"aquarium/feeder/status",
-		"aquarium/uv/status",
 		"aquarium/device/report",
-		"aquarium/sensor/dht",
+	}
+
+	// Sensor topics (DHT, pH, TDS, water temperature, water level)
+	topics = append(topics, sensors.Topics()...)
+
+	// Status topics of all registered device types
+	for _, t := range devices.All() {
+		if t.StatusTopic != "" {
+			topics = append(topics, t.StatusTopic)
+		}
 	}
 
 	for _, topic := range topics {
 		if token := Client.Subscribe(topic, 0, messageHandler); token.Wait() && token.Error() != nil {
-			log.Printf("❌ Failed to subscribe to %s: %v", topic, token.Error())
+			slog.Error("failed to subscribe to MQTT topic", "topic", topic, "error", token.Error())
 		} else {
-			log.Printf("✅ Subscribed to topic: %s", topic)
+			slog.Info("subscribed to MQTT topic", "topic", topic)
+			recordSubscription(topic)
 		}
 	}
-	log.Println("📡 All MQTT subscriptions completed!")
 }
 
 func messageHandler(client mqtt.Client, msg mqtt.Message) {
 	topic := msg.Topic()
 	payload := msg.Payload()
 
-	log.Printf("Received message on topic %s: %s", topic, string(payload))
+	// Every message gets its own ID so the logs of one message can be grouped
+	ctx := logging.With(logging.NewContext("mqtt"), "topic", topic)
+	logging.FromContext(ctx).Debug("MQTT message received", "payload", string(payload))
+	metrics.MQTTReceived.WithLabelValues(topic).Inc()
+	recordMessage(topic, payload)
 
 	switch topic {
-	case "aquarium/feeder/status":
-		handleFeederStatus(payload)
-	case "aquarium/uv/status":
-		handleUVStatus(payload)
 	case "aquarium/device/report":
-		handleDeviceReport(payload)
+		handleDeviceReport(ctx, payload)
 	case "aquarium/sensor/dht":
-		handleSensorData(payload)
+		handleSensorData(ctx, payload)
+	default:
+		if deviceType, ok := devices.ByStatusTopic(topic); ok {
+			if deviceType.Name == devices.UV {
+				handleUVStatus(ctx, deviceType, payload)
+			} else {
+				handleDeviceStatus(ctx, deviceType, payload)
+			}
+		} else if len(sensors.ByTopic(topic)) > 0 {
+			handleMetricData(ctx, topic, payload)
+		}
 	}
 }
 
-func handleFeederStatus(payload []byte) {
-	var status FeederStatus
-	if err := json.Unmarshal(payload, &status); err != nil {
-		log.Printf("Error parsing feeder status: %v", err)
+func handleUVStatus(ctx context.Context, deviceType *devices.Type, payload []byte) {
+	state, remaining, err := deviceType.ParseStatus(payload)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error parsing UV status", "error", err)
 		return
 	}
 
-	// Update device status in database
-	var deviceStatus models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "FEEDER").First(&deviceStatus).Error; err != nil {
-		log.Printf("Error finding feeder status: %v", err)
-		return
-	}
+	logging.FromContext(ctx).Info("UV status received", "state", state, "remaining", remaining)
 
-	deviceStatus.Status = status.Status
-	deviceStatus.LastUpdated = time.Now()
-	database.DB.Save(&deviceStatus)
+	// Note: We don't update database here anymore to avoid conflict with scheduler
+	// Backend scheduler is the source of truth for UV state
+	// This is just for monitoring/logging purposes
 }
 
-func handleUVStatus(payload []byte) {
-	var status UVStatus
-	if err := json.Unmarshal(payload, &status); err != nil {
-		log.Printf("Error parsing UV status: %v", err)
+// handleDeviceStatus stores the status reported by a device type
+func handleDeviceStatus(ctx context.Context, deviceType *devices.Type, payload []byte) {
+	state, remaining, err := deviceType.ParseStatus(payload)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error parsing device status", "device_type", deviceType.Name, "error", err)
 		return
 	}
 
-	log.Printf("[UV Status] Received from ESP: state=%s, remaining=%d", status.State, status.Remaining)
-
-	// Note: We don't update database here anymore to avoid conflict with scheduler
-	// Backend scheduler is the source of truth for UV state
-	// This is just for monitoring/logging purposes
+	if err := service.SetDeviceStatus(deviceType.Name, state, remaining); err != nil {
+		logging.FromContext(ctx).Error("error updating device status", "device_type", deviceType.Name, "error", err)
+	}
 }
 
-func handleDeviceReport(payload []byte) {
+func handleDeviceReport(ctx context.Context, payload []byte) {
 	var report DeviceReport
 	if err := json.Unmarshal(payload, &report); err != nil {
-		log.Printf("Error parsing device report: %v", err)
+		logging.FromContext(ctx).Warn("error parsing device report", "error", err)
+		return
+	}
+
+	// Reports use their own type names (FEED for the feeder)
+	deviceType, ok := devices.ByReportType(report.Type)
+	if !ok {
+		logging.FromContext(ctx).Warn("unknown device report type", "type", report.Type)
 		return
 	}
 
 	// Find the latest pending/running action for this device type
 	var action models.ActionHistory
-	query := database.DB.Where("device_type = ? AND status IN ?", report.Type, []string{"PENDING", "RUNNING"}).
+	query := database.DB.Where("device_type = ? AND status IN ?", deviceType.Name, models.ActiveActionStatuses).
 		Order("created_at DESC").
 		First(&action)
 
 	if query.Error != nil {
-		log.Printf("Error finding action history: %v", query.Error)
+		logging.FromContext(ctx).Warn("no pending action for device report", "device_type", deviceType.Name, "error", query.Error)
 		return
 	}
 
-	// Update action history
-	now := time.Now()
-	action.EndTime = &now
+	// origin_request_id links the report to the request or job that created the action
+	ctx = logging.With(ctx, "action_id", action.ID, "device_type", action.DeviceType, "origin_request_id", action.RequestID)
 
+	// Finish the action and take the fed amount from stock in one transaction
+	status := models.ActionFailed
+	fedGram := 0
 	if report.Result == "SUCCESS" {
-		action.Status = "SUCCESS"
-		if report.Type == "FEED" {
-			// Update stock
-			var stock models.Stock
-			if err := database.DB.First(&stock).Error; err == nil {
-				stock.AmountGram -= report.FeedGram
-				if stock.AmountGram < 0 {
-					stock.AmountGram = 0
-				}
-				database.DB.Save(&stock)
-			}
+		status = models.ActionSuccess
+		if deviceType.HasCapability(devices.CapStock) {
+			fedGram = report.FeedGram
 		}
-	} else {
-		action.Status = "FAILED"
 	}
 
-	database.DB.Save(&action)
-	log.Printf("Updated action history: ID=%d, Status=%s", action.ID, action.Status)
+	if err := service.FinishAction(ctx, &action, status, "device reported "+report.Result, fedGram); err != nil {
+		logging.FromContext(ctx).Warn("error finishing action from device report", "result", report.Result, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("device report processed", "result", report.Result, "status", action.Status, "feed_gram", report.FeedGram)
+}
+
+func handleSensorData(ctx context.Context, payload []byte) {
+	items, err := splitBatch(payload)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error parsing sensor data", "error", err)
+		return
+	}
+
+	receivedAt := time.Now()
+	for _, item := range items {
+		var data SensorData
+		if err := json.Unmarshal(item, &data); err != nil {
+			logging.FromContext(ctx).Warn("error parsing sensor data", "error", err)
+			continue
+		}
+		saveSensorData(ctx, data, receivedAt)
+	}
 }
 
-func handleSensorData(payload []byte) {
-	var data SensorData
-	if err := json.Unmarshal(payload, &data); err != nil {
-		log.Printf("Error parsing sensor data: %v", err)
+// saveSensorData stores one DHT reading as generic readings and in the legacy sensor log
+func saveSensorData(ctx context.Context, data SensorData, receivedAt time.Time) {
+	at := sensors.DeviceTime(data.Timestamp, data.RTCTime, receivedAt)
+	temperature, tempErr := ingestDHT(sensors.Temperature, data.Temperature, at, receivedAt)
+	humidity, humErr := ingestDHT(sensors.Humidity, data.Humidity, at, receivedAt)
+	if tempErr != nil || humErr != nil {
+		logging.FromContext(ctx).Warn("dropped sensor data", "temperature_error", tempErr, "humidity_error", humErr)
+	}
+
+	// The legacy DHT log only keeps pairs where both readings are good
+	if temperature == nil || humidity == nil ||
+		temperature.Quality != sensors.QualityGood || humidity.Quality != sensors.QualityGood {
 		return
 	}
 
-	// Save sensor data to database
 	sensorLog := models.SensorLog{
-		Temperature: data.Temperature,
-		Humidity:    data.Humidity,
-		RecordedAt:  time.Now(),
+		Temperature: temperature.Value,
+		Humidity:    humidity.Value,
+		RecordedAt:  at,
+		ReceivedAt:  receivedAt,
 	}
 
 	if err := database.DB.Create(&sensorLog).Error; err != nil {
-		log.Printf("Error saving sensor data: %v", err)
+		logging.FromContext(ctx).Error("error saving sensor data", "error", err)
 		return
 	}
 
-	log.Printf("Saved sensor data: Temp=%.2f°C, Humidity=%.2f%%", data.Temperature, data.Humidity)
+	logging.FromContext(ctx).Debug("saved sensor data",
+		"temperature", sensorLog.Temperature, "humidity", sensorLog.Humidity, "recorded_at", sensorLog.RecordedAt)
 }
 
-func PublishFeederCommand(dose int) error {
-	if MockMode {
-		log.Println("⚠️  MOCK MODE: Simulating feeder command")
-		return MockPublishFeederCommand(dose)
-	}
-
-	command := FeederCommand{
-		Action: "FEED",
-		Dose:   dose,
+// ingestDHT ingests one DHT value. The firmware publishes a failed read as
+// NaN, which arrives as null; null and missing values are rejected.
+func ingestDHT(metric string, value *float64, at, receivedAt time.Time) (*models.SensorReading, error) {
+	if value == nil {
+		return nil, sensors.ErrInvalidValue
 	}
+	return sensors.Ingest(sensors.Sample{Metric: metric, Value: *value, At: at, ReceivedAt: receivedAt})
+}
 
-	payload, err := json.Marshal(command)
+// handleMetricData stores readings from a sensor topic, e.g. {"ph": 7.1} on
+// aquarium/sensor/ph or {"sensor_id": "28-0316", "temp": 26.4} on aquarium/sensor/water_temp
+func handleMetricData(ctx context.Context, topic string, payload []byte) {
+	items, err := splitBatch(payload)
 	if err != nil {
-		log.Printf("❌ Error marshaling feeder command: %v", err)
-		return err
+		logging.FromContext(ctx).Warn("error parsing sensor data", "error", err)
+		return
 	}
 
-	log.Printf("📤 Publishing to aquarium/feeder/command: %s", string(payload))
+	receivedAt := time.Now()
+	for _, item := range items {
+		var data map[string]interface{}
+		if err := json.Unmarshal(item, &data); err != nil {
+			logging.FromContext(ctx).Warn("error parsing sensor data", "error", err)
+			continue
+		}
 
-	if Client == nil || !Client.IsConnected() {
-		log.Println("❌ MQTT Client not connected!")
-		return fmt.Errorf("MQTT client not connected")
-	}
+		sensorID, _ := data["sensor_id"].(string)
+		rtcTime, _ := data["rtc_time"].(string)
+		at := sensors.DeviceTime(data["timestamp"], rtcTime, receivedAt)
 
-	token := Client.Publish("aquarium/feeder/command", 0, false, payload)
-	token.Wait()
+		for _, metric := range sensors.ByTopic(topic) {
+			value, ok := data[metric.Key].(float64)
+			if !ok {
+				logging.FromContext(ctx).Warn("missing metric in sensor data", "key", metric.Key)
+				continue
+			}
+
+			reading, err := sensors.Ingest(sensors.Sample{SensorID: sensorID, Metric: metric.Name, Value: value, At: at, ReceivedAt: receivedAt})
+			if err != nil {
+				logging.FromContext(ctx).Warn("dropped sensor reading", "metric", metric.Name, "error", err)
+				continue
+			}
+			logging.FromContext(ctx).Debug("saved sensor reading", "metric", metric.Name, "value", reading.Value, "unit", metric.Unit, "quality", reading.Quality)
+		}
+	}
+}
 
-	if token.Error() != nil {
-		log.Printf("❌ Failed to publish feeder command: %v", token.Error())
-		return token.Error()
+// splitBatch returns the readings in a sensor payload, which is either a
+// single object, an array of objects or {"readings": [...]} (e.g. a device
+// flushing readings buffered while offline)
+func splitBatch(payload []byte) ([]json.RawMessage, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) > 0 && payload[0] == '[' {
+		var items []json.RawMessage
+		err := json.Unmarshal(payload, &items)
+		return items, err
 	}
 
-	log.Printf("✅ Published feeder command: dose=%d", dose)
-	return nil
+	var batch struct {
+		Readings []json.RawMessage `json:"readings"`
+	}
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		return nil, err
+	}
+	if batch.Readings != nil {
+		return batch.Readings, nil
+	}
+	return []json.RawMessage{payload}, nil
 }
 
-func PublishUVCommand(state string, durationSec int) error {
-	if MockMode {
-		log.Println("⚠️  MOCK MODE: Simulating UV command")
-		return MockPublishUVCommand(state, durationSec)
+// PublishCommand sends a command to a registered device type on its command
+// topic, shaped by its command schema. Amounts for the feeder are in grams and
+// converted to doses.
+func PublishCommand(ctx context.Context, deviceType *devices.Type, cmd devices.Command) error {
+	if deviceType.Name == devices.Feeder {
+		cmd.Amount = utils.CalculateFeedDoses(cmd.Amount)
 	}
 
-	command := UVCommand{
-		State:       state,
-		DurationSec: durationSec,
+	if MockMode {
+		logging.FromContext(ctx).Warn("MOCK MODE: simulating device command", "device_type", deviceType.Name,
+			"state", cmd.State, "duration_sec", cmd.DurationSec, "amount", cmd.Amount)
+		switch deviceType.Name {
+		case devices.Feeder:
+			return MockPublishFeederCommand(cmd.Amount)
+		case devices.UV:
+			return MockPublishUVCommand(cmd.State, cmd.DurationSec)
+		}
+		return MockPublishDeviceCommand(deviceType, cmd)
 	}
 
-	payload, err := json.Marshal(command)
+	payload, err := json.Marshal(deviceType.CommandPayload(cmd))
 	if err != nil {
-		log.Printf("❌ Error marshaling UV command: %v", err)
+		logging.FromContext(ctx).Error("error marshaling device command", "device_type", deviceType.Name, "error", err)
 		return err
 	}
 
-	log.Printf("📤 Publishing to aquarium/uv/command: %s", string(payload))
+	return publish(ctx, deviceType.CommandTopic, payload)
+}
+
+// publish sends payload to topic and waits for the broker, counting the result per topic
+func publish(ctx context.Context, topic string, payload []byte) error {
+	logger := logging.FromContext(ctx).With("topic", topic, "payload", string(payload))
 
 	if Client == nil || !Client.IsConnected() {
-		log.Println("❌ MQTT Client not connected!")
+		logger.Error("MQTT publish failed", "error", "client not connected")
+		metrics.MQTTPublishFailures.WithLabelValues(topic).Inc()
 		return fmt.Errorf("MQTT client not connected")
 	}
 
-	token := Client.Publish("aquarium/uv/command", 0, false, payload)
+	token := Client.Publish(topic, 0, false, payload)
 	token.Wait()
 
-	if token.Error() != nil {
-		log.Printf("❌ Failed to publish UV command: %v", token.Error())
-		return token.Error()
+	if err := token.Error(); err != nil {
+		logger.Error("MQTT publish failed", "error", err)
+		metrics.MQTTPublishFailures.WithLabelValues(topic).Inc()
+		return err
 	}
 
-	log.Printf("✅ Published UV command: state=%s, duration=%d", state, durationSec)
+	logger.Info("MQTT command published")
+	metrics.MQTTPublished.WithLabelValues(topic).Inc()
 	return nil
 }
@@ -0,0 +1,123 @@
+package mqtt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	cfg := &config.Config{
+		DBType:                  "sqlite",
+		DBName:                  filepath.Join(t.TempDir(), "test"),
+		DBLogLevel:              "silent",
+		SQLiteJournalMode:       "WAL",
+		SQLiteSynchronous:       "NORMAL",
+		SQLiteBusyTimeoutMillis: 5000,
+	}
+	if err := database.Connect(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSensorDataRejectsNullReadings(t *testing.T) {
+	setupDB(t)
+
+	// A failed DHT read: the firmware serializes NaN as null
+	handleSensorData(context.Background(), []byte(`[{"temp": null, "hum": 61.5}, {"hum": 62}]`))
+
+	var logs int64
+	database.DB.Model(&models.SensorLog{}).Count(&logs)
+	if logs != 0 {
+		t.Errorf("stored %d legacy sensor logs, want 0", logs)
+	}
+
+	var readings []models.SensorReading
+	database.DB.Order("id").Find(&readings)
+	for _, reading := range readings {
+		if reading.Metric == sensors.Temperature {
+			t.Errorf("stored temperature %v from a null value", reading.Value)
+		}
+	}
+	if len(readings) != 2 {
+		t.Errorf("stored %d readings, want the 2 humidity values", len(readings))
+	}
+}
+
+func TestMockSensorDataIsCalibrated(t *testing.T) {
+	setupDB(t)
+	database.DB.Create(&models.SensorCalibration{SensorID: "dht22", Metric: sensors.Temperature, Offset: -1.5, Scale: 1})
+	sensors.ReloadCalibrations()
+	t.Cleanup(func() {
+		database.DB.Where("1 = 1").Delete(&models.SensorCalibration{})
+		sensors.ReloadCalibrations()
+	})
+
+	sendMockSensorData()
+
+	var reading models.SensorReading
+	if err := database.DB.Where("metric = ?", sensors.Temperature).First(&reading).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reading.Value != reading.RawValue-1.5 {
+		t.Errorf("value %v is not calibrated from raw %v", reading.Value, reading.RawValue)
+	}
+
+	var log models.SensorLog
+	if err := database.DB.First(&log).Error; err != nil {
+		t.Fatal(err)
+	}
+	if log.Temperature != reading.Value {
+		t.Errorf("sensor log temperature %v, want calibrated %v", log.Temperature, reading.Value)
+	}
+}
+
+// message is a received MQTT message for calling messageHandler directly
+type message struct {
+	paho.Message
+	topic   string
+	payload []byte
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return m.payload }
+
+func TestFeederStatusUsesRegisteredTopic(t *testing.T) {
+	setupDB(t)
+	database.DB.FirstOrCreate(&models.DeviceStatus{}, models.DeviceStatus{DeviceType: devices.Feeder, Status: "IDLE"})
+
+	// An override from DEVICE_TYPES_FILE moves the feeder to other topics and keys
+	err := devices.Register(devices.Type{
+		Name:          devices.Feeder,
+		Capabilities:  []string{devices.CapDose, devices.CapStock},
+		CommandTopic:  "tank/feeder/cmd",
+		StatusTopic:   "tank/feeder/state",
+		StatusSchema:  map[string]string{devices.FieldState: "s"},
+		CommandSchema: map[string]string{devices.FieldAmount: "n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageHandler(nil, message{topic: "aquarium/feeder/status", payload: []byte(`{"status": "DISPENSING"}`)})
+	messageHandler(nil, message{topic: "tank/feeder/state", payload: []byte(`{"s": "jammed"}`)})
+
+	var status models.DeviceStatus
+	database.DB.Where("device_type = ?", devices.Feeder).First(&status)
+	if status.Status != "JAMMED" {
+		t.Errorf("feeder status %q, want JAMMED from the registered status topic", status.Status)
+	}
+}
@@ -0,0 +1,87 @@
+package mqtt
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxPayloadPreview limits the payload kept per topic for diagnostics
+const maxPayloadPreview = 256
+
+// LastMessage is the latest message received on a topic
+type LastMessage struct {
+	Topic      string    `json:"topic"`
+	ReceivedAt time.Time `json:"received_at"`
+	Payload    string    `json:"payload"`
+	Count      int64     `json:"count"`
+}
+
+var (
+	diagMu        sync.Mutex
+	brokerURL     string
+	subscriptions []string
+	lastMessages  = make(map[string]*LastMessage)
+)
+
+// Connected reports whether the client is connected to the broker (always true in mock mode)
+func Connected() bool {
+	if MockMode {
+		return true
+	}
+	return Client != nil && Client.IsConnected()
+}
+
+// BrokerURL returns the configured broker URL ("mock" in mock mode)
+func BrokerURL() string {
+	if MockMode {
+		return "mock"
+	}
+	diagMu.Lock()
+	defer diagMu.Unlock()
+	return brokerURL
+}
+
+// Subscriptions returns the topics subscribed to successfully
+func Subscriptions() []string {
+	diagMu.Lock()
+	defer diagMu.Unlock()
+	return append([]string{}, subscriptions...)
+}
+
+// LastMessages returns the latest message per topic, sorted by topic
+func LastMessages() []LastMessage {
+	diagMu.Lock()
+	defer diagMu.Unlock()
+
+	messages := make([]LastMessage, 0, len(lastMessages))
+	for _, m := range lastMessages {
+		messages = append(messages, *m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Topic < messages[j].Topic })
+	return messages
+}
+
+func recordMessage(topic string, payload []byte) {
+	preview := string(payload)
+	if len(preview) > maxPayloadPreview {
+		preview = preview[:maxPayloadPreview] + "..."
+	}
+
+	diagMu.Lock()
+	defer diagMu.Unlock()
+	m, ok := lastMessages[topic]
+	if !ok {
+		m = &LastMessage{Topic: topic}
+		lastMessages[topic] = m
+	}
+	m.ReceivedAt = time.Now()
+	m.Payload = preview
+	m.Count++
+}
+
+func recordSubscription(topic string) {
+	diagMu.Lock()
+	defer diagMu.Unlock()
+	subscriptions = append(subscriptions, topic)
+}
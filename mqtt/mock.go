@@ -1,45 +1,52 @@
 package mqtt
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"sync"
 	"time"
 
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/metrics"
 	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+	"iot-backend-cursor/service"
 )
 
 var MockMode bool = false
 
+var (
+	// mockStop is closed on shutdown to end the simulated devices
+	mockStop = make(chan struct{})
+	mockWG   sync.WaitGroup
+)
+
+// goMock runs fn as a simulated device task that shutdown waits for
+func goMock(fn func()) {
+	mockWG.Add(1)
+	go func() {
+		defer mockWG.Done()
+		fn()
+	}()
+}
+
+// mockContext is the context of simulated device reports
+func mockContext() context.Context {
+	return logging.NewContext("mqtt")
+}
+
 // InitMockMQTT initializes mock MQTT client for demo mode
 func InitMockMQTT() {
 	MockMode = true
-	log.Println("MQTT Mock Mode: Enabled - Simulating device responses")
-
-	// Initialize device statuses
-	var feederStatus models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "FEEDER").First(&feederStatus).Error; err != nil {
-		feederStatus = models.DeviceStatus{
-			DeviceType:  "FEEDER",
-			Status:      "IDLE",
-			Remaining:   0,
-			LastUpdated: time.Now(),
-		}
-		database.DB.Create(&feederStatus)
-	}
+	metrics.MQTTConnected.Set(1)
+	slog.Info("MQTT mock mode enabled, simulating device responses")
 
-	var uvStatus models.DeviceStatus
-	if err := database.DB.Where("device_type = ?", "UV").First(&uvStatus).Error; err != nil {
-		uvStatus = models.DeviceStatus{
-			DeviceType:  "UV",
-			Status:      "OFF",
-			Remaining:   0,
-			LastUpdated: time.Now(),
-		}
-		database.DB.Create(&uvStatus)
-	}
+	// Device status rows are created by devices.InitDevices
 
 	// Start mock sensor data generator
-	go mockSensorDataGenerator()
+	goMock(mockSensorDataGenerator)
 }
 
 // mockSensorDataGenerator simulates DHT sensor readings every 5 minutes
@@ -50,8 +57,13 @@ func mockSensorDataGenerator() {
 	// Send initial data immediately
 	sendMockSensorData()
 
-	for range ticker.C {
-		sendMockSensorData()
+	for {
+		select {
+		case <-ticker.C:
+			sendMockSensorData()
+		case <-mockStop:
+			return
+		}
 	}
 }
 
@@ -61,157 +73,128 @@ func sendMockSensorData() {
 	temperature := 25.0 + float64(time.Now().Unix()%5) + float64(time.Now().Nanosecond()%100)/100.0
 	humidity := 60.0 + float64(time.Now().Unix()%20) + float64(time.Now().Nanosecond()%100)/100.0
 
-	sensorLog := models.SensorLog{
-		Temperature: temperature,
-		Humidity:    humidity,
-		RecordedAt:  time.Now(),
-	}
-
-	if err := database.DB.Create(&sensorLog).Error; err == nil {
-		log.Printf("[MOCK] Sensor data: Temp=%.2f°C, Humidity=%.2f%%", temperature, humidity)
+	now := time.Now()
+	slog.Debug("mock sensor data", "temperature", temperature, "humidity", humidity)
+	saveSensorData(context.Background(), SensorData{Temperature: &temperature, Humidity: &humidity}, now)
+
+	// Water quality: pH 6.8-7.4, TDS 250-350 ppm, water 25-27°C, level 28-30 cm
+	variation := float64(time.Now().Nanosecond()%100) / 100.0
+	for metric, value := range map[string]float64{
+		sensors.PH:               6.8 + variation*0.6,
+		sensors.TDS:              250 + variation*100,
+		sensors.WaterTemperature: 25 + variation*2,
+		sensors.WaterLevel:       28 + variation*2,
+	} {
+		if _, err := sensors.Ingest(sensors.Sample{Metric: metric, Value: value, At: now}); err != nil {
+			slog.Warn("dropped mock sensor reading", "metric", metric, "error", err)
+		}
 	}
 }
 
 // MockPublishFeederCommand simulates publishing feeder command
 func MockPublishFeederCommand(dose int) error {
-	log.Printf("[MOCK] Published feeder command: dose=%d", dose)
 
 	// Simulate device processing (instant - no delay)
-	go func() {
-		// Update feeder status to DISPENSING
-		var deviceStatus models.DeviceStatus
-		if err := database.DB.Where("device_type = ?", "FEEDER").First(&deviceStatus).Error; err == nil {
-			deviceStatus.Status = "DISPENSING"
-			deviceStatus.LastUpdated = time.Now()
-			database.DB.Save(&deviceStatus)
-		}
-
-		// Update feeder status back to IDLE (instant)
-		if err := database.DB.Where("device_type = ?", "FEEDER").First(&deviceStatus).Error; err == nil {
-			deviceStatus.Status = "IDLE"
-			deviceStatus.LastUpdated = time.Now()
-			database.DB.Save(&deviceStatus)
-		}
+	goMock(func() {
+		// Feeder goes DISPENSING and back to IDLE (instant)
+		service.SetDeviceStatus(devices.Feeder, "DISPENSING", 0)
+		service.SetDeviceStatus(devices.Feeder, "IDLE", 0)
 
 		// Find the latest pending/running action
 		var action models.ActionHistory
-		if err := database.DB.Where("device_type = ? AND status IN ?", "FEEDER", []string{"PENDING", "RUNNING"}).
+		if err := database.DB.Where("device_type = ? AND status IN ?", devices.Feeder, models.ActiveActionStatuses).
 			Order("created_at DESC").
 			First(&action).Error; err == nil {
-			// Simulate successful feed
-			now := time.Now()
-			action.EndTime = &now
-			action.Status = "SUCCESS"
-
-			if err := database.DB.Save(&action).Error; err == nil {
-				// Update stock
-				var stock models.Stock
-				if err := database.DB.First(&stock).Error; err == nil {
-					stock.AmountGram -= action.Value
-					if stock.AmountGram < 0 {
-						stock.AmountGram = 0
-					}
-					database.DB.Save(&stock)
-					log.Printf("[MOCK] Feed completed successfully: %dg dispensed, stock: %dg", action.Value, stock.AmountGram)
-				}
+			// Simulate a successful feed: finish the action and take the amount from stock
+			ctx := mockContext()
+			if err := service.FinishAction(ctx, &action, models.ActionSuccess, "mock device reported SUCCESS", action.Value); err != nil {
+				logging.FromContext(ctx).Warn("mock feed not completed", "action_id", action.ID, "error", err)
+				return
 			}
+			logging.FromContext(ctx).Info("mock feed completed", "action_id", action.ID, "amount_gram", action.Value)
 		}
-	}()
+	})
 
 	return nil
 }
 
 // MockPublishUVCommand simulates publishing UV command
 func MockPublishUVCommand(state string, durationSec int) error {
-	log.Printf("[MOCK] Published UV command: state=%s, duration=%d", state, durationSec)
-
 	if state == "ON" {
 		// Update UV status
-		var deviceStatus models.DeviceStatus
-		if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-			deviceStatus.Status = "ON"
-			deviceStatus.Remaining = durationSec
-			deviceStatus.LastUpdated = time.Now()
-			database.DB.Save(&deviceStatus)
-		}
+		service.SetDeviceStatus(devices.UV, "ON", durationSec)
 
 		// If duration is 0 (schedule mode), we'll let the scheduler handle it
 		if durationSec > 0 {
 			// For manual UV, simulate countdown
-			go func() {
+			goMock(func() {
 				remaining := durationSec
 				ticker := time.NewTicker(1 * time.Second)
 				defer ticker.Stop()
 
 				for remaining > 0 {
-					<-ticker.C
-					remaining--
-
-					var deviceStatus models.DeviceStatus
-					if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-						deviceStatus.Remaining = remaining
-						deviceStatus.LastUpdated = time.Now()
-						database.DB.Save(&deviceStatus)
+					select {
+					case <-ticker.C:
+					case <-mockStop:
+						// Shutting down: the run is turned off by SHUTDOWN_UV_OFF
+						// or by the expiration check after restart
+						return
 					}
+					remaining--
 
-					// Check if UV was turned off manually
-					if deviceStatus.Status == "OFF" {
-						break
+					// Stop counting once UV was turned off manually
+					if on, err := service.UpdateRemaining(devices.UV, remaining); err == nil && !on {
+						return
 					}
 				}
 
-				// Turn off UV when duration ends
-				if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-					deviceStatus.Status = "OFF"
-					deviceStatus.Remaining = 0
-					deviceStatus.LastUpdated = time.Now()
-					database.DB.Save(&deviceStatus)
-				}
-
-				// Update action history
+				// Turn off UV when duration ends and finish the manual run
 				var action models.ActionHistory
-				if err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "MANUAL", "RUNNING").
+				if err := database.DB.Where("device_type = ? AND trigger_source IN ? AND status = ?", devices.UV, []string{"MANUAL", "AUTOMATION"}, models.ActionRunning).
 					Order("start_time DESC").
 					First(&action).Error; err == nil {
-					now := time.Now()
-					action.EndTime = &now
-					action.Status = "SUCCESS"
-					database.DB.Save(&action)
-					log.Printf("[MOCK] UV turned off after %d seconds", durationSec)
+					ctx := mockContext()
+					if err := service.StopRun(ctx, &action, models.ActionSuccess, "mock device finished countdown"); err == nil {
+						logging.FromContext(ctx).Info("mock UV turned off", "action_id", action.ID, "duration_sec", durationSec)
+						return
+					}
 				}
-			}()
+				service.SetDeviceStatus(devices.UV, "OFF", 0)
+			})
 		} else {
-			// Schedule mode - update action history
-			var action models.ActionHistory
-			if err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "SCHEDULE", "RUNNING").
-				Order("start_time DESC").
-				First(&action).Error; err == nil {
-				log.Printf("[MOCK] UV turned ON (schedule mode)")
-			}
+			slog.Debug("mock UV turned on without duration")
 		}
 	} else if state == "OFF" {
-		// Turn off UV
-		var deviceStatus models.DeviceStatus
-		if err := database.DB.Where("device_type = ?", "UV").First(&deviceStatus).Error; err == nil {
-			deviceStatus.Status = "OFF"
-			deviceStatus.Remaining = 0
-			deviceStatus.LastUpdated = time.Now()
-			database.DB.Save(&deviceStatus)
-		}
+		// Turn off UV; the caller finishes the running actions
+		service.SetDeviceStatus(devices.UV, "OFF", 0)
+		slog.Debug("mock UV turned off")
+	}
+
+	return nil
+}
+
+// MockPublishDeviceCommand simulates a command to a device type without a dedicated mock.
+// On/off devices switch state immediately, dose devices report success.
+func MockPublishDeviceCommand(deviceType *devices.Type, cmd devices.Command) error {
+	slog.Debug("mock device command", "device_type", deviceType.Name, "payload", deviceType.CommandPayload(cmd))
 
-		// Update any running schedule action
+	if deviceType.HasCapability(devices.CapOnOff) {
+		return service.SetDeviceStatus(deviceType.Name, cmd.State, cmd.DurationSec)
+	}
+
+	goMock(func() {
 		var action models.ActionHistory
-		if err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "SCHEDULE", "RUNNING").
-			Order("start_time DESC").
-			First(&action).Error; err == nil {
-			now := time.Now()
-			action.EndTime = &now
-			action.Status = "SUCCESS"
-			database.DB.Save(&action)
+		if err := database.DB.Where("device_type = ? AND status IN ?", deviceType.Name, models.ActiveActionStatuses).
+			Order("created_at DESC").
+			First(&action).Error; err != nil {
+			return
 		}
 
-		log.Printf("[MOCK] UV turned OFF")
-	}
+		ctx := mockContext()
+		if err := service.FinishAction(ctx, &action, models.ActionSuccess, "mock device reported SUCCESS", 0); err == nil {
+			logging.FromContext(ctx).Info("mock dose completed", "action_id", action.ID, "device_type", deviceType.Name, "amount", action.Value)
+		}
+	})
 
 	return nil
 }
@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Channel delivers a notification to one destination
+type Channel interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// Channel types
+const (
+	TypeWebhook  = "webhook"
+	TypeEmail    = "email"
+	TypeTelegram = "telegram"
+)
+
+// secretFields are masked when channel configs are returned by the API
+var secretFields = []string{"secret", "password", "bot_token"}
+
+// secretMask replaces secret values in API responses
+const secretMask = "****"
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookChannel POSTs the notification as JSON. When Secret is set the
+// body is signed: X-Aquarium-Signature = "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+type WebhookChannel struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Send implements Channel
+func (w *WebhookChannel) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Aquarium-Event", n.EventType)
+	req.Header.Set("X-Aquarium-Timestamp", timestamp)
+	if w.Secret != "" {
+		req.Header.Set("X-Aquarium-Signature", Sign(w.Secret, timestamp, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the webhook signature header value for body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// EmailChannel sends the notification as a plain text email over SMTP
+type EmailChannel struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// Send implements Channel
+func (e *EmailChannel) Send(ctx context.Context, n Notification) error {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + e.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(e.To, ", ") + "\r\n")
+	msg.WriteString("Subject: [Aquarium] " + n.Title + "\r\n")
+	msg.WriteString("Date: " + n.At.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(n.Message + "\r\n")
+
+	// net/smtp has no context support; run it in the background and give up on cancel
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, e.From, e.To, []byte(msg.String()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TelegramChannel sends the notification through the Telegram Bot API
+type TelegramChannel struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+	APIURL   string `json:"api_url"` // optional, defaults to https://api.telegram.org
+}
+
+// Send implements Channel
+func (t *TelegramChannel) Send(ctx context.Context, n Notification) error {
+	apiURL := t.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.ChatID,
+		"text":    n.Title + "\n" + n.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(apiURL, "/") + "/bot" + t.BotToken + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The *url.Error text carries the endpoint, which embeds the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("telegram request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram returned HTTP %d", resp.StatusCode)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram error: %s", result.Description)
+	}
+	return nil
+}
+
+// BuildChannel creates a Channel from its type and JSON config, validating required settings
+func BuildChannel(channelType, config string) (Channel, error) {
+	if config == "" {
+		config = "{}"
+	}
+
+	switch channelType {
+	case TypeWebhook:
+		var ch WebhookChannel
+		if err := json.Unmarshal([]byte(config), &ch); err != nil {
+			return nil, fmt.Errorf("invalid webhook config: %v", err)
+		}
+		if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+			return nil, errors.New("webhook config requires an http(s) url")
+		}
+		return &ch, nil
+
+	case TypeEmail:
+		var ch EmailChannel
+		if err := json.Unmarshal([]byte(config), &ch); err != nil {
+			return nil, fmt.Errorf("invalid email config: %v", err)
+		}
+		if ch.Host == "" || ch.From == "" || len(ch.To) == 0 {
+			return nil, errors.New("email config requires host, from and to")
+		}
+		if ch.Port == 0 {
+			ch.Port = 587
+		}
+		return &ch, nil
+
+	case TypeTelegram:
+		var ch TelegramChannel
+		if err := json.Unmarshal([]byte(config), &ch); err != nil {
+			return nil, fmt.Errorf("invalid telegram config: %v", err)
+		}
+		if ch.BotToken == "" || ch.ChatID == "" {
+			return nil, errors.New("telegram config requires bot_token and chat_id")
+		}
+		return &ch, nil
+	}
+
+	return nil, fmt.Errorf("unknown channel type: %s", channelType)
+}
+
+// MaskConfig hides secret values in a channel config for API responses
+func MaskConfig(config string) string {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &values); err != nil {
+		return config
+	}
+	for _, field := range secretFields {
+		if v, ok := values[field].(string); ok && v != "" {
+			values[field] = secretMask
+		}
+	}
+	masked, err := json.Marshal(values)
+	if err != nil {
+		return config
+	}
+	return string(masked)
+}
+
+// KeepSecrets fills secret values that are masked or omitted in a submitted
+// config from the stored one, so a masked config can be edited and sent back
+func KeepSecrets(submitted, stored string) string {
+	var values, current map[string]interface{}
+	if err := json.Unmarshal([]byte(submitted), &values); err != nil {
+		return submitted
+	}
+	if err := json.Unmarshal([]byte(stored), &current); err != nil {
+		return submitted
+	}
+	for _, field := range secretFields {
+		if v, ok := values[field]; ok && v != secretMask {
+			continue
+		}
+		if previous, ok := current[field]; ok {
+			values[field] = previous
+		}
+	}
+	merged, err := json.Marshal(values)
+	if err != nil {
+		return submitted
+	}
+	return string(merged)
+}
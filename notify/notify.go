@@ -0,0 +1,328 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+)
+
+// Notification is the payload delivered to channels
+type Notification struct {
+	EventType string      `json:"event_type"`
+	Title     string      `json:"title"`
+	Message   string      `json:"message"`
+	Severity  string      `json:"severity,omitempty"`
+	At        time.Time   `json:"at"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// Notification event types channels can subscribe to
+const (
+	EventAlertFiring   = string(events.AlertFiring)
+	EventAlertResolved = string(events.AlertResolved)
+	EventActionFailed  = string(events.ActionFailed)
+	EventStockLow      = "stock.low"
+	EventAutomation    = "automation"
+	EventTest          = "test"
+)
+
+// EventTypes lists the event types that can be configured on a channel
+var EventTypes = []string{EventAlertFiring, EventAlertResolved, EventActionFailed, EventStockLow, EventAutomation}
+
+// Delivery statuses
+const (
+	DeliveryPending     = "PENDING"
+	DeliverySent        = "SENT"
+	DeliveryFailed      = "FAILED"
+	DeliveryRateLimited = "RATE_LIMITED"
+)
+
+const (
+	workerCount = 4
+	sendTimeout = 15 * time.Second
+)
+
+type job struct {
+	delivery models.NotificationDelivery
+	channel  Channel
+	n        Notification
+}
+
+var (
+	queue             chan job
+	queueMu           sync.RWMutex // guards sending on and closing queue
+	workers           sync.WaitGroup
+	maxAttempts       = 3
+	retryBase         = 2 * time.Second
+	stockLowThreshold = 100
+
+	rateMu   sync.Mutex
+	lastSent = make(map[string]time.Time) // "<channel id>:<event type>" -> last delivery
+)
+
+// InitNotifier starts the delivery workers and subscribes to application events
+func InitNotifier(cfg *config.Config) {
+	if cfg.NotifyMaxAttempts > 0 {
+		maxAttempts = cfg.NotifyMaxAttempts
+	}
+	if cfg.NotifyRetryBaseSeconds > 0 {
+		retryBase = time.Duration(cfg.NotifyRetryBaseSeconds) * time.Second
+	}
+	stockLowThreshold = cfg.StockLowThresholdGram
+
+	queue = make(chan job, 100)
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go worker(queue)
+	}
+
+	events.Subscribe(events.AlertFiring, func(e events.Event) {
+		alert, _ := e.Subject.(*models.Alert)
+		n := Notification{EventType: EventAlertFiring, Title: "Alert firing", Message: e.Message, Data: alert}
+		if alert != nil {
+			n.Title = "Alert firing: " + alert.RuleName
+			n.Severity = alert.Severity
+		}
+		Notify(n)
+	})
+
+	events.Subscribe(events.AlertResolved, func(e events.Event) {
+		alert, _ := e.Subject.(*models.Alert)
+		n := Notification{EventType: EventAlertResolved, Title: "Alert resolved", Message: e.Message, Data: alert}
+		if alert != nil {
+			n.Title = "Alert resolved: " + alert.RuleName
+			n.Severity = alert.Severity
+		}
+		Notify(n)
+	})
+
+	events.Subscribe(events.ActionFailed, func(e events.Event) {
+		Notify(Notification{
+			EventType: EventActionFailed,
+			Title:     "Action failed",
+			Message:   e.Message,
+			Severity:  "CRITICAL",
+			Data:      e.Subject,
+		})
+	})
+
+	// Notify once when stock drops below the threshold, not on every feed
+	events.Subscribe(events.StockChanged, func(e events.Event) {
+		threshold := float64(stockLowThreshold)
+		if e.Value < threshold && e.Previous >= threshold {
+			Notify(Notification{
+				EventType: EventStockLow,
+				Title:     "Food stock low",
+				Message:   fmt.Sprintf("Food stock is %.0fg (below %dg)", e.Value, stockLowThreshold),
+				Severity:  "WARNING",
+				Data:      map[string]interface{}{"amount_gram": e.Value, "threshold_gram": stockLowThreshold},
+			})
+		}
+	})
+
+	slog.Info("notifier started", "workers", workerCount, "max_attempts", maxAttempts)
+}
+
+// Notify queues n for every active channel subscribed to its event type
+func Notify(n Notification) {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if queue == nil {
+		return
+	}
+	if n.At.IsZero() {
+		n.At = time.Now()
+	}
+
+	var channels []models.NotificationChannel
+	if err := database.DB.Where("is_active = ?", true).Find(&channels).Error; err != nil {
+		slog.Error("error loading notification channels", "error", err)
+		return
+	}
+
+	for _, channel := range channels {
+		if !Subscribed(channel.EventTypes, n.EventType) {
+			continue
+		}
+
+		delivery := models.NotificationDelivery{
+			ChannelID:   channel.ID,
+			ChannelName: channel.Name,
+			EventType:   n.EventType,
+			Title:       n.Title,
+			Message:     n.Message,
+			Status:      DeliveryPending,
+		}
+
+		ch, err := BuildChannel(channel.Type, channel.Config)
+		if err != nil {
+			delivery.Status = DeliveryFailed
+			delivery.LastError = err.Error()
+			database.DB.Create(&delivery)
+			continue
+		}
+
+		if !allow(channel, n.EventType) {
+			delivery.Status = DeliveryRateLimited
+			database.DB.Create(&delivery)
+			continue
+		}
+
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			slog.Error("error creating notification delivery", "channel", channel.Name, "error", err)
+			continue
+		}
+
+		select {
+		case queue <- job{delivery: delivery, channel: ch, n: n}:
+		default:
+			delivery.Status = DeliveryFailed
+			delivery.LastError = "notification queue full"
+			database.DB.Save(&delivery)
+			slog.Error("notification queue full, dropped notification", "event_type", n.EventType, "channel", channel.Name)
+		}
+	}
+}
+
+// SendTest delivers a test notification to channel synchronously, without retries
+func SendTest(channel models.NotificationChannel) (models.NotificationDelivery, error) {
+	n := Notification{
+		EventType: EventTest,
+		Title:     "Test notification",
+		Message:   fmt.Sprintf("Test notification for channel %q", channel.Name),
+		At:        time.Now(),
+	}
+
+	delivery := models.NotificationDelivery{
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		EventType:   n.EventType,
+		Title:       n.Title,
+		Message:     n.Message,
+		Attempts:    1,
+	}
+
+	ch, err := BuildChannel(channel.Type, channel.Config)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = ch.Send(ctx, n)
+		cancel()
+	}
+
+	if err != nil {
+		delivery.Status = DeliveryFailed
+		delivery.LastError = err.Error()
+	} else {
+		now := time.Now()
+		delivery.Status = DeliverySent
+		delivery.SentAt = &now
+	}
+	database.DB.Create(&delivery)
+
+	return delivery, err
+}
+
+// Subscribed reports whether a comma-separated event type list includes eventType
+func Subscribed(eventTypes, eventType string) bool {
+	for _, t := range strings.Split(eventTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// allow applies the channel's per-event-type rate limit
+func allow(channel models.NotificationChannel, eventType string) bool {
+	if channel.RateLimitSeconds <= 0 {
+		return true
+	}
+
+	key := fmt.Sprintf("%d:%s", channel.ID, eventType)
+	now := time.Now()
+
+	rateMu.Lock()
+	defer rateMu.Unlock()
+
+	if last, ok := lastSent[key]; ok && now.Sub(last) < time.Duration(channel.RateLimitSeconds)*time.Second {
+		return false
+	}
+	lastSent[key] = now
+	return true
+}
+
+// Shutdown stops accepting notifications and waits until the queued ones are
+// delivered or ctx is done
+func Shutdown(ctx context.Context) error {
+	queueMu.Lock()
+	if queue != nil {
+		close(queue)
+		queue = nil
+	}
+	queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func worker(queue <-chan job) {
+	defer workers.Done()
+	for j := range queue {
+		attempts, err := deliver(context.Background(), j.channel, j.n, maxAttempts, retryBase)
+
+		j.delivery.Attempts = attempts
+		if err != nil {
+			j.delivery.Status = DeliveryFailed
+			j.delivery.LastError = err.Error()
+			slog.Error("notification failed", "event_type", j.n.EventType, "channel", j.delivery.ChannelName, "attempts", attempts, "error", err)
+		} else {
+			now := time.Now()
+			j.delivery.Status = DeliverySent
+			j.delivery.LastError = ""
+			j.delivery.SentAt = &now
+			slog.Info("notification sent", "event_type", j.n.EventType, "channel", j.delivery.ChannelName, "attempts", attempts)
+		}
+		database.DB.Save(&j.delivery)
+	}
+}
+
+// deliver sends n with up to attempts tries, doubling the wait after each failure
+func deliver(ctx context.Context, ch Channel, n Notification, attempts int, backoff time.Duration) (int, error) {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = ch.Send(sendCtx, n)
+		cancel()
+		if err == nil {
+			return attempt, nil
+		}
+
+		if attempt < attempts {
+			select {
+			case <-time.After(backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			}
+		}
+	}
+	return attempts, err
+}
@@ -0,0 +1,286 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	return Notification{
+		EventType: EventAlertFiring,
+		Title:     "Alert firing: Too hot",
+		Message:   "temperature is 31.00 (GT 30.00)",
+		Severity:  "CRITICAL",
+		At:        time.Now(),
+	}
+}
+
+func TestWebhookChannelSignsBody(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := Sign("s3cret", r.Header.Get("X-Aquarium-Timestamp"), body)
+		if r.Header.Get("X-Aquarium-Signature") != expected {
+			t.Errorf("signature mismatch: got %q, want %q", r.Header.Get("X-Aquarium-Signature"), expected)
+		}
+		if r.Header.Get("X-Aquarium-Event") != EventAlertFiring {
+			t.Errorf("unexpected event header %q", r.Header.Get("X-Aquarium-Event"))
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ch := &WebhookChannel{URL: server.URL, Secret: "s3cret"}
+	if err := ch.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if received.Title != "Alert firing: Too hot" {
+		t.Errorf("unexpected payload title %q", received.Title)
+	}
+}
+
+func TestWebhookChannelReportsHTTPErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ch := &WebhookChannel{URL: server.URL}
+	if err := ch.Send(context.Background(), testNotification()); err == nil {
+		t.Fatal("expected error for HTTP 500")
+	}
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ch := &WebhookChannel{URL: server.URL}
+	attempts, err := deliver(context.Background(), ch, testNotification(), 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	attempts, err := deliver(context.Background(), &WebhookChannel{URL: server.URL}, testNotification(), 2, time.Millisecond)
+	if err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+	if attempts != 2 || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected 2 attempts, got %d (server saw %d)", attempts, calls)
+	}
+}
+
+func TestTelegramChannel(t *testing.T) {
+	var path string
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["chat_id"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	ch := &TelegramChannel{BotToken: "123:abc", ChatID: "42", APIURL: server.URL}
+	if err := ch.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if !strings.Contains(payload["text"], "Too hot") {
+		t.Errorf("unexpected text %q", payload["text"])
+	}
+
+	ch.ChatID = "bad"
+	if err := ch.Send(context.Background(), testNotification()); err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("expected telegram error, got %v", err)
+	}
+}
+
+func TestTelegramErrorsHideBotToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	apiURL := server.URL
+	server.Close()
+
+	ch := &TelegramChannel{BotToken: "123:secret-token", ChatID: "42", APIURL: apiURL}
+	_, err := deliver(context.Background(), ch, testNotification(), 1, time.Millisecond)
+	if err == nil {
+		t.Fatal("expected error from closed server")
+	}
+	if strings.Contains(err.Error(), ch.BotToken) {
+		t.Errorf("delivery error leaks the bot token: %v", err)
+	}
+}
+
+// fakeSMTPServer accepts one message and returns its DATA section
+func fakeSMTPServer(t *testing.T) (host string, port int, messages chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP test")
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				messages <- data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return "127.0.0.1", addr.Port, messages
+}
+
+func TestEmailChannel(t *testing.T) {
+	host, port, messages := fakeSMTPServer(t)
+
+	ch := &EmailChannel{Host: host, Port: port, From: "aquarium@example.com", To: []string{"owner@example.com"}}
+	if err := ch.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		if !strings.Contains(msg, "Subject: [Aquarium] Alert firing: Too hot") {
+			t.Errorf("missing subject in message:\n%s", msg)
+		}
+		if !strings.Contains(msg, "temperature is 31.00") {
+			t.Errorf("missing body in message:\n%s", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("SMTP server received no message")
+	}
+}
+
+func TestBuildChannelValidatesConfig(t *testing.T) {
+	cases := []struct {
+		channelType string
+		config      string
+		ok          bool
+	}{
+		{TypeWebhook, `{"url":"https://example.com/hook"}`, true},
+		{TypeWebhook, `{"url":"ftp://example.com"}`, false},
+		{TypeEmail, `{"host":"smtp.example.com","from":"a@example.com","to":["b@example.com"]}`, true},
+		{TypeEmail, `{"host":"smtp.example.com"}`, false},
+		{TypeTelegram, `{"bot_token":"1:x","chat_id":"42"}`, true},
+		{TypeTelegram, `{"bot_token":"1:x"}`, false},
+		{"sms", `{}`, false},
+	}
+
+	for _, tc := range cases {
+		_, err := BuildChannel(tc.channelType, tc.config)
+		if (err == nil) != tc.ok {
+			t.Errorf("BuildChannel(%s, %s): err=%v, want ok=%v", tc.channelType, tc.config, err, tc.ok)
+		}
+	}
+}
+
+func TestSubscribedAndMaskConfig(t *testing.T) {
+	if !Subscribed("alert.firing, stock.low", EventStockLow) {
+		t.Error("expected stock.low to be subscribed")
+	}
+	if Subscribed("alert.firing", EventStockLow) {
+		t.Error("did not expect stock.low to be subscribed")
+	}
+	if !Subscribed("*", EventActionFailed) {
+		t.Error("expected wildcard to match")
+	}
+
+	masked := MaskConfig(`{"url":"https://example.com","secret":"s3cret"}`)
+	if strings.Contains(masked, "s3cret") || !strings.Contains(masked, "example.com") {
+		t.Errorf("unexpected masked config %s", masked)
+	}
+}
+
+func TestKeepSecretsRestoresMaskedValues(t *testing.T) {
+	stored := `{"url":"https://example.com/hook","secret":"s3cret","bot_token":"123:abc"}`
+
+	// GET returns the masked config; the client edits the URL and sends it back
+	submitted := MaskConfig(`{"url":"https://example.com/new","secret":"s3cret","bot_token":"123:abc"}`)
+	var merged map[string]interface{}
+	if err := json.Unmarshal([]byte(KeepSecrets(submitted, stored)), &merged); err != nil {
+		t.Fatal(err)
+	}
+	if merged["secret"] != "s3cret" || merged["bot_token"] != "123:abc" || merged["url"] != "https://example.com/new" {
+		t.Errorf("merged config = %v, want stored secrets and the new url", merged)
+	}
+
+	// Omitted secrets are kept, new ones replace the stored value
+	if err := json.Unmarshal([]byte(KeepSecrets(`{"url":"u","secret":"rotated"}`, stored)), &merged); err != nil {
+		t.Fatal(err)
+	}
+	if merged["secret"] != "rotated" || merged["bot_token"] != "123:abc" {
+		t.Errorf("merged config = %v, want rotated secret and stored bot_token", merged)
+	}
+}
@@ -0,0 +1,132 @@
+package retention
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+)
+
+// Policy removes rows of a table older than a number of days
+type Policy struct {
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	Column string `json:"column"`           // timestamp compared with the cutoff
+	Filter string `json:"filter,omitempty"` // extra SQL condition
+	Days   int    `json:"days"`
+}
+
+// Result reports what a policy removed (or would remove in a dry run)
+type Result struct {
+	Policy
+	Cutoff time.Time `json:"cutoff"`
+	Rows   int64     `json:"rows"`
+	Error  string    `json:"error,omitempty"`
+}
+
+var (
+	policies  []Policy
+	batchSize = 1000
+
+	// runMu prevents the scheduled job and a manual run from overlapping
+	runMu sync.Mutex
+)
+
+// InitRetention builds the retention policies from the config
+func InitRetention(cfg *config.Config) {
+	if cfg.RetentionBatchSize > 0 {
+		batchSize = cfg.RetentionBatchSize
+	}
+
+	policies = []Policy{
+		{Name: "raw sensor logs", Table: "sensor_logs", Column: "recorded_at", Days: cfg.RetentionRawDays},
+		{Name: "raw sensor readings", Table: "sensor_readings", Column: "recorded_at", Days: cfg.RetentionRawDays},
+		{Name: "hourly sensor rollups", Table: "sensor_rollups", Column: "bucket_start", Filter: "bucket = '1h'", Days: cfg.RetentionRollupDays},
+		{Name: "action history", Table: "action_histories", Column: "start_time", Days: cfg.RetentionHistoryDays},
+		{Name: "deleted action history", Table: "action_histories", Column: "deleted_at", Filter: "deleted_at IS NOT NULL", Days: cfg.RetentionDeletedHistoryDays},
+		{Name: "action events", Table: "action_events", Column: "at", Days: cfg.RetentionHistoryDays},
+	}
+
+	for _, p := range policies {
+		if p.Days > 0 {
+			slog.Info("retention policy enabled", "policy", p.Name, "days", p.Days)
+		}
+	}
+}
+
+// Policies returns the configured retention policies
+func Policies() []Policy {
+	return policies
+}
+
+// Run applies every enabled policy. With dryRun it only counts the rows that would be removed.
+func Run(dryRun bool) []Result {
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	now := time.Now()
+	results := make([]Result, 0, len(policies))
+
+	for _, p := range policies {
+		if p.Days <= 0 {
+			continue
+		}
+
+		result := Result{Policy: p, Cutoff: now.AddDate(0, 0, -p.Days)}
+		var err error
+		if dryRun {
+			result.Rows, err = count(p, result.Cutoff)
+		} else {
+			result.Rows, err = purge(p, result.Cutoff)
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			slog.Error("retention failed", "policy", p.Name, "dry_run", dryRun, "error", err)
+		} else if !dryRun && result.Rows > 0 {
+			slog.Info("retention removed rows", "policy", p.Name, "rows", result.Rows, "cutoff", result.Cutoff)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Enforce runs all policies. Called daily by the scheduler.
+func Enforce() {
+	Run(false)
+}
+
+func where(p Policy) string {
+	condition := fmt.Sprintf("%s < ?", p.Column)
+	if p.Filter != "" {
+		condition += " AND " + p.Filter
+	}
+	return condition
+}
+
+func count(p Policy, cutoff time.Time) (int64, error) {
+	var n int64
+	err := database.DB.Table(p.Table).Where(where(p), cutoff).Count(&n).Error
+	return n, err
+}
+
+// purge deletes matching rows in batches so large tables don't hold long locks
+func purge(p Policy, cutoff time.Time) (int64, error) {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s LIMIT %d)", p.Table, p.Table, where(p), batchSize)
+
+	var total int64
+	for {
+		result := database.DB.Exec(statement, cutoff)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
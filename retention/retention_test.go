@@ -0,0 +1,103 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SensorLog{}, &models.SensorReading{}, &models.SensorRollup{}, &models.ActionHistory{}, &models.ActionEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+
+	InitRetention(&config.Config{
+		RetentionRawDays:            30,
+		RetentionRollupDays:         730,
+		RetentionHistoryDays:        365,
+		RetentionDeletedHistoryDays: 30,
+		RetentionBatchSize:          2,
+	})
+}
+
+func rowsByPolicy(t *testing.T, results []Result) map[string]int64 {
+	t.Helper()
+	rows := make(map[string]int64)
+	for _, r := range results {
+		if r.Error != "" {
+			t.Fatalf("%s: %s", r.Name, r.Error)
+		}
+		rows[r.Name] = r.Rows
+	}
+	return rows
+}
+
+func TestRetention(t *testing.T) {
+	setup(t)
+	now := time.Now()
+	old := now.AddDate(0, 0, -40)
+
+	for i := 0; i < 5; i++ {
+		database.DB.Create(&models.SensorReading{SensorID: "ph", Metric: "ph", Value: 7, RecordedAt: old})
+	}
+	database.DB.Create(&models.SensorReading{SensorID: "ph", Metric: "ph", Value: 7, RecordedAt: now})
+	database.DB.Create(&models.SensorLog{Temperature: 26, RecordedAt: old})
+
+	// Old daily rollups are kept, only hourly ones expire
+	database.DB.Create(&models.SensorRollup{Metric: "ph", Bucket: "1h", BucketStart: now.AddDate(-3, 0, 0)})
+	database.DB.Create(&models.SensorRollup{Metric: "ph", Bucket: "1d", BucketStart: now.AddDate(-3, 0, 0)})
+
+	database.DB.Create(&models.ActionHistory{DeviceType: "FEEDER", TriggerSource: "MANUAL", Status: "SUCCESS", StartTime: now.AddDate(-2, 0, 0)})
+	deleted := models.ActionHistory{DeviceType: "FEEDER", TriggerSource: "MANUAL", Status: "SUCCESS", StartTime: now}
+	database.DB.Create(&deleted)
+	database.DB.Model(&deleted).Update("deleted_at", old)
+
+	want := map[string]int64{
+		"raw sensor logs":        1,
+		"raw sensor readings":    5,
+		"hourly sensor rollups":  1,
+		"action history":         1,
+		"deleted action history": 1,
+	}
+
+	dryRun := rowsByPolicy(t, Run(true))
+	for name, n := range want {
+		if dryRun[name] != n {
+			t.Errorf("dry run %s = %d, want %d", name, dryRun[name], n)
+		}
+	}
+
+	var readings int64
+	database.DB.Model(&models.SensorReading{}).Count(&readings)
+	if readings != 6 {
+		t.Fatalf("dry run removed rows: %d readings left", readings)
+	}
+
+	removed := rowsByPolicy(t, Run(false))
+	for name, n := range want {
+		if removed[name] != n {
+			t.Errorf("removed %s = %d, want %d", name, removed[name], n)
+		}
+	}
+
+	database.DB.Model(&models.SensorReading{}).Count(&readings)
+	var rollups, actions int64
+	database.DB.Model(&models.SensorRollup{}).Count(&rollups)
+	database.DB.Unscoped().Model(&models.ActionHistory{}).Count(&actions)
+	if readings != 1 || rollups != 1 || actions != 0 {
+		t.Errorf("left readings=%d rollups=%d actions=%d, want 1, 1, 0", readings, rollups, actions)
+	}
+}
@@ -1,21 +1,45 @@
 package routes
 
 import (
+	"log/slog"
+	"net/http"
+
+	"iot-backend-cursor/audit"
+	"iot-backend-cursor/auth"
+	"iot-backend-cursor/config"
 	"iot-backend-cursor/handlers"
+	"iot-backend-cursor/metrics"
+	"iot-backend-cursor/middleware"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func SetupRoutes() *gin.Engine {
-	r := gin.Default()
+func SetupRoutes(cfg *config.Config) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), middleware.RequestID(), middleware.RequestLogger())
+
+	// CORS configuration (allow-list from CORS_ALLOWED_ORIGINS, "*" allows all)
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", middleware.RequestIDHeader}
+	corsConfig.ExposeHeaders = []string{middleware.RequestIDHeader}
+	if containsWildcard(cfg.CORSAllowedOrigins) {
+		slog.Warn("CORS allows all origins")
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.CORSAllowedOrigins
+	}
+	r.Use(cors.New(corsConfig))
+	r.Use(metrics.Middleware())
+
+	// Liveness and readiness probes
+	r.GET("/healthz", handlers.Healthz)
+	r.GET("/readyz", handlers.Readyz)
 
-	// CORS configuration
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	r.Use(cors.New(config))
+	// Prometheus metrics (bearer METRICS_TOKEN when set)
+	r.GET("/metrics", metricsAuth(cfg.MetricsToken), gin.WrapH(promhttp.Handler()))
 
 	// Documentation routes (serve before API routes)
 	r.GET("/docs", func(c *gin.Context) {
@@ -28,9 +52,28 @@ func SetupRoutes() *gin.Engine {
 		c.Redirect(302, "/docs")
 	})
 
-	// API routes
+	// Public API routes
+	r.POST("/api/v1/auth/login", handlers.Login)
+
+	// Per-route permissions
+	scheduleWrite := middleware.RequirePermission(auth.PermScheduleWrite)
+	deviceControl := middleware.RequirePermission(auth.PermDeviceControl)
+	adminDemo := middleware.RequirePermission(auth.PermAdminDemo)
+
+	// Authenticated API routes
 	api := r.Group("/api/v1")
+	api.Use(middleware.RequireAuth(), audit.Middleware())
 	{
+		// Account
+		account := api.Group("/auth")
+		{
+			account.GET("/me", handlers.GetMe)
+			account.PUT("/password", handlers.ChangePassword)
+			account.GET("/api-keys", handlers.GetAPIKeys)
+			account.POST("/api-keys", handlers.CreateAPIKey)
+			account.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
+		}
+
 		// Dashboard
 		api.GET("/dashboard", handlers.GetDashboard)
 
@@ -38,10 +81,10 @@ func SetupRoutes() *gin.Engine {
 		feeder := api.Group("/feeder")
 		{
 			feeder.GET("/schedules", handlers.GetFeederSchedules)
-			feeder.POST("/schedules", handlers.CreateFeederSchedule)
-			feeder.PUT("/schedules/:id", handlers.UpdateFeederSchedule)
-			feeder.DELETE("/schedules/:id", handlers.DeleteFeederSchedule)
-			feeder.POST("/manual", handlers.ManualFeed)
+			feeder.POST("/schedules", scheduleWrite, handlers.CreateFeederSchedule)
+			feeder.PUT("/schedules/:id", scheduleWrite, handlers.UpdateFeederSchedule)
+			feeder.DELETE("/schedules/:id", scheduleWrite, handlers.DeleteFeederSchedule)
+			feeder.POST("/manual", deviceControl, handlers.ManualFeed)
 			feeder.GET("/last-feed", handlers.GetLastFeedInfo)
 		}
 
@@ -49,33 +92,147 @@ func SetupRoutes() *gin.Engine {
 		uv := api.Group("/uv")
 		{
 			uv.GET("/schedules", handlers.GetUVSchedules)
-			uv.POST("/schedules", handlers.CreateUVSchedule)
-			uv.PUT("/schedules/:id", handlers.UpdateUVSchedule)
-			uv.DELETE("/schedules/:id", handlers.DeleteUVSchedule)
-			uv.POST("/manual", handlers.ManualUV)
-			uv.POST("/manual/stop", handlers.StopManualUV)
+			uv.POST("/schedules", scheduleWrite, handlers.CreateUVSchedule)
+			uv.PUT("/schedules/:id", scheduleWrite, handlers.UpdateUVSchedule)
+			uv.DELETE("/schedules/:id", scheduleWrite, handlers.DeleteUVSchedule)
+			uv.POST("/manual", deviceControl, handlers.ManualUV)
+			uv.POST("/manual/stop", deviceControl, handlers.StopManualUV)
 			uv.GET("/status", handlers.GetUVStatus)
+			uv.POST("/override", deviceControl, handlers.SetUVOverride)
+			uv.DELETE("/override", deviceControl, handlers.ClearUVOverride)
+		}
+
+		// Generic device routes (any registered device type)
+		deviceRoutes := api.Group("/devices")
+		{
+			deviceRoutes.GET("", handlers.GetDevices)
+			deviceRoutes.GET("/:id", handlers.GetDevice)
+			deviceRoutes.POST("/:id/command", deviceControl, handlers.SendDeviceCommand)
 		}
 
 		// History routes
 		api.GET("/history", handlers.GetHistory)
+		api.GET("/history/:id/timeline", handlers.GetActionTimeline)
+
+		// Statistics routes
+		api.GET("/stats", handlers.GetStats)
+
+		// Export routes (?format=csv|ndjson|xlsx&from=&to=)
+		api.GET("/export/history", handlers.ExportHistory)
+		api.GET("/export/sensors", handlers.ExportSensors)
 
 		// Stock routes
 		api.GET("/stock", handlers.GetStock)
-		api.PUT("/stock", handlers.UpdateStock)
+		api.PUT("/stock", middleware.RequirePermission(auth.PermStockWrite), handlers.UpdateStock)
 
 		// Sensor routes
 		sensors := api.Group("/sensors")
 		{
+			sensors.GET("/metrics", handlers.GetSensorMetrics)
 			sensors.GET("/current", handlers.GetCurrentSensor)
 			sensors.GET("/history", handlers.GetSensorHistory)
-			sensors.POST("/inject", handlers.InjectSensorData) // For testing/demo
+			sensors.GET("/aggregate", handlers.GetSensorAggregate)
+			sensors.POST("/inject", adminDemo, handlers.InjectSensorData) // For testing/demo
+
+			sensorCalibrate := middleware.RequirePermission(auth.PermSensorCalibrate)
+			sensors.GET("/calibrations", handlers.GetSensorCalibrations)
+			sensors.PUT("/calibrations", sensorCalibrate, handlers.UpsertSensorCalibration)
+			sensors.DELETE("/calibrations/:id", sensorCalibrate, handlers.DeleteSensorCalibration)
 		}
 
 		// Demo routes
-		api.POST("/demo/seed", handlers.SeedDemoData)
-		api.POST("/demo/clear", handlers.ClearDemoData)
+		api.POST("/demo/seed", adminDemo, handlers.SeedDemoData)
+		api.POST("/demo/clear", adminDemo, handlers.ClearDemoData)
+
+		// Alert routes
+		alerts := api.Group("/alerts")
+		{
+			alertWrite := middleware.RequirePermission(auth.PermAlertWrite)
+			alerts.GET("", handlers.GetAlerts)
+			alerts.POST("/:id/ack", alertWrite, handlers.AcknowledgeAlert)
+			alerts.GET("/rules", handlers.GetAlertRules)
+			alerts.POST("/rules", alertWrite, handlers.CreateAlertRule)
+			alerts.PUT("/rules/:id", alertWrite, handlers.UpdateAlertRule)
+			alerts.DELETE("/rules/:id", alertWrite, handlers.DeleteAlertRule)
+		}
+
+		// Notification routes
+		notifications := api.Group("/notifications")
+		{
+			notifyWrite := middleware.RequirePermission(auth.PermNotifyWrite)
+			notifications.GET("/channels", handlers.GetNotificationChannels)
+			notifications.POST("/channels", notifyWrite, handlers.CreateNotificationChannel)
+			notifications.PUT("/channels/:id", notifyWrite, handlers.UpdateNotificationChannel)
+			notifications.DELETE("/channels/:id", notifyWrite, handlers.DeleteNotificationChannel)
+			notifications.POST("/channels/:id/test", notifyWrite, handlers.TestNotificationChannel)
+			notifications.GET("/deliveries", notifyWrite, handlers.GetNotificationDeliveries)
+		}
+
+		// Automation routes
+		automations := api.Group("/automations")
+		{
+			automationWrite := middleware.RequirePermission(auth.PermAutomationWrite)
+			automations.GET("", handlers.GetAutomations)
+			automations.GET("/:id", handlers.GetAutomation)
+			automations.POST("", automationWrite, handlers.CreateAutomation)
+			automations.PUT("/:id", automationWrite, handlers.UpdateAutomation)
+			automations.DELETE("/:id", automationWrite, handlers.DeleteAutomation)
+			automations.POST("/:id/run", automationWrite, handlers.RunAutomation)
+		}
+
+		// Data retention
+		retention := api.Group("/retention")
+		retention.Use(middleware.RequirePermission(auth.PermDataManage))
+		{
+			retention.GET("/dry-run", handlers.GetRetentionDryRun)
+			retention.POST("/run", handlers.RunRetention)
+		}
+
+		// Runtime diagnostics (MQTT, scheduler)
+		api.GET("/diagnostics", middleware.RequirePermission(auth.PermSystemRead), handlers.GetDiagnostics)
+
+		// Audit log
+		api.GET("/audit", middleware.RequirePermission(auth.PermAuditRead), handlers.GetAuditLogs)
+
+		// Backup and restore
+		dataManage := middleware.RequirePermission(auth.PermDataManage)
+		api.GET("/admin/backup", dataManage, handlers.GetBackup)
+		api.POST("/admin/restore", dataManage, handlers.RestoreBackup)
+
+		// Admin routes (users and roles)
+		admin := api.Group("/admin")
+		admin.Use(middleware.RequirePermission(auth.PermAdminUsers))
+		{
+			admin.GET("/users", handlers.GetUsers)
+			admin.POST("/users", handlers.CreateUser)
+			admin.PUT("/users/:id", handlers.UpdateUser)
+			admin.DELETE("/users/:id", handlers.DeleteUser)
+			admin.GET("/roles", handlers.GetRoles)
+			admin.POST("/roles", handlers.CreateRole)
+			admin.PUT("/roles/:name", handlers.UpdateRole)
+			admin.DELETE("/roles/:name", handlers.DeleteRole)
+		}
 	}
 
 	return r
 }
+
+func containsWildcard(origins []string) bool {
+	for _, origin := range origins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsAuth requires "Authorization: Bearer <token>" when token is set
+func metricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" && c.GetHeader("Authorization") != "Bearer "+token {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,353 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/commands"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/notify"
+	"iot-backend-cursor/sensors"
+)
+
+var (
+	// mu guards cooldown checks and edge state so a rule can't fire twice concurrently
+	mu sync.Mutex
+
+	// matched remembers whether a SENSOR or DEVICE_OFFLINE trigger matched on
+	// the previous evaluation; these rules fire only when it becomes true
+	matched = make(map[uint]bool)
+)
+
+// InitRules subscribes the engine to sensor readings and action results
+func InitRules() {
+	events.Subscribe(events.SensorReading, onSensorReading)
+	events.Subscribe(events.ActionFinished, onActionFinished)
+	slog.Info("automation rules engine started")
+}
+
+// loadRules returns the active, valid rules with the given trigger type
+func loadRules(triggerType string) []*Parsed {
+	var rules []models.AutomationRule
+	if err := database.DB.Where("trigger_type = ? AND is_active = ?", triggerType, true).Find(&rules).Error; err != nil {
+		slog.Error("error loading automation rules", "trigger_type", triggerType, "error", err)
+		return nil
+	}
+
+	parsed := make([]*Parsed, 0, len(rules))
+	for _, rule := range rules {
+		p, err := Parse(rule)
+		if err != nil {
+			slog.Warn("skipping invalid automation rule", "rule_id", rule.ID, "rule_name", rule.Name, "error", err)
+			continue
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed
+}
+
+func onSensorReading(e events.Event) {
+	for _, p := range loadRules(TriggerSensor) {
+		if p.Trigger.Metric != e.Metric {
+			continue
+		}
+		match := compare(e.Value, p.Trigger.Operator, p.Trigger.Value)
+		if becameTrue(p.Rule.ID, match) {
+			tryFire(p, fmt.Sprintf("%s is %.2f (%s %.2f)", e.Metric, e.Value, p.Trigger.Operator, p.Trigger.Value))
+		}
+	}
+}
+
+func onActionFinished(e events.Event) {
+	action, ok := e.Subject.(*models.ActionHistory)
+	if !ok {
+		return
+	}
+
+	for _, p := range loadRules(TriggerActionStatus) {
+		t := p.Trigger
+		if !strings.EqualFold(t.DeviceType, action.DeviceType) || !strings.EqualFold(t.Status, string(action.Status)) {
+			continue
+		}
+
+		count := t.Count
+		if count < 1 {
+			count = 1
+		}
+		window := t.WithinMinutes
+		if window == 0 {
+			window = 60
+		}
+
+		// Only count occurrences since the rule last fired, so "failed twice"
+		// needs two new failures before firing again
+		since := time.Now().Add(-time.Duration(window) * time.Minute)
+		if p.Rule.LastFiredAt != nil && p.Rule.LastFiredAt.After(since) {
+			since = *p.Rule.LastFiredAt
+		}
+
+		var n int64
+		database.DB.Model(&models.ActionHistory{}).
+			Where("device_type = ? AND status = ? AND updated_at >= ?", action.DeviceType, action.Status, since).
+			Count(&n)
+
+		if int(n) >= count {
+			tryFire(p, fmt.Sprintf("%s action ended %s %d time(s) within %d minutes", action.DeviceType, action.Status, n, window))
+		}
+	}
+}
+
+// CheckTimers evaluates TIME and DEVICE_OFFLINE rules. Called every minute by the scheduler.
+func CheckTimers() {
+	now := time.Now()
+	currentDay := now.Weekday().String()[:3]
+
+	for _, p := range loadRules(TriggerTime) {
+		hour, minute, _ := parseClock(p.Trigger.Time)
+		if hour != now.Hour() || minute != now.Minute() {
+			continue
+		}
+		if len(p.Trigger.Days) > 0 && !containsDay(p.Trigger.Days, currentDay) {
+			continue
+		}
+		// Don't fire twice in the same minute if the cooldown is short
+		if p.Rule.LastFiredAt != nil && now.Sub(*p.Rule.LastFiredAt) < time.Minute {
+			continue
+		}
+		tryFire(p, fmt.Sprintf("time is %s", p.Trigger.Time))
+	}
+
+	for _, p := range loadRules(TriggerDeviceOffline) {
+		lastSeen, ok := deviceLastSeen(p.Trigger.DeviceType)
+		offline := !ok || now.Sub(lastSeen) > time.Duration(p.Trigger.Minutes)*time.Minute
+		if becameTrue(p.Rule.ID, offline) {
+			tryFire(p, fmt.Sprintf("%s offline for more than %d minutes", p.Trigger.DeviceType, p.Trigger.Minutes))
+		}
+	}
+}
+
+// becameTrue records the trigger state and reports a false -> true transition
+func becameTrue(ruleID uint, match bool) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	previous := matched[ruleID]
+	matched[ruleID] = match
+	return match && !previous
+}
+
+// tryFire checks cooldown and conditions, then runs the rule's actions in the background
+func tryFire(p *Parsed, reason string) {
+	mu.Lock()
+
+	// Reload to see the latest LastFiredAt
+	var rule models.AutomationRule
+	if err := database.DB.First(&rule, p.Rule.ID).Error; err != nil || !rule.IsActive {
+		mu.Unlock()
+		return
+	}
+
+	ctx := logging.With(logging.NewContext("automation"), "rule_id", rule.ID, "rule_name", rule.Name)
+	logger := logging.FromContext(ctx)
+
+	now := time.Now()
+	if rule.LastFiredAt != nil && now.Sub(*rule.LastFiredAt) < time.Duration(rule.CooldownSeconds)*time.Second {
+		mu.Unlock()
+		logger.Debug("automation rule in cooldown, skipping")
+		return
+	}
+
+	for i, c := range p.Conditions {
+		if !conditionHolds(c) {
+			mu.Unlock()
+			logger.Debug("automation rule triggered but condition not met", "reason", reason, "condition", i+1)
+			return
+		}
+	}
+
+	database.DB.Model(&rule).Update("last_fired_at", now)
+	mu.Unlock()
+
+	logger.Info("automation rule fired", "reason", reason)
+
+	// Actions publish commands and events; run them outside the caller so
+	// events they cause can't re-enter the engine while it holds mu
+	go execute(ctx, p, reason)
+}
+
+// Run executes a rule's actions immediately, ignoring trigger, conditions and cooldown
+func Run(ctx context.Context, rule models.AutomationRule) (string, error) {
+	p, err := Parse(rule)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	database.DB.Model(&rule).Update("last_fired_at", now)
+	ctx = logging.With(ctx, "rule_id", rule.ID, "rule_name", rule.Name)
+	return execute(ctx, p, "manual run"), nil
+}
+
+func execute(ctx context.Context, p *Parsed, reason string) string {
+	results := make([]string, 0, len(p.Actions))
+	for _, action := range p.Actions {
+		if err := runAction(ctx, p.Rule, action, reason); err != nil {
+			logging.FromContext(ctx).Error("automation rule action failed", "action", action.Type, "error", err)
+			results = append(results, fmt.Sprintf("%s: %v", action.Type, err))
+		} else {
+			results = append(results, action.Type+": ok")
+		}
+	}
+
+	result := strings.Join(results, "; ")
+	database.DB.Model(&models.AutomationRule{}).Where("id = ?", p.Rule.ID).Update("last_result", result)
+	return result
+}
+
+func runAction(ctx context.Context, rule models.AutomationRule, action Action, reason string) error {
+	switch action.Type {
+	case ActionFeederCommand:
+		feeder, _ := devices.Get(devices.Feeder)
+		return runDeviceCommand(ctx, feeder, "", 0, action.AmountGram)
+	case ActionUVCommand:
+		uv, _ := devices.Get(devices.UV)
+		return runDeviceCommand(ctx, uv, action.State, action.DurationMinutes*60, 0)
+	case ActionDeviceCommand:
+		deviceType, ok := devices.Get(action.DeviceType)
+		if !ok {
+			return fmt.Errorf("unknown device type: %s", action.DeviceType)
+		}
+		return runDeviceCommand(ctx, deviceType, action.State, action.DurationMinutes*60, action.Amount)
+	case ActionNotify:
+		title := action.Title
+		if title == "" {
+			title = "Automation: " + rule.Name
+		}
+		notify.Notify(notify.Notification{
+			EventType: notify.EventAutomation,
+			Title:     title,
+			Message:   action.Message,
+			Data:      map[string]interface{}{"rule_id": rule.ID, "rule_name": rule.Name, "reason": reason},
+		})
+		return nil
+	case ActionSetScheduleActive:
+		return setSchedulesActive(ctx, action.Schedule, action.ScheduleID, *action.Active)
+	}
+	return fmt.Errorf("unknown action type: %s", action.Type)
+}
+
+// runDeviceCommand sends an ON/OFF or dose command; ON without a duration stays on
+func runDeviceCommand(ctx context.Context, deviceType *devices.Type, state string, durationSec, amount int) error {
+	if deviceType.HasCapability(devices.CapDose) {
+		_, err := commands.Dose(ctx, deviceType, amount, "AUTOMATION")
+		return err
+	}
+	if state == "ON" {
+		_, err := commands.TurnOn(ctx, deviceType, durationSec, "AUTOMATION")
+		return err
+	}
+	_, err := commands.TurnOff(ctx, deviceType, models.ActionStopped, "automation rule")
+	return err
+}
+
+func setSchedulesActive(ctx context.Context, schedule string, scheduleID uint, active bool) error {
+	var model interface{}
+	switch schedule {
+	case "feeder":
+		model = &models.PakanSchedule{}
+	case "uv":
+		model = &models.UVSchedule{}
+	default:
+		return fmt.Errorf("unknown schedule: %s", schedule)
+	}
+
+	query := database.DB.Model(model)
+	if scheduleID != 0 {
+		query = query.Where("id = ?", scheduleID)
+	} else {
+		query = query.Where("1 = 1")
+	}
+
+	result := query.Update("is_active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	logging.FromContext(ctx).Info("automation set schedules active", "schedule", schedule, "schedule_id", scheduleID, "is_active", active, "rows", result.RowsAffected)
+	return nil
+}
+
+func conditionHolds(c Condition) bool {
+	switch c.Type {
+	case ConditionSensor:
+		latest, err := sensors.Latest(c.Metric, "")
+		if err != nil {
+			return false
+		}
+		return compare(latest.Value, c.Operator, c.Value)
+
+	case ConditionStock:
+		var stock models.Stock
+		if err := database.DB.First(&stock).Error; err != nil {
+			return false
+		}
+		return compare(float64(stock.AmountGram), c.Operator, c.Value)
+
+	case ConditionDeviceStatus:
+		var status models.DeviceStatus
+		if err := database.DB.Where("device_type = ?", c.DeviceType).First(&status).Error; err != nil {
+			return false
+		}
+		return strings.EqualFold(status.Status, c.Status)
+
+	case ConditionTimeBetween:
+		return clockBetween(c.Start, c.End, time.Now())
+	}
+	return false
+}
+
+// clockBetween reports whether the time of day of t is within [start, end).
+// A range whose end is before its start crosses midnight.
+func clockBetween(start, end string, t time.Time) bool {
+	current := t.Hour()*60 + t.Minute()
+	startHour, startMinute, _ := parseClock(start)
+	endHour, endMinute, _ := parseClock(end)
+	from := startHour*60 + startMinute
+	to := endHour*60 + endMinute
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
+}
+
+// deviceLastSeen returns when a device last reported. SENSOR uses the latest sensor reading.
+func deviceLastSeen(deviceType string) (time.Time, bool) {
+	if strings.EqualFold(deviceType, sensorDevice) {
+		var latest models.SensorReading
+		if err := database.DB.Order("recorded_at DESC").First(&latest).Error; err != nil {
+			return time.Time{}, false
+		}
+		return latest.RecordedAt, true
+	}
+
+	var status models.DeviceStatus
+	if err := database.DB.Where("device_type = ?", deviceType).First(&status).Error; err != nil || status.LastUpdated.IsZero() {
+		return time.Time{}, false
+	}
+	return status.LastUpdated, true
+}
+
+func containsDay(days []string, day string) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
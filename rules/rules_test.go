@@ -0,0 +1,198 @@
+package rules
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AutomationRule{}, &models.ActionHistory{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+
+	mu.Lock()
+	matched = make(map[uint]bool)
+	mu.Unlock()
+}
+
+func createRule(t *testing.T, triggerType, trigger string) uint {
+	t.Helper()
+	rule := models.AutomationRule{
+		Name:        triggerType,
+		TriggerType: triggerType,
+		Trigger:     trigger,
+		Actions:     `[{"type": "notify", "message": "test"}]`,
+		IsActive:    true,
+	}
+	if _, err := Parse(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rule.ID
+}
+
+// fired reports whether the rule fired since last, waiting for its actions to finish
+func fired(t *testing.T, ruleID uint, last *time.Time) bool {
+	t.Helper()
+	var rule models.AutomationRule
+	database.DB.First(&rule, ruleID)
+	if rule.LastFiredAt == nil || rule.LastFiredAt.Equal(*last) {
+		return false
+	}
+	*last = *rule.LastFiredAt
+
+	for deadline := time.Now().Add(time.Second); rule.LastResult == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("actions of the fired rule did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+		database.DB.First(&rule, ruleID)
+	}
+	database.DB.Model(&rule).Update("last_result", "")
+	return true
+}
+
+func TestValidate(t *testing.T) {
+	if err := devices.Register(devices.Type{Name: "TEST_PUMP", Capabilities: []string{devices.CapOnOff}, CommandTopic: "test/pump"}); err != nil {
+		t.Fatal(err)
+	}
+	notify := []Action{{Type: ActionNotify, Message: "hi"}}
+	active := true
+
+	tests := []struct {
+		name        string
+		triggerType string
+		trigger     Trigger
+		conditions  []Condition
+		actions     []Action
+		wantErr     bool
+	}{
+		{"sensor", TriggerSensor, Trigger{Metric: sensors.PH, Operator: OpLessThan, Value: 6.5}, nil, notify, false},
+		{"sensor unknown metric", TriggerSensor, Trigger{Metric: "salinity", Operator: OpLessThan}, nil, notify, true},
+		{"sensor unknown operator", TriggerSensor, Trigger{Metric: sensors.PH, Operator: "NE"}, nil, notify, true},
+		{"action status", TriggerActionStatus, Trigger{DeviceType: "FEEDER", Status: "FAILED", Count: 2, WithinMinutes: 30}, nil, notify, false},
+		{"action status without status", TriggerActionStatus, Trigger{DeviceType: "FEEDER"}, nil, notify, true},
+		{"action status negative count", TriggerActionStatus, Trigger{DeviceType: "FEEDER", Status: "FAILED", Count: -1}, nil, notify, true},
+		{"offline without minutes", TriggerDeviceOffline, Trigger{DeviceType: "SENSOR"}, nil, notify, true},
+		{"time", TriggerTime, Trigger{Time: "07:30", Days: []string{"Mon", "Sat"}}, nil, notify, false},
+		{"time out of range", TriggerTime, Trigger{Time: "24:00"}, nil, notify, true},
+		{"time not a clock", TriggerTime, Trigger{Time: "noon"}, nil, notify, true},
+		{"time unknown day", TriggerTime, Trigger{Time: "07:30", Days: []string{"Monday"}}, nil, notify, true},
+		{"unknown trigger", "WEBHOOK", Trigger{}, nil, notify, true},
+		{"time between across midnight", TriggerTime, Trigger{Time: "07:30"}, []Condition{{Type: ConditionTimeBetween, Start: "22:00", End: "06:00"}}, notify, false},
+		{"time between bad end", TriggerTime, Trigger{Time: "07:30"}, []Condition{{Type: ConditionTimeBetween, Start: "22:00", End: "6"}}, notify, true},
+		{"stock condition bad operator", TriggerTime, Trigger{Time: "07:30"}, []Condition{{Type: ConditionStock, Operator: "LESS"}}, notify, true},
+		{"no actions", TriggerTime, Trigger{Time: "07:30"}, nil, nil, true},
+		{"uv on without duration", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionUVCommand, State: "ON"}}, true},
+		{"uv off", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionUVCommand, State: "OFF"}}, false},
+		{"device command", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionDeviceCommand, DeviceType: "test_pump", State: "ON"}}, false},
+		{"device command unknown device", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionDeviceCommand, DeviceType: "CO2", State: "ON"}}, true},
+		{"schedule without active", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionSetScheduleActive, Schedule: "uv"}}, true},
+		{"schedule", TriggerTime, Trigger{Time: "07:30"}, nil, []Action{{Type: ActionSetScheduleActive, Schedule: "feeder", Active: &active}}, false},
+	}
+
+	for _, tt := range tests {
+		p := &Parsed{
+			Rule:       models.AutomationRule{TriggerType: tt.triggerType},
+			Trigger:    tt.trigger,
+			Conditions: tt.conditions,
+			Actions:    tt.actions,
+		}
+		if err := p.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClockBetween(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2026, 1, 1, hour, minute, 0, 0, time.Local) }
+
+	tests := []struct {
+		start, end string
+		t          time.Time
+		want       bool
+	}{
+		{"08:00", "17:00", at(8, 0), true},
+		{"08:00", "17:00", at(16, 59), true},
+		{"08:00", "17:00", at(17, 0), false},
+		{"08:00", "17:00", at(7, 59), false},
+		{"22:00", "06:00", at(23, 30), true},
+		{"22:00", "06:00", at(0, 0), true},
+		{"22:00", "06:00", at(5, 59), true},
+		{"22:00", "06:00", at(6, 0), false},
+		{"22:00", "06:00", at(12, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := clockBetween(tt.start, tt.end, tt.t); got != tt.want {
+			t.Errorf("clockBetween(%s, %s, %s) = %v, want %v", tt.start, tt.end, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestSensorTriggerFiresOnEdge(t *testing.T) {
+	setupDB(t)
+	id := createRule(t, TriggerSensor, `{"metric": "temperature", "operator": "GT", "value": 30}`)
+	var last time.Time
+
+	for i, step := range []struct {
+		value float64
+		fires bool
+	}{
+		{29, false},
+		{31, true},
+		{32, false}, // still above: no new edge
+		{29, false},
+		{31.5, true},
+	} {
+		onSensorReading(events.Event{Type: events.SensorReading, Metric: sensors.Temperature, Value: step.value})
+		if got := fired(t, id, &last); got != step.fires {
+			t.Errorf("step %d (%v): fired = %v, want %v", i+1, step.value, got, step.fires)
+		}
+	}
+}
+
+func TestActionStatusCountsSinceLastFired(t *testing.T) {
+	setupDB(t)
+	id := createRule(t, TriggerActionStatus, `{"device_type": "FEEDER", "status": "FAILED", "count": 2, "within_minutes": 60}`)
+	var last time.Time
+
+	fail := func() {
+		action := models.ActionHistory{DeviceType: "FEEDER", TriggerSource: "SCHEDULE", Status: models.ActionFailed, StartTime: time.Now()}
+		if err := database.DB.Create(&action).Error; err != nil {
+			t.Fatal(err)
+		}
+		onActionFinished(events.Event{Type: events.ActionFinished, Subject: &action})
+	}
+
+	// Successes are not counted as failures
+	success := models.ActionHistory{DeviceType: "FEEDER", TriggerSource: "MANUAL", Status: models.ActionSuccess, StartTime: time.Now()}
+	database.DB.Create(&success)
+	onActionFinished(events.Event{Type: events.ActionFinished, Subject: &success})
+
+	for i, fires := range []bool{false, true, false, true} {
+		fail()
+		if got := fired(t, id, &last); got != fires {
+			t.Errorf("failure %d: fired = %v, want %v", i+1, got, fires)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+)
+
+// Trigger types
+const (
+	TriggerSensor        = "SENSOR"         // a sensor reading crosses a value
+	TriggerActionStatus  = "ACTION_STATUS"  // an action ends with a status, optionally N times within a window
+	TriggerDeviceOffline = "DEVICE_OFFLINE" // no update from a device for N minutes
+	TriggerTime          = "TIME"           // a time of day on selected days
+)
+
+// Condition types
+const (
+	ConditionSensor       = "sensor"        // latest reading of a metric compared to a value
+	ConditionDeviceStatus = "device_status" // device is in a status
+	ConditionStock        = "stock"         // food stock compared to a value
+	ConditionTimeBetween  = "time_between"  // current time within HH:MM-HH:MM (may cross midnight)
+)
+
+// Action types
+const (
+	ActionFeederCommand     = "feeder_command"      // feed amount_gram
+	ActionUVCommand         = "uv_command"          // turn UV ON for duration_minutes, or OFF
+	ActionNotify            = "notify"              // send a notification
+	ActionSetScheduleActive = "set_schedule_active" // enable/disable feeder or UV schedules
+	ActionDeviceCommand     = "device_command"      // ON/OFF or dose command to any registered device
+)
+
+// Comparison operators
+const (
+	OpGreaterThan      = "GT"
+	OpGreaterThanEqual = "GTE"
+	OpLessThan         = "LT"
+	OpLessThanEqual    = "LTE"
+	OpEqual            = "EQ"
+)
+
+// sensorDevice is the pseudo device type for DEVICE_OFFLINE on the DHT sensor
+const sensorDevice = "SENSOR"
+
+// Trigger holds the settings of every trigger type; only the fields of
+// the rule's trigger type are used
+type Trigger struct {
+	// SENSOR
+	Metric   string  `json:"metric,omitempty"`
+	Operator string  `json:"operator,omitempty"`
+	Value    float64 `json:"value,omitempty"`
+
+	// ACTION_STATUS and DEVICE_OFFLINE
+	DeviceType string `json:"device_type,omitempty"`
+
+	// ACTION_STATUS
+	Status        string `json:"status,omitempty"`
+	Count         int    `json:"count,omitempty"`          // defaults to 1
+	WithinMinutes int    `json:"within_minutes,omitempty"` // window for Count, defaults to 60
+
+	// DEVICE_OFFLINE
+	Minutes int `json:"minutes,omitempty"`
+
+	// TIME
+	Time string   `json:"time,omitempty"` // HH:MM
+	Days []string `json:"days,omitempty"` // Mon..Sun, empty means every day
+}
+
+// Condition must hold for the rule's actions to run
+type Condition struct {
+	Type       string  `json:"type"`
+	Metric     string  `json:"metric,omitempty"`
+	Operator   string  `json:"operator,omitempty"`
+	Value      float64 `json:"value,omitempty"`
+	DeviceType string  `json:"device_type,omitempty"`
+	Status     string  `json:"status,omitempty"`
+	Start      string  `json:"start,omitempty"`
+	End        string  `json:"end,omitempty"`
+}
+
+// Action is executed when a rule fires
+type Action struct {
+	Type string `json:"type"`
+
+	// feeder_command
+	AmountGram int `json:"amount_gram,omitempty"`
+
+	// uv_command, device_command
+	State           string `json:"state,omitempty"` // ON, OFF
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+
+	// device_command
+	DeviceType string `json:"device_type,omitempty"`
+	Amount     int    `json:"amount,omitempty"` // dose devices
+
+	// notify
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// set_schedule_active
+	Schedule   string `json:"schedule,omitempty"`    // feeder, uv
+	ScheduleID uint   `json:"schedule_id,omitempty"` // 0 means all schedules of that kind
+	Active     *bool  `json:"active,omitempty"`
+}
+
+// Parsed is a rule with its JSON settings decoded
+type Parsed struct {
+	Rule       models.AutomationRule
+	Trigger    Trigger
+	Conditions []Condition
+	Actions    []Action
+}
+
+// Parse decodes and validates the JSON settings of rule
+func Parse(rule models.AutomationRule) (*Parsed, error) {
+	p := &Parsed{Rule: rule}
+
+	if rule.Trigger != "" {
+		if err := json.Unmarshal([]byte(rule.Trigger), &p.Trigger); err != nil {
+			return nil, fmt.Errorf("invalid trigger: %v", err)
+		}
+	}
+	if rule.Conditions != "" {
+		if err := json.Unmarshal([]byte(rule.Conditions), &p.Conditions); err != nil {
+			return nil, fmt.Errorf("invalid conditions: %v", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(rule.Actions), &p.Actions); err != nil {
+		return nil, fmt.Errorf("invalid actions: %v", err)
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Parsed) validate() error {
+	t := p.Trigger
+
+	switch p.Rule.TriggerType {
+	case TriggerSensor:
+		if !isMetric(t.Metric) {
+			return fmt.Errorf("trigger: unknown metric %q", t.Metric)
+		}
+		if !isOperator(t.Operator) {
+			return fmt.Errorf("trigger: unknown operator %q", t.Operator)
+		}
+	case TriggerActionStatus:
+		if t.DeviceType == "" || t.Status == "" {
+			return errors.New("trigger: device_type and status are required")
+		}
+		if t.Count < 0 || t.WithinMinutes < 0 {
+			return errors.New("trigger: count and within_minutes cannot be negative")
+		}
+	case TriggerDeviceOffline:
+		if t.DeviceType == "" || t.Minutes <= 0 {
+			return errors.New("trigger: device_type and minutes > 0 are required")
+		}
+	case TriggerTime:
+		if _, _, err := parseClock(t.Time); err != nil {
+			return fmt.Errorf("trigger: time must be HH:MM")
+		}
+		for _, day := range t.Days {
+			if !isDay(day) {
+				return fmt.Errorf("trigger: unknown day %q", day)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown trigger_type: %s", p.Rule.TriggerType)
+	}
+
+	for i, c := range p.Conditions {
+		switch c.Type {
+		case ConditionSensor:
+			if !isMetric(c.Metric) || !isOperator(c.Operator) {
+				return fmt.Errorf("condition %d: metric and operator are required", i+1)
+			}
+		case ConditionStock:
+			if !isOperator(c.Operator) {
+				return fmt.Errorf("condition %d: unknown operator %q", i+1, c.Operator)
+			}
+		case ConditionDeviceStatus:
+			if c.DeviceType == "" || c.Status == "" {
+				return fmt.Errorf("condition %d: device_type and status are required", i+1)
+			}
+		case ConditionTimeBetween:
+			if _, _, err := parseClock(c.Start); err != nil {
+				return fmt.Errorf("condition %d: start must be HH:MM", i+1)
+			}
+			if _, _, err := parseClock(c.End); err != nil {
+				return fmt.Errorf("condition %d: end must be HH:MM", i+1)
+			}
+		default:
+			return fmt.Errorf("condition %d: unknown type %q", i+1, c.Type)
+		}
+	}
+
+	if len(p.Actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+	for i, a := range p.Actions {
+		switch a.Type {
+		case ActionFeederCommand:
+			if a.AmountGram < 0 {
+				return fmt.Errorf("action %d: amount_gram cannot be negative", i+1)
+			}
+		case ActionUVCommand:
+			if a.State != "ON" && a.State != "OFF" {
+				return fmt.Errorf("action %d: state must be ON or OFF", i+1)
+			}
+			if a.State == "ON" && a.DurationMinutes <= 0 {
+				return fmt.Errorf("action %d: duration_minutes must be greater than 0", i+1)
+			}
+		case ActionDeviceCommand:
+			deviceType, ok := devices.Get(a.DeviceType)
+			if !ok {
+				return fmt.Errorf("action %d: unknown device_type %q", i+1, a.DeviceType)
+			}
+			if deviceType.HasCapability(devices.CapDose) {
+				if a.Amount <= 0 {
+					return fmt.Errorf("action %d: amount must be greater than 0", i+1)
+				}
+			} else if a.State != "ON" && a.State != "OFF" {
+				return fmt.Errorf("action %d: state must be ON or OFF", i+1)
+			}
+		case ActionNotify:
+			if a.Message == "" {
+				return fmt.Errorf("action %d: message is required", i+1)
+			}
+		case ActionSetScheduleActive:
+			if a.Schedule != "feeder" && a.Schedule != "uv" {
+				return fmt.Errorf("action %d: schedule must be feeder or uv", i+1)
+			}
+			if a.Active == nil {
+				return fmt.Errorf("action %d: active is required", i+1)
+			}
+		default:
+			return fmt.Errorf("action %d: unknown type %q", i+1, a.Type)
+		}
+	}
+	return nil
+}
+
+func isMetric(metric string) bool {
+	return sensors.IsMetric(metric)
+}
+
+func isOperator(op string) bool {
+	switch op {
+	case OpGreaterThan, OpGreaterThanEqual, OpLessThan, OpLessThanEqual, OpEqual:
+		return true
+	}
+	return false
+}
+
+func isDay(day string) bool {
+	switch day {
+	case "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun":
+		return true
+	}
+	return false
+}
+
+func compare(value float64, op string, target float64) bool {
+	switch op {
+	case OpGreaterThan:
+		return value > target
+	case OpGreaterThanEqual:
+		return value >= target
+	case OpLessThan:
+		return value < target
+	case OpLessThanEqual:
+		return value <= target
+	case OpEqual:
+		return value == target
+	}
+	return false
+}
+
+func parseClock(s string) (hour, minute int, err error) {
+	if _, err = fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil {
+		return 0, 0, err
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, errors.New("out of range")
+	}
+	return hour, minute, nil
+}
@@ -1,31 +1,142 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"iot-backend-cursor/alerting"
+	"iot-backend-cursor/commands"
 	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/metrics"
 	"iot-backend-cursor/models"
 	"iot-backend-cursor/mqtt"
-	"iot-backend-cursor/utils"
+	"iot-backend-cursor/retention"
+	"iot-backend-cursor/rules"
+	"iot-backend-cursor/sensors"
+	"iot-backend-cursor/service"
 
 	"github.com/robfig/cron/v3"
 )
 
 var Cron *cron.Cron
 
+// manualSources are trigger sources of on/off runs with a fixed duration that
+// take priority over schedules and are turned off on expiry
+var manualSources = []string{"MANUAL", "AUTOMATION"}
+
+// Job describes a registered cron job for diagnostics
+type Job struct {
+	ID   cron.EntryID `json:"id"`
+	Name string       `json:"name"`
+	Spec string       `json:"spec"`
+	Next time.Time    `json:"next"`
+	Prev *time.Time   `json:"prev,omitempty"` // nil until the job has run
+}
+
+var (
+	jobsMu   sync.Mutex
+	jobs     = make(map[cron.EntryID]Job)
+	lastTick atomic.Int64 // unix nanoseconds of the latest job start
+	running  atomic.Bool
+)
+
 func InitScheduler() {
 	Cron = cron.New(cron.WithSeconds())
 
 	// Run every minute
-	Cron.AddFunc("0 * * * * *", checkSchedules)
+	addJob("0 * * * * *", "check_schedules", checkSchedules)
+
+	// Check manual UV (and other on/off device) expiration every 10 seconds
+	addJob("*/10 * * * * *", "check_manual_expiration", checkManualExpiration)
+
+	// Evaluate stale-data alert rules every minute
+	addJob("30 * * * * *", "alert_timers", alerting.EvaluateTimers)
 
-	// Check manual UV expiration every 10 seconds
-	Cron.AddFunc("*/10 * * * * *", checkManualUVExpiration)
+	// Evaluate time-based and device-offline automation rules every minute
+	addJob("5 * * * * *", "automation_timers", rules.CheckTimers)
 
+	// Roll up sensor readings into hourly and daily buckets
+	addJob("0 5 * * * *", "sensor_rollup", sensors.RollUp)
+
+	// Remove data past its retention period every night
+	addJob("0 30 3 * * *", "retention", retention.Enforce)
+
+	lastTick.Store(time.Now().UnixNano())
 	Cron.Start()
-	log.Println("Scheduler started")
+	running.Store(true)
+	slog.Info("scheduler started")
+}
+
+// addJob registers fn under name, recording each run for metrics and readiness
+func addJob(spec, name string, fn func()) {
+	job := metrics.Job(name, fn)
+	id, err := Cron.AddFunc(spec, func() {
+		lastTick.Store(time.Now().UnixNano())
+		job()
+	})
+	if err != nil {
+		slog.Error("invalid cron spec", "job", name, "spec", spec, "error", err)
+		return
+	}
+
+	jobsMu.Lock()
+	jobs[id] = Job{ID: id, Name: name, Spec: spec}
+	jobsMu.Unlock()
+}
+
+// Stop stops scheduling new runs and waits for running jobs to finish or ctx to be done
+func Stop(ctx context.Context) error {
+	if Cron == nil {
+		return nil
+	}
+	running.Store(false)
+
+	select {
+	case <-Cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Running reports whether the scheduler has been started
+func Running() bool {
+	return running.Load()
+}
+
+// LastTick returns when the latest job started (or the scheduler, before any job ran)
+func LastTick() time.Time {
+	return time.Unix(0, lastTick.Load())
+}
+
+// Jobs returns the registered jobs with their previous and next run times
+func Jobs() []Job {
+	if Cron == nil {
+		return nil
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	entries := Cron.Entries()
+	result := make([]Job, 0, len(entries))
+	for _, entry := range entries {
+		job := jobs[entry.ID]
+		job.ID = entry.ID
+		job.Next = entry.Next
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			job.Prev = &prev
+		}
+		result = append(result, job)
+	}
+	return result
 }
 
 func checkSchedules() {
@@ -35,19 +146,27 @@ func checkSchedules() {
 	currentHour := now.Hour()
 	currentMinute := now.Minute()
 
-	log.Printf("Checking schedules at %s %s", currentDay, currentTime)
+	// Actions created by this run carry its request ID
+	ctx := logging.With(logging.NewContext("scheduler"), "job", "check_schedules")
+	logging.FromContext(ctx).Debug("checking schedules", "day", currentDay, "time", currentTime)
 
-	// Check feeder schedules
-	checkFeederSchedules(currentDay, currentTime)
+	// Check feeder (and other dose device) schedules
+	for _, deviceType := range devices.WithCapability(devices.CapDose) {
+		checkDoseSchedules(logging.With(ctx, "device_type", deviceType.Name), deviceType, currentDay, currentTime)
+	}
 
-	// Check UV schedules
-	checkUVSchedules(currentDay, currentHour, currentMinute)
+	// Check UV (and other on/off device) schedules
+	for _, deviceType := range devices.WithCapability(devices.CapOnOff) {
+		checkOnOffSchedules(logging.With(ctx, "device_type", deviceType.Name), deviceType, currentDay, currentHour, currentMinute)
+	}
 }
 
-func checkFeederSchedules(dayName, timeStr string) {
+func checkDoseSchedules(ctx context.Context, deviceType *devices.Type, dayName, timeStr string) {
+	logger := logging.FromContext(ctx)
+
 	var schedules []models.PakanSchedule
-	if err := database.DB.Where("day_name = ? AND time = ? AND is_active = ?", dayName, timeStr, true).Find(&schedules).Error; err != nil {
-		log.Printf("Error checking feeder schedules: %v", err)
+	if err := database.DB.Where("device_type = ? AND day_name = ? AND time = ? AND is_active = ?", deviceType.Name, dayName, timeStr, true).Find(&schedules).Error; err != nil {
+		logger.Error("error checking schedules", "error", err)
 		return
 	}
 
@@ -58,55 +177,40 @@ func checkFeederSchedules(dayName, timeStr string) {
 
 		var existingAction models.ActionHistory
 		err := database.DB.Where("device_type = ? AND trigger_source = ? AND status IN ?",
-			"FEEDER", "SCHEDULE", []string{"PENDING", "RUNNING", "SUCCESS"}).
+			deviceType.Name, "SCHEDULE", []models.ActionStatus{models.ActionPending, models.ActionRunning, models.ActionSuccess}).
 			Where("start_time >= ? AND start_time <= ?", oneMinuteAgo, now).
 			First(&existingAction).Error
 
 		if err == nil {
-			log.Printf("Feeder schedule already processed at %s", timeStr)
+			logger.Info("schedule already processed", "schedule_id", schedule.ID, "time", timeStr)
+			metrics.SchedulesSkipped.WithLabelValues(deviceType.Name, "already_processed").Inc()
 			continue
 		}
 
-		// Create action history
-		action := models.ActionHistory{
-			DeviceType:    "FEEDER",
-			TriggerSource: "SCHEDULE",
-			StartTime:     time.Now(),
-			Status:        "PENDING",
-			Value:         schedule.AmountGram,
-		}
-
-		if err := database.DB.Create(&action).Error; err != nil {
-			log.Printf("Error creating feeder action: %v", err)
+		// Create action history and publish MQTT command
+		if _, err := commands.Dose(logging.With(ctx, "schedule_id", schedule.ID), deviceType, schedule.AmountGram, "SCHEDULE"); err != nil {
+			logger.Error("error triggering schedule", "schedule_id", schedule.ID, "error", err)
+			metrics.SchedulesSkipped.WithLabelValues(deviceType.Name, "error").Inc()
 			continue
 		}
+		metrics.SchedulesFired.WithLabelValues(deviceType.Name).Inc()
 
-		doses := utils.CalculateFeedDoses(schedule.AmountGram)
-
-		// Publish MQTT command
-		if err := mqtt.PublishFeederCommand(doses); err != nil {
-			log.Printf("Error publishing feeder command: %v", err)
-			action.Status = "FAILED"
-			database.DB.Save(&action)
-			continue
-		}
-
-		action.Status = "RUNNING"
-		database.DB.Save(&action)
-		log.Printf("Triggered feeder schedule: Day=%s, Time=%s, Amount=%dg", schedule.DayName, schedule.Time, schedule.AmountGram)
+		logger.Info("schedule triggered", "schedule_id", schedule.ID, "day", schedule.DayName, "time", schedule.Time, "amount_gram", schedule.AmountGram)
 	}
 }
 
-func checkUVSchedules(dayName string, currentHour, currentMinute int) {
+func checkOnOffSchedules(ctx context.Context, deviceType *devices.Type, dayName string, currentHour, currentMinute int) {
+	logger := logging.FromContext(ctx)
+
 	var schedules []models.UVSchedule
-	if err := database.DB.Where("day_name = ? AND is_active = ?", dayName, true).Find(&schedules).Error; err != nil {
-		log.Printf("Error checking UV schedules: %v", err)
+	if err := database.DB.Where("device_type = ? AND day_name = ? AND is_active = ?", deviceType.Name, dayName, true).Find(&schedules).Error; err != nil {
+		logger.Error("error checking schedules", "error", err)
 		return
 	}
 
-	// Check if there's a running manual UV (override)
+	// Check if there's a running manual or automation UV (override)
 	var manualUV models.ActionHistory
-	hasManualUV := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "MANUAL", "RUNNING").
+	hasManualUV := database.DB.Where("device_type = ? AND trigger_source IN ? AND status = ?", deviceType.Name, manualSources, models.ActionRunning).
 		Order("start_time DESC").
 		First(&manualUV).Error == nil
 
@@ -114,182 +218,207 @@ func checkUVSchedules(dayName string, currentHour, currentMinute int) {
 		// Check if manual UV has ended
 		if manualUV.EndTime != nil && time.Now().After(*manualUV.EndTime) {
 			// Manual UV ended, mark as success
-			manualUV.Status = "SUCCESS"
-			database.DB.Save(&manualUV)
+			if err := service.FinishAction(ctx, &manualUV, models.ActionSuccess, "manual run expired", 0); err != nil {
+				logger.Warn("error finishing manual run", "action_id", manualUV.ID, "error", err)
+			}
 			hasManualUV = false
 		} else {
-			log.Printf("Manual UV is active, skipping schedule check")
+			logger.Info("manual run is active, skipping schedule check", "action_id", manualUV.ID)
+			metrics.SchedulesSkipped.WithLabelValues(deviceType.Name, "manual_override").Inc()
 			return
 		}
 	}
 
+	// Manual, pause and force-off overrides hold schedules back until they expire
+	override, err := service.ActiveOverride(deviceType.Name)
+	if err != nil {
+		logger.Error("error checking override", "error", err)
+		return
+	}
+	if override != nil {
+		logger.Info("schedule override is active, skipping schedule check", "mode", override.Mode, "until", override.Until)
+		metrics.SchedulesSkipped.WithLabelValues(deviceType.Name, "override").Inc()
+		return
+	}
+
 	for _, schedule := range schedules {
 		startHour, startMin, err := parseTime(schedule.StartTime)
 		if err != nil {
-			log.Printf("Error parsing start time: %v", err)
+			logger.Warn("error parsing schedule start time", "schedule_id", schedule.ID, "error", err)
 			continue
 		}
 
 		endHour, endMin, err := parseTime(schedule.EndTime)
 		if err != nil {
-			log.Printf("Error parsing end time: %v", err)
+			logger.Warn("error parsing schedule end time", "schedule_id", schedule.ID, "error", err)
 			continue
 		}
 
 		// Check if current time is within schedule range
-		isWithinRange := false
-		currentTimeMinutes := currentHour*60 + currentMinute
-		startTimeMinutes := startHour*60 + startMin
-		endTimeMinutes := endHour*60 + endMin
-
-		if startTimeMinutes <= endTimeMinutes {
-			// Normal case: start <= end (e.g., 18:00 - 19:00 same day)
-			isWithinRange = currentTimeMinutes >= startTimeMinutes && currentTimeMinutes < endTimeMinutes
-		} else {
-			// Overnight case: start > end (e.g., 20:00 - 04:00 crosses midnight)
-			isWithinRange = currentTimeMinutes >= startTimeMinutes || currentTimeMinutes < endTimeMinutes
-		}
+		durationMinutes := minutesLeftInWindow(startHour*60+startMin, endHour*60+endMin, currentHour*60+currentMinute)
 
-		if isWithinRange {
+		if durationMinutes > 0 {
 			// Check if there is already a running schedule action
 			var runningSchedule models.ActionHistory
-			if err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "SCHEDULE", "RUNNING").
+			if err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", deviceType.Name, "SCHEDULE", models.ActionRunning).
 				Order("start_time DESC").
 				First(&runningSchedule).Error; err == nil {
 				if runningSchedule.EndTime != nil && time.Now().Before(*runningSchedule.EndTime) {
-					log.Printf("UV schedule already running (action ID %d)", runningSchedule.ID)
+					logger.Debug("schedule already running", "action_id", runningSchedule.ID)
 					continue
 				}
 			}
 
-			// Calculate end time and duration FIRST (before DB transaction)
-			var endTime time.Time
-			var durationMinutes int
-
-			if startTimeMinutes <= endTimeMinutes {
-				// Normal same-day schedule (e.g., 18:00 - 19:00)
-				if currentTimeMinutes >= startTimeMinutes && currentTimeMinutes < endTimeMinutes {
-					durationMinutes = endTimeMinutes - currentTimeMinutes
-				}
-			} else {
-				// Overnight schedule (e.g., 20:00 - 04:00)
-				if currentTimeMinutes >= startTimeMinutes {
-					// Before midnight (e.g., 23:00)
-					minutesUntilMidnight := (24*60 - currentTimeMinutes)
-					durationMinutes = minutesUntilMidnight + endTimeMinutes
-				} else if currentTimeMinutes < endTimeMinutes {
-					// After midnight (e.g., 02:00)
-					durationMinutes = endTimeMinutes - currentTimeMinutes
-				}
-			}
-
-			// Safety check: only proceed if duration is valid
-			if durationMinutes <= 0 {
-				log.Printf("Invalid duration calculated: %d minutes, skipping", durationMinutes)
-				continue
-			}
-
-			endTime = time.Now().Add(time.Duration(durationMinutes) * time.Minute)
+			// Calculate end time FIRST (before DB transaction)
+			endTime := time.Now().Add(time.Duration(durationMinutes) * time.Minute)
 			durationSec := durationMinutes * 60 // Convert to seconds
 
 			// Step 1: Publish MQTT FIRST (outside DB transaction to avoid locking)
-			if err := mqtt.PublishUVCommand("ON", durationSec); err != nil {
-				log.Printf("Error publishing UV command: %v", err)
+			if err := mqtt.PublishCommand(ctx, deviceType, devices.Command{State: "ON", DurationSec: durationSec}); err != nil {
+				logger.Error("error publishing schedule command", "schedule_id", schedule.ID, "error", err)
+				metrics.SchedulesSkipped.WithLabelValues(deviceType.Name, "error").Inc()
 				continue
 			}
 
-			// Step 2: FAST DB transaction (only insert/update, no external calls)
+			// Step 2: FAST DB transaction (action and device status, no external calls)
 			action := models.ActionHistory{
-				DeviceType:    "UV",
+				DeviceType:    deviceType.Name,
 				TriggerSource: "SCHEDULE",
 				StartTime:     time.Now(),
 				EndTime:       &endTime,
-				Status:        "RUNNING",
+				Status:        models.ActionRunning,
 				Value:         durationMinutes * 60, // Convert to seconds
+				RequestID:     logging.RequestID(ctx),
 			}
 
-			if err := database.DB.Create(&action).Error; err != nil {
-				log.Printf("Error creating UV action: %v", err)
+			if err := service.StartAction(ctx, &action, "ON"); err != nil {
+				logger.Error("error creating schedule action", "schedule_id", schedule.ID, "error", err)
 				continue
 			}
 
-			// Update device status (fast, no external dependency)
-			database.DB.Model(&models.DeviceStatus{}).Where("device_type = ?", "UV").Updates(map[string]interface{}{
-				"status":       "ON",
-				"remaining":    0,
-				"last_updated": time.Now(),
-			})
-
-			log.Printf("Triggered UV schedule: Day=%s, Start=%s, End=%s, Duration=%dm", schedule.DayName, schedule.StartTime, schedule.EndTime, durationMinutes)
+			metrics.SchedulesFired.WithLabelValues(deviceType.Name).Inc()
+			logger.Info("schedule triggered", "schedule_id", schedule.ID, "action_id", action.ID, "day", schedule.DayName,
+				"start", schedule.StartTime, "end", schedule.EndTime, "duration_minutes", durationMinutes)
 		} else {
-			// Outside schedule range, ensure UV is turned off if a schedule action is running
+			// Outside schedule range, ensure the device is turned off if a schedule action is running
 			var runningSchedule models.ActionHistory
-			if database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "SCHEDULE", "RUNNING").
+			if database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", deviceType.Name, "SCHEDULE", models.ActionRunning).
 				Order("start_time DESC").
 				First(&runningSchedule).Error == nil {
 
 				// Step 1: Send MQTT command FIRST (outside DB transaction)
-				if err := mqtt.PublishUVCommand("OFF", 0); err != nil {
-					log.Printf("Error turning OFF UV: %v", err)
+				if err := mqtt.PublishCommand(commands.ActionContext(ctx, &runningSchedule), deviceType, devices.Command{State: "OFF"}); err != nil {
+					logger.Error("error turning off device outside schedule", "action_id", runningSchedule.ID, "error", err)
 				} else {
-					// Step 2: FAST DB update (only after MQTT succeeds)
-					runningSchedule.Status = "SUCCESS"
-					now := time.Now()
-					runningSchedule.EndTime = &now
-					database.DB.Save(&runningSchedule)
-
-					database.DB.Model(&models.DeviceStatus{}).Where("device_type = ?", "UV").Updates(map[string]interface{}{
-						"status":       "OFF",
-						"remaining":    0,
-						"last_updated": now,
-					})
-					log.Printf("Turned OFF UV (outside schedule)")
+					// Step 2: FAST DB transaction (only after MQTT succeeds)
+					if err := service.StopRun(ctx, &runningSchedule, models.ActionSuccess, "schedule window ended"); err != nil {
+						logger.Error("error finishing schedule action", "action_id", runningSchedule.ID, "error", err)
+					} else {
+						logger.Info("turned off device outside schedule", "action_id", runningSchedule.ID)
+					}
 				}
 			}
 		}
 	}
 }
 
-func checkManualUVExpiration() {
-	// Find running manual UV actions
-	var manualUV models.ActionHistory
-	err := database.DB.Where("device_type = ? AND trigger_source = ? AND status = ?", "UV", "MANUAL", "RUNNING").
+func checkManualExpiration() {
+	ctx := logging.With(logging.NewContext("scheduler"), "job", "check_manual_expiration")
+	for _, deviceType := range devices.WithCapability(devices.CapOnOff) {
+		checkManualDeviceExpiration(ctx, deviceType)
+	}
+}
+
+func checkManualDeviceExpiration(ctx context.Context, deviceType *devices.Type) {
+	// Find running manual or automation actions
+	var manual models.ActionHistory
+	err := database.DB.Where("device_type = ? AND trigger_source IN ? AND status = ?", deviceType.Name, manualSources, models.ActionRunning).
 		Order("start_time DESC").
-		First(&manualUV).Error
+		First(&manual).Error
 
 	if err != nil {
-		// No running manual UV found
+		// Nothing running manually
 		return
 	}
 
-	// Check if manual UV has ended
-	if manualUV.EndTime != nil && time.Now().After(*manualUV.EndTime) {
-		log.Printf("Manual UV expired (Action ID: %d), sending OFF command", manualUV.ID)
+	// Check if the manual run has ended
+	if manual.EndTime != nil && time.Now().After(*manual.EndTime) {
+		ctx = commands.ActionContext(ctx, &manual)
+		logger := logging.FromContext(ctx)
+		logger.Info("manual run expired, sending OFF command")
 
 		// Send OFF command to ESP
-		if err := mqtt.PublishUVCommand("OFF", 0); err != nil {
-			log.Printf("Error sending UV OFF command: %v", err)
+		if err := mqtt.PublishCommand(ctx, deviceType, devices.Command{State: "OFF"}); err != nil {
+			logger.Error("error sending OFF command", "error", err)
 			return
 		}
 
-		// Update action history
-		now := time.Now()
-		manualUV.Status = "SUCCESS"
-		manualUV.EndTime = &now
-		database.DB.Save(&manualUV)
-
-		// Update device status
-		database.DB.Model(&models.DeviceStatus{}).Where("device_type = ?", "UV").Updates(map[string]interface{}{
-			"status":       "OFF",
-			"remaining":    0,
-			"last_updated": now,
-		})
-
-		log.Printf("Manual UV turned OFF successfully")
+		// Update action history and device status
+		if err := service.StopRun(ctx, &manual, models.ActionSuccess, "manual run expired"); err != nil {
+			logger.Error("error finishing manual run", "error", err)
+			return
+		}
+
+		logger.Info("manual run turned off")
+	}
+}
+
+// WindowEnd returns when the active schedule windows of an on/off device at t
+// end, the latest if several overlap. ok is false outside any window.
+func WindowEnd(deviceType string, t time.Time) (end time.Time, ok bool, err error) {
+	// Match schedules the way checkOnOffSchedules does, by today's day name
+	var schedules []models.UVSchedule
+	if err := database.DB.Where("device_type = ? AND day_name = ? AND is_active = ?", deviceType, t.Weekday().String()[:3], true).Find(&schedules).Error; err != nil {
+		return time.Time{}, false, err
 	}
+
+	currentMinutes := t.Hour()*60 + t.Minute()
+	for _, schedule := range schedules {
+		startHour, startMin, err := parseTime(schedule.StartTime)
+		if err != nil {
+			continue
+		}
+		endHour, endMin, err := parseTime(schedule.EndTime)
+		if err != nil {
+			continue
+		}
+
+		left := minutesLeftInWindow(startHour*60+startMin, endHour*60+endMin, currentMinutes)
+		if left <= 0 {
+			continue
+		}
+		windowEnd := t.Truncate(time.Minute).Add(time.Duration(left) * time.Minute)
+		if windowEnd.After(end) {
+			end, ok = windowEnd, true
+		}
+	}
+	return end, ok, nil
+}
+
+// minutesLeftInWindow returns the minutes from current until the window end,
+// or 0 if current is outside the window. All values are minutes since midnight.
+func minutesLeftInWindow(start, end, current int) int {
+	if start <= end {
+		// Normal case: start <= end (e.g., 18:00 - 19:00 same day)
+		if current >= start && current < end {
+			return end - current
+		}
+		return 0
+	}
+
+	// Overnight case: start > end (e.g., 20:00 - 04:00 crosses midnight)
+	if current >= start {
+		// Before midnight (e.g., 23:00)
+		return 24*60 - current + end
+	}
+	if current < end {
+		// After midnight (e.g., 02:00)
+		return end - current
+	}
+	return 0
 }
 
 func parseTime(timeStr string) (hour, minute int, err error) {
 	_, err = fmt.Sscanf(timeStr, "%d:%d", &hour, &minute)
 	return
-}
\ No newline at end of file
+}
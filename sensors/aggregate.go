@@ -0,0 +1,213 @@
+package sensors
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// Bucket sizes accepted by Aggregate
+var BucketSizes = map[string]time.Duration{
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// RollupBuckets are the bucket sizes precomputed into sensor_rollups
+var RollupBuckets = []string{"1h", "1d"}
+
+// MaxBuckets limits the points returned by one aggregate query
+const MaxBuckets = 5000
+
+// Bucket holds the statistics of one time bucket
+type Bucket struct {
+	Start time.Time `json:"bucket_start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Count int64     `json:"count"`
+}
+
+// bucketRow is a bucket as returned by the SQL aggregate
+type bucketRow struct {
+	Epoch int64
+	Min   float64
+	Max   float64
+	Avg   float64
+	Count int64
+}
+
+// BucketStart returns the start of the bucket containing t. Buckets are
+// aligned to local time so 1d buckets start at local midnight.
+func BucketStart(t time.Time, size time.Duration) time.Time {
+	_, zoneOffset := t.In(time.Local).Zone()
+	offset := int64(zoneOffset)
+	secs := int64(size.Seconds())
+	return time.Unix(floorDiv(t.Unix()+offset, secs)*secs-offset, 0)
+}
+
+// Aggregate returns min/max/avg/count per bucket of a metric between from
+// and to. from is rounded down to the bucket start. 1h and 1d buckets are
+// read from rollups where available and from raw readings for the rest.
+func Aggregate(metric, sensorID, bucket string, from, to time.Time) ([]Bucket, error) {
+	size, ok := BucketSizes[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket: %s", bucket)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from)/size > MaxBuckets {
+		return nil, fmt.Errorf("too many buckets (max %d), use a larger bucket or a shorter range", MaxBuckets)
+	}
+
+	from = BucketStart(from, size)
+	rawFrom := from
+	var buckets []Bucket
+
+	// Rollups only cover all sensors of a metric
+	if sensorID == "" && isRollupBucket(bucket) {
+		var rollups []models.SensorRollup
+		if err := database.DB.Where("metric = ? AND bucket = ? AND bucket_start >= ? AND bucket_start < ?", metric, bucket, from, to).
+			Order("bucket_start").
+			Find(&rollups).Error; err != nil {
+			return nil, err
+		}
+
+		for _, r := range rollups {
+			buckets = append(buckets, Bucket{Start: r.BucketStart, Min: r.Min, Max: r.Max, Avg: r.Avg, Count: r.Count})
+		}
+		if len(rollups) > 0 {
+			rawFrom = rollups[len(rollups)-1].BucketStart.Add(size)
+		}
+	}
+
+	if rawFrom.Before(to) {
+		rows, err := aggregateRaw(metric, sensorID, size, rawFrom, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			buckets = append(buckets, Bucket{Start: time.Unix(row.Epoch, 0), Min: row.Min, Max: row.Max, Avg: row.Avg, Count: row.Count})
+		}
+	}
+
+	return buckets, nil
+}
+
+// aggregateRaw groups raw readings into buckets in SQL
+func aggregateRaw(metric, sensorID string, size time.Duration, from, to time.Time) ([]bucketRow, error) {
+	query := database.DB.Model(&models.SensorReading{}).
+		Select(BucketExpr("recorded_at", size)+" AS epoch, MIN(value) AS min, MAX(value) AS max, AVG(value) AS avg, COUNT(*) AS count").
+		Where("metric = ? AND quality = ? AND recorded_at >= ? AND recorded_at < ?", metric, QualityGood, from, to)
+	if sensorID != "" {
+		query = query.Where("sensor_id = ?", sensorID)
+	}
+
+	var rows []bucketRow
+	err := query.Group("epoch").Order("epoch").Scan(&rows).Error
+	return rows, err
+}
+
+// BucketExpr returns the SQL expression for the bucket start (unix seconds)
+// of a timestamp column, aligned like BucketStart
+func BucketExpr(column string, size time.Duration) string {
+	secs := int64(size.Seconds())
+	offset := localOffset()
+
+	if database.DB.Dialector.Name() == "postgres" {
+		return fmt.Sprintf("(FLOOR((EXTRACT(EPOCH FROM %s) + %d) / %d) * %d - %d)::bigint", column, offset, secs, secs, offset)
+	}
+	// SQLite integer division truncates toward zero; timestamps are after 1970
+	return fmt.Sprintf("((CAST(strftime('%%s', %s) AS INTEGER) + %d) / %d) * %d - %d", column, offset, secs, secs, offset)
+}
+
+// RollUp computes rollups for complete buckets since the last run. Called
+// hourly by the scheduler. The last stored bucket is recomputed to pick up
+// late readings.
+func RollUp() {
+	for _, metric := range Metrics {
+		for _, bucket := range RollupBuckets {
+			if err := rollUpMetric(metric.Name, bucket); err != nil {
+				slog.Error("error rolling up sensor readings", "metric", metric.Name, "bucket", bucket, "error", err)
+			}
+		}
+	}
+}
+
+func rollUpMetric(metric, bucket string) error {
+	size := BucketSizes[bucket]
+	end := BucketStart(time.Now(), size)
+
+	var start time.Time
+	var last models.SensorRollup
+	if err := database.DB.Where("metric = ? AND bucket = ?", metric, bucket).Order("bucket_start DESC").First(&last).Error; err == nil {
+		start = last.BucketStart
+	} else {
+		var first models.SensorReading
+		if err := database.DB.Where("metric = ?", metric).Order("recorded_at ASC").First(&first).Error; err != nil {
+			return nil // no data yet
+		}
+		start = BucketStart(first.RecordedAt, size)
+	}
+
+	if !start.Before(end) {
+		return nil
+	}
+
+	rows, err := aggregateRaw(metric, "", size, start, end)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	rollups := make([]models.SensorRollup, 0, len(rows))
+	for _, row := range rows {
+		rollups = append(rollups, models.SensorRollup{
+			Metric:      metric,
+			Bucket:      bucket,
+			BucketStart: time.Unix(row.Epoch, 0),
+			Min:         row.Min,
+			Max:         row.Max,
+			Avg:         row.Avg,
+			Count:       row.Count,
+		})
+	}
+
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "metric"}, {Name: "bucket"}, {Name: "bucket_start"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min", "max", "avg", "count"}),
+	}).CreateInBatches(&rollups, 500).Error
+	if err == nil {
+		slog.Debug("rolled up sensor readings", "metric", metric, "bucket", bucket, "buckets", len(rollups))
+	}
+	return err
+}
+
+func isRollupBucket(bucket string) bool {
+	for _, b := range RollupBuckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// localOffset returns the current local UTC offset in seconds. SQL buckets
+// use a fixed offset, which is exact for zones without DST (Asia/Jakarta).
+func localOffset() int64 {
+	_, offset := time.Now().Zone()
+	return int64(offset)
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,120 @@
+package sensors
+
+import (
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SensorReading{}, &models.SensorRollup{}, &models.SensorCalibration{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+
+	lastSeen = make(map[string]Sample)
+	calibrations = nil
+}
+
+func insertReading(t *testing.T, metric string, value float64, at time.Time) {
+	t.Helper()
+	reading := models.SensorReading{SensorID: "test", Metric: metric, Value: value, RecordedAt: at}
+	if err := database.DB.Create(&reading).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBucketStartAlignsToLocalMidnight(t *testing.T) {
+	at := time.Date(2026, 3, 4, 15, 37, 12, 0, time.Local)
+
+	if got, want := BucketStart(at, 24*time.Hour), time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("1d bucket = %v, want %v", got, want)
+	}
+	if got, want := BucketStart(at, 5*time.Minute), time.Date(2026, 3, 4, 15, 35, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("5m bucket = %v, want %v", got, want)
+	}
+}
+
+func TestAggregateRaw(t *testing.T) {
+	setupDB(t)
+	hour := BucketStart(time.Now(), time.Hour).Add(-3 * time.Hour)
+
+	insertReading(t, PH, 7.0, hour.Add(5*time.Minute))
+	insertReading(t, PH, 7.4, hour.Add(50*time.Minute))
+	insertReading(t, PH, 6.8, hour.Add(70*time.Minute))
+	insertReading(t, TDS, 300, hour.Add(10*time.Minute))
+
+	buckets, err := Aggregate(PH, "", "1h", hour, hour.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+
+	first := buckets[0]
+	if !first.Start.Equal(hour) || first.Count != 2 || first.Min != 7.0 || first.Max != 7.4 {
+		t.Errorf("unexpected first bucket: %+v", first)
+	}
+	if avg := first.Avg; avg < 7.19 || avg > 7.21 {
+		t.Errorf("avg = %v, want 7.2", avg)
+	}
+	if buckets[1].Count != 1 || buckets[1].Min != 6.8 {
+		t.Errorf("unexpected second bucket: %+v", buckets[1])
+	}
+}
+
+func TestAggregateMergesRollupsAndRaw(t *testing.T) {
+	setupDB(t)
+	hour := BucketStart(time.Now(), time.Hour).Add(-2 * time.Hour)
+
+	insertReading(t, PH, 7.0, hour.Add(time.Minute))
+	insertReading(t, PH, 7.2, hour.Add(61*time.Minute))
+	RollUp()
+
+	var rollups int64
+	database.DB.Model(&models.SensorRollup{}).Where("bucket = ?", "1h").Count(&rollups)
+	if rollups != 2 {
+		t.Fatalf("got %d hourly rollups, want 2", rollups)
+	}
+
+	// Rolling up again must not duplicate buckets
+	RollUp()
+	database.DB.Model(&models.SensorRollup{}).Where("bucket = ?", "1h").Count(&rollups)
+	if rollups != 2 {
+		t.Fatalf("got %d hourly rollups after second run, want 2", rollups)
+	}
+
+	// Readings of the current hour come from the raw table
+	insertReading(t, PH, 6.9, time.Now())
+
+	buckets, err := Aggregate(PH, "", "1h", hour, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, want 3: %+v", len(buckets), buckets)
+	}
+	if buckets[2].Min != 6.9 {
+		t.Errorf("last bucket should come from raw readings: %+v", buckets[2])
+	}
+}
+
+func TestAggregateRejectsTooManyBuckets(t *testing.T) {
+	setupDB(t)
+	to := time.Now()
+	if _, err := Aggregate(PH, "", "5m", to.Add(-365*24*time.Hour), to); err == nil {
+		t.Error("expected an error for a year of 5m buckets")
+	}
+}
@@ -0,0 +1,219 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+)
+
+// Reading quality flags
+const (
+	QualityGood       = "GOOD"
+	QualityOutOfRange = "OUT_OF_RANGE" // outside the metric's valid range after calibration
+	QualitySpike      = "SPIKE"        // jumped more than MaxDelta from the previous reading
+)
+
+const (
+	// SpikeWindow is how recent the previous reading must be to detect a spike
+	SpikeWindow = 10 * time.Minute
+
+	// DuplicateWindow is how close a repeated value must be to count as a duplicate
+	DuplicateWindow = 2 * time.Second
+)
+
+// Errors for samples that are dropped rather than stored
+var (
+	ErrInvalidValue  = errors.New("value is not a number")
+	ErrUnknownMetric = errors.New("unknown metric")
+	ErrDuplicate     = errors.New("duplicate reading")
+)
+
+// Sample is a reading as received from a sensor, before calibration and checks
+type Sample struct {
+	SensorID   string
+	Metric     string
+	Value      float64
+	At         time.Time // device time, already validated by DeviceTime
+	ReceivedAt time.Time // server time; defaults to At
+}
+
+var (
+	// ingestMu serializes ingestion so spike and duplicate checks see previous readings
+	ingestMu sync.Mutex
+
+	// lastSeen holds the last sample per sensor and metric for duplicate suppression
+	lastSeen = make(map[string]Sample)
+
+	calibrationMu sync.RWMutex
+	calibrations  map[string]models.SensorCalibration // nil until loaded
+)
+
+// Ingest validates, calibrates and stores a sample. NaN/Inf values and
+// duplicates are dropped with an error; out-of-range values and spikes are
+// stored with a quality flag but not published to alerts and rules.
+func Ingest(s Sample) (*models.SensorReading, error) {
+	metric, ok := Get(s.Metric)
+	if !ok {
+		return nil, ErrUnknownMetric
+	}
+	if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+		return nil, ErrInvalidValue
+	}
+	if s.SensorID == "" {
+		s.SensorID = metric.SensorID
+	}
+	if s.At.IsZero() {
+		s.At = time.Now()
+	}
+	if s.ReceivedAt.IsZero() {
+		s.ReceivedAt = s.At
+	}
+
+	reading, err := store(metric, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if reading.Quality != QualityGood {
+		slog.Warn("sensor reading flagged", "metric", reading.Metric, "value", reading.Value, "sensor_id", reading.SensorID, "quality", reading.Quality)
+		return reading, nil
+	}
+
+	// Buffered readings are history; alerts and rules only react to live data
+	if IsBackfill(reading.RecordedAt, reading.ReceivedAt) {
+		return reading, nil
+	}
+
+	events.PublishReading(reading.Metric, reading.Value, reading.RecordedAt)
+	return reading, nil
+}
+
+// store runs the duplicate, range and spike checks and saves the reading
+func store(metric Metric, s Sample) (*models.SensorReading, error) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	key := s.SensorID + "|" + s.Metric
+	if last, ok := lastSeen[key]; ok && last.Value == s.Value && absDuration(s.At.Sub(last.At)) < DuplicateWindow {
+		return nil, ErrDuplicate
+	}
+	lastSeen[key] = s
+
+	reading := models.SensorReading{
+		SensorID:   s.SensorID,
+		Metric:     s.Metric,
+		Unit:       metric.Unit,
+		Value:      Calibrate(s.SensorID, s.Metric, s.Value),
+		RawValue:   s.Value,
+		Quality:    QualityGood,
+		RecordedAt: s.At,
+		ReceivedAt: s.ReceivedAt,
+	}
+
+	if !metric.InRange(reading.Value) {
+		reading.Quality = QualityOutOfRange
+	} else if isSpike(metric, reading) {
+		reading.Quality = QualitySpike
+	}
+
+	if err := database.DB.Create(&reading).Error; err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// isSpike compares a reading with the previous good reading of the same
+// sensor. A jump that persists (the previous reading was a spike close to
+// this one) is accepted as a real change.
+func isSpike(metric Metric, reading models.SensorReading) bool {
+	if metric.MaxDelta <= 0 {
+		return false
+	}
+
+	recent := database.DB.Where("sensor_id = ? AND metric = ? AND recorded_at >= ? AND recorded_at <= ?",
+		reading.SensorID, reading.Metric, reading.RecordedAt.Add(-SpikeWindow), reading.RecordedAt).
+		Session(&gorm.Session{})
+
+	var previous models.SensorReading
+	if err := recent.Order("recorded_at DESC").First(&previous).Error; err != nil {
+		return false
+	}
+	if previous.Quality == QualitySpike && math.Abs(reading.Value-previous.Value) <= metric.MaxDelta {
+		return false
+	}
+
+	var lastGood models.SensorReading
+	if err := recent.Where("quality = ?", QualityGood).Order("recorded_at DESC").First(&lastGood).Error; err != nil {
+		return false
+	}
+	return math.Abs(reading.Value-lastGood.Value) > metric.MaxDelta
+}
+
+// Calibrate applies the sensor's calibration to a raw value
+func Calibrate(sensorID, metric string, value float64) float64 {
+	calibrationMu.RLock()
+	loaded := calibrations != nil
+	calibration, ok := calibrations[sensorID+"|"+metric]
+	calibrationMu.RUnlock()
+
+	if !loaded {
+		ReloadCalibrations()
+		calibrationMu.RLock()
+		calibration, ok = calibrations[sensorID+"|"+metric]
+		calibrationMu.RUnlock()
+	}
+
+	if !ok {
+		return value
+	}
+	return value*calibration.Scale + calibration.Offset
+}
+
+// ReloadCalibrations refreshes the calibration cache. Call after changing calibrations.
+func ReloadCalibrations() {
+	var list []models.SensorCalibration
+	if err := database.DB.Find(&list).Error; err != nil {
+		slog.Error("error loading sensor calibrations", "error", err)
+		return
+	}
+
+	loaded := make(map[string]models.SensorCalibration, len(list))
+	for _, c := range list {
+		loaded[c.SensorID+"|"+c.Metric] = c
+	}
+
+	calibrationMu.Lock()
+	calibrations = loaded
+	calibrationMu.Unlock()
+}
+
+// ValidateCalibration checks a calibration before it is saved
+func ValidateCalibration(c *models.SensorCalibration) error {
+	metric, ok := Get(c.Metric)
+	if !ok {
+		return fmt.Errorf("unknown metric: %s", c.Metric)
+	}
+	if c.SensorID == "" {
+		c.SensorID = metric.SensorID
+	}
+	if c.Scale == 0 {
+		c.Scale = 1
+	}
+	return nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,67 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+)
+
+func TestIngestDropsInvalidAndDuplicateSamples(t *testing.T) {
+	setupDB(t)
+	at := time.Now()
+
+	if _, err := Ingest(Sample{Metric: PH, Value: math.NaN(), At: at}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("NaN: err = %v, want ErrInvalidValue", err)
+	}
+	if _, err := Ingest(Sample{Metric: PH, Value: 7.0, At: at}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Ingest(Sample{Metric: PH, Value: 7.0, At: at.Add(time.Second)}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("repeat: err = %v, want ErrDuplicate", err)
+	}
+
+	var count int64
+	database.DB.Model(&models.SensorReading{}).Count(&count)
+	if count != 1 {
+		t.Errorf("stored %d readings, want 1", count)
+	}
+}
+
+func TestIngestAppliesCalibration(t *testing.T) {
+	setupDB(t)
+	database.DB.Create(&models.SensorCalibration{SensorID: "probe", Metric: PH, Offset: -0.2, Scale: 1})
+
+	reading, err := Ingest(Sample{SensorID: "probe", Metric: PH, Value: 7.3, At: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(reading.Value-7.1) > 1e-9 || reading.RawValue != 7.3 {
+		t.Errorf("value = %v raw = %v, want 7.1 and 7.3", reading.Value, reading.RawValue)
+	}
+}
+
+func TestIngestFlagsOutOfRangeAndSpikes(t *testing.T) {
+	setupDB(t)
+	at := time.Now()
+
+	reading, _ := Ingest(Sample{Metric: PH, Value: 20, At: at})
+	if reading.Quality != QualityOutOfRange {
+		t.Errorf("pH 20 quality = %s, want %s", reading.Quality, QualityOutOfRange)
+	}
+
+	Ingest(Sample{Metric: PH, Value: 7.0, At: at.Add(time.Minute)})
+	reading, _ = Ingest(Sample{Metric: PH, Value: 9.0, At: at.Add(2 * time.Minute)})
+	if reading.Quality != QualitySpike {
+		t.Errorf("jump quality = %s, want %s", reading.Quality, QualitySpike)
+	}
+
+	// A jump that persists is a real change, not a spike
+	reading, _ = Ingest(Sample{Metric: PH, Value: 9.1, At: at.Add(3 * time.Minute)})
+	if reading.Quality != QualityGood {
+		t.Errorf("persistent shift quality = %s, want %s", reading.Quality, QualityGood)
+	}
+}
@@ -0,0 +1,98 @@
+package sensors
+
+import (
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+)
+
+// Metric names
+const (
+	Temperature      = "temperature"       // air temperature (DHT22)
+	Humidity         = "humidity"          // air humidity (DHT22)
+	PH               = "ph"                // pH probe
+	TDS              = "tds"               // total dissolved solids
+	WaterTemperature = "water_temperature" // DS18B20 probe
+	WaterLevel       = "water_level"       // ultrasonic distance sensor
+)
+
+// Metric describes a measured quantity and where it comes from over MQTT
+type Metric struct {
+	Name     string  `json:"name"`
+	Label    string  `json:"label"`
+	Unit     string  `json:"unit"`
+	Topic    string  `json:"topic"`
+	Key      string  `json:"key"`       // payload field holding the value
+	SensorID string  `json:"sensor_id"` // used when the payload has no "sensor_id"
+	Min      float64 `json:"min"`       // valid range
+	Max      float64 `json:"max"`
+	MaxDelta float64 `json:"max_delta"` // larger jumps between readings are spikes
+}
+
+// Metrics lists every metric the backend ingests
+var Metrics = []Metric{
+	{Name: Temperature, Label: "Air temperature", Unit: "°C", Topic: "aquarium/sensor/dht", Key: "temp", SensorID: "dht22", Min: -40, Max: 80, MaxDelta: 5},
+	{Name: Humidity, Label: "Humidity", Unit: "%", Topic: "aquarium/sensor/dht", Key: "hum", SensorID: "dht22", Min: 0, Max: 100, MaxDelta: 20},
+	{Name: PH, Label: "pH", Unit: "pH", Topic: "aquarium/sensor/ph", Key: "ph", SensorID: "ph", Min: 0, Max: 14, MaxDelta: 1},
+	{Name: TDS, Label: "TDS", Unit: "ppm", Topic: "aquarium/sensor/tds", Key: "tds", SensorID: "tds", Min: 0, Max: 5000, MaxDelta: 200},
+	{Name: WaterTemperature, Label: "Water temperature", Unit: "°C", Topic: "aquarium/sensor/water_temp", Key: "temp", SensorID: "ds18b20", Min: -10, Max: 60, MaxDelta: 3},
+	{Name: WaterLevel, Label: "Water level", Unit: "cm", Topic: "aquarium/sensor/water_level", Key: "level_cm", SensorID: "ultrasonic", Min: 0, Max: 500, MaxDelta: 5},
+}
+
+// Get returns a metric by name
+func Get(name string) (Metric, bool) {
+	for _, m := range Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// IsMetric reports whether name is a known metric
+func IsMetric(name string) bool {
+	_, ok := Get(name)
+	return ok
+}
+
+// ByTopic returns the metrics carried by an MQTT topic
+func ByTopic(topic string) []Metric {
+	var metrics []Metric
+	for _, m := range Metrics {
+		if m.Topic == topic {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// Topics returns the distinct MQTT topics of all metrics
+func Topics() []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, m := range Metrics {
+		if !seen[m.Topic] {
+			seen[m.Topic] = true
+			topics = append(topics, m.Topic)
+		}
+	}
+	return topics
+}
+
+// InRange reports whether value is within the metric's valid range
+func (m Metric) InRange(value float64) bool {
+	return value >= m.Min && value <= m.Max
+}
+
+// Latest returns the most recent good reading of a metric, optionally from one sensor
+func Latest(metric, sensorID string) (*models.SensorReading, error) {
+	query := database.DB.Where("metric = ? AND quality = ?", metric, QualityGood)
+	if sensorID != "" {
+		query = query.Where("sensor_id = ?", sensorID)
+	}
+
+	var reading models.SensorReading
+	if err := query.Order("recorded_at DESC").First(&reading).Error; err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
@@ -0,0 +1,118 @@
+package sensors
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"iot-backend-cursor/config"
+)
+
+var (
+	// ClockTolerance is how far a device clock may run ahead of the server
+	ClockTolerance = 5 * time.Minute
+
+	// MaxBackfill is the oldest buffered reading that keeps its device time
+	MaxBackfill = 24 * time.Hour
+)
+
+// timestampLayouts are the string formats accepted besides epoch numbers
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// InitSensors applies the timestamp validation settings from the config
+func InitSensors(cfg *config.Config) {
+	ClockTolerance = time.Duration(cfg.SensorClockToleranceSeconds) * time.Second
+	MaxBackfill = time.Duration(cfg.SensorMaxBackfillHours) * time.Hour
+	slog.Info("sensor timestamp validation", "clock_tolerance", ClockTolerance, "max_backfill", MaxBackfill)
+}
+
+// ParseTimestamp reads a device timestamp: epoch seconds, epoch milliseconds
+// or an ISO 8601 string (local time when it has no offset). The result is
+// always in local time, like server times, so stored times compare in order.
+func ParseTimestamp(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case float64:
+		return epoch(t)
+	case string:
+		if n, err := strconv.ParseFloat(t, 64); err == nil {
+			return epoch(n)
+		}
+		for _, layout := range timestampLayouts {
+			if at, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return at.In(time.Local), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// epoch converts seconds (or milliseconds, for values from 1e12) since 1970
+func epoch(n float64) (time.Time, bool) {
+	if n <= 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, false
+	}
+	if n >= 1e12 {
+		return time.UnixMilli(int64(n)), true
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// ParseClockTime resolves an RTC time of day ("15:04" or "15:04:05") to the
+// most recent matching instant, allowing ClockTolerance into the future
+func ParseClockTime(s string, now time.Time) (time.Time, bool) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		clock, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+		if at.After(now.Add(ClockTolerance)) {
+			at = at.AddDate(0, 0, -1)
+		}
+		return at, true
+	}
+	return time.Time{}, false
+}
+
+// DeviceTime picks the time a reading is recorded at. A device timestamp is
+// preferred over the RTC time of day; either is used only when it is at most
+// ClockTolerance ahead of receivedAt and at most MaxBackfill behind it.
+func DeviceTime(timestamp interface{}, rtcTime string, receivedAt time.Time) time.Time {
+	at, ok := ParseTimestamp(timestamp)
+	if !ok {
+		if timestamp != nil {
+			slog.Warn("unrecognized device timestamp, using server time", "timestamp", timestamp)
+		}
+		if rtcTime == "" {
+			return receivedAt
+		}
+
+		at, ok = ParseClockTime(rtcTime, receivedAt)
+		if !ok {
+			return receivedAt
+		}
+		// A time of day near server time is a live reading; the server clock is more precise
+		if absDuration(receivedAt.Sub(at)) <= ClockTolerance {
+			return receivedAt
+		}
+	}
+
+	lag := receivedAt.Sub(at)
+	if lag < -ClockTolerance || lag > MaxBackfill {
+		slog.Warn("device time is off server time, using server time", "device_time", at, "lag", lag.Round(time.Second))
+		return receivedAt
+	}
+	return at
+}
+
+// IsBackfill reports whether a reading was buffered by the device rather than sent live
+func IsBackfill(recordedAt, receivedAt time.Time) bool {
+	return receivedAt.Sub(recordedAt) > ClockTolerance
+}
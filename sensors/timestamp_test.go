@@ -0,0 +1,57 @@
+package sensors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2026, 3, 4, 15, 37, 12, 0, time.Local)
+
+	for _, v := range []interface{}{
+		float64(want.Unix()),
+		float64(want.UnixMilli()),
+		want.Format(time.RFC3339),
+		want.Format("2006-01-02 15:04:05"),
+	} {
+		got, ok := ParseTimestamp(v)
+		if !ok || !got.Equal(want) {
+			t.Errorf("ParseTimestamp(%v) = %v, %v; want %v", v, got, ok, want)
+		}
+	}
+
+	// Offsets other than the local one are converted to local time
+	got, ok := ParseTimestamp("2026-03-04T10:00:00+13:45")
+	if !ok || !got.Equal(time.Date(2026, 3, 3, 20, 15, 0, 0, time.UTC)) || got.Location() != time.Local {
+		t.Errorf("ParseTimestamp with offset = %v, %v; want 2026-03-03T20:15:00Z in local time", got, ok)
+	}
+
+	if _, ok := ParseTimestamp("yesterday"); ok {
+		t.Error("ParseTimestamp accepted garbage")
+	}
+}
+
+func TestDeviceTime(t *testing.T) {
+	received := time.Date(2026, 3, 4, 15, 37, 12, 0, time.Local)
+
+	cases := []struct {
+		name      string
+		timestamp interface{}
+		rtcTime   string
+		want      time.Time
+	}{
+		{"no timestamp", nil, "", received},
+		{"buffered", float64(received.Add(-2 * time.Hour).Unix()), "", received.Add(-2 * time.Hour)},
+		{"too far ahead", float64(received.Add(time.Hour).Unix()), "", received},
+		{"too old", float64(received.Add(-48 * time.Hour).Unix()), "", received},
+		{"live rtc", nil, "15:37", received},
+		{"buffered rtc", nil, "13:05", time.Date(2026, 3, 4, 13, 5, 0, 0, time.Local)},
+		{"rtc before midnight", nil, "23:50:00", time.Date(2026, 3, 3, 23, 50, 0, 0, time.Local)},
+	}
+
+	for _, tc := range cases {
+		if got := DeviceTime(tc.timestamp, tc.rtcTime, received); !got.Equal(tc.want) {
+			t.Errorf("%s: DeviceTime = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
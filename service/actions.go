@@ -0,0 +1,201 @@
+// Package service performs device state transitions (action history, device
+// status and food stock) in database transactions. MQTT publishing stays with
+// the caller and happens outside the transaction; events are published after
+// the transaction commits.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidTransition is returned when the action lifecycle does not allow a
+// status change, e.g. because a device report and a stop request raced and
+// the action already ended
+var ErrInvalidTransition = errors.New("invalid action status transition")
+
+// StartAction records a new action and its creation event. With a non-empty
+// deviceStatus the device status is set in the same transaction (remaining 0,
+// the scheduler tracks expiry).
+func StartAction(ctx context.Context, action *models.ActionHistory, deviceStatus string) error {
+	status := action.Status
+	if !models.ActionStatus("").CanTransitionTo(status) {
+		return fmt.Errorf("%w: new action cannot start as %s", ErrInvalidTransition, status)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(action).Error; err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, tx, action.ID, "", status, "created by "+action.TriggerSource, action.CreatedAt); err != nil {
+			return err
+		}
+		if deviceStatus == "" {
+			return nil
+		}
+		return setDeviceStatus(tx, action.DeviceType, deviceStatus, 0)
+	})
+}
+
+// MarkRunning moves a PENDING action to RUNNING once its command was sent.
+// A device that reported back before this call already ended the action,
+// which is left alone.
+func MarkRunning(ctx context.Context, action *models.ActionHistory) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return transition(ctx, tx, action, models.ActionRunning, "command sent")
+	})
+	if errors.Is(err, ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// FailAction marks an action FAILED and publishes ActionFailed
+func FailAction(ctx context.Context, action *models.ActionHistory, reason string) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return transition(ctx, tx, action, models.ActionFailed, reason)
+	})
+	if err != nil {
+		return err
+	}
+
+	events.PublishActionFailed(action, reason)
+	return nil
+}
+
+// FinishAction ends an action with a terminal status. On SUCCESS, fedGram is
+// taken from the food stock in the same transaction.
+func FinishAction(ctx context.Context, action *models.ActionHistory, status models.ActionStatus, reason string, fedGram int) error {
+	var previous, current int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transition(ctx, tx, action, status, reason); err != nil {
+			return err
+		}
+		if status != models.ActionSuccess || fedGram <= 0 {
+			return nil
+		}
+
+		var err error
+		previous, current, err = takeStock(tx, fedGram)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	publishFinished(action, reason)
+	events.PublishStockChanged(previous, current)
+	return nil
+}
+
+// StopRun ends a running on/off action and switches its device OFF in one transaction
+func StopRun(ctx context.Context, action *models.ActionHistory, status models.ActionStatus, reason string) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transition(ctx, tx, action, status, reason); err != nil {
+			return err
+		}
+		return setDeviceStatus(tx, action.DeviceType, "OFF", 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	publishFinished(action, reason)
+	return nil
+}
+
+// StopDevice ends all running actions of a device type with status and
+// switches the device OFF in one transaction. Actions are returned newest first.
+func StopDevice(ctx context.Context, deviceType string, status models.ActionStatus, reason string) ([]models.ActionHistory, error) {
+	var running []models.ActionHistory
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		running = nil
+		if err := tx.Clauses(forUpdate).Where("device_type = ? AND status = ?", deviceType, models.ActionRunning).
+			Order("start_time DESC").
+			Find(&running).Error; err != nil {
+			return err
+		}
+		for i := range running {
+			if err := transition(ctx, tx, &running[i], status, reason); err != nil {
+				return err
+			}
+		}
+		return setDeviceStatus(tx, deviceType, "OFF", 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range running {
+		publishFinished(&running[i], reason)
+	}
+	return running, nil
+}
+
+// Timeline returns the status changes of an action, oldest first
+func Timeline(actionID uint) ([]models.ActionEvent, error) {
+	var timeline []models.ActionEvent
+	err := database.DB.Where("action_id = ?", actionID).Order("at, id").Find(&timeline).Error
+	return timeline, err
+}
+
+// transition changes the status of an action if its lifecycle allows it and
+// records the change in action_events. The action row is locked first, so
+// concurrent transitions are applied one after the other and only the first
+// of two competing terminal transitions succeeds.
+func transition(ctx context.Context, tx *gorm.DB, action *models.ActionHistory, to models.ActionStatus, reason string) error {
+	var current models.ActionHistory
+	if err := tx.Clauses(forUpdate).First(&current, action.ID).Error; err != nil {
+		return err
+	}
+	from := current.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: action #%d is %s, cannot become %s", ErrInvalidTransition, action.ID, from, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	if to.IsTerminal() {
+		updates["end_time"] = now
+	}
+	if err := tx.Model(&current).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := recordEvent(ctx, tx, action.ID, from, to, reason, now); err != nil {
+		return err
+	}
+	return tx.First(action, action.ID).Error
+}
+
+func recordEvent(ctx context.Context, tx *gorm.DB, actionID uint, from, to models.ActionStatus, reason string, at time.Time) error {
+	return tx.Create(&models.ActionEvent{
+		ActionID:   actionID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		RequestID:  logging.RequestID(ctx),
+		At:         at,
+	}).Error
+}
+
+func publishFinished(action *models.ActionHistory, reason string) {
+	if action.Status == models.ActionFailed {
+		events.PublishActionFailed(action, reason)
+	} else {
+		events.PublishActionFinished(action)
+	}
+}
+
+// forUpdate locks selected rows on Postgres. SQLite ignores it; its write
+// transactions begin immediate and already hold the database lock.
+var forUpdate = clause.Locking{Strength: "UPDATE"}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+)
+
+// SetDeviceStatus sets the status and remaining seconds of a device type
+func SetDeviceStatus(deviceType, status string, remaining int) error {
+	return setDeviceStatus(database.DB, deviceType, status, remaining)
+}
+
+// UpdateRemaining sets the remaining seconds of a device that is still ON.
+// It returns false once the device was switched off, so countdowns can stop
+// without overwriting the new status.
+func UpdateRemaining(deviceType string, remaining int) (bool, error) {
+	result := database.DB.Model(&models.DeviceStatus{}).
+		Where("device_type = ? AND status = ?", deviceType, "ON").
+		Updates(map[string]interface{}{
+			"remaining":    remaining,
+			"last_updated": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func setDeviceStatus(tx *gorm.DB, deviceType, status string, remaining int) error {
+	return tx.Model(&models.DeviceStatus{}).Where("device_type = ?", deviceType).Updates(map[string]interface{}{
+		"status":       status,
+		"remaining":    remaining,
+		"last_updated": time.Now(),
+	}).Error
+}
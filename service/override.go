@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+)
+
+// Schedule override modes of on/off devices. While an override is active the
+// scheduler starts no schedule runs for the device.
+const (
+	OverrideManual   = "MANUAL"    // a manual run wins until the end of the current schedule window
+	OverridePause    = "PAUSE"     // schedules are paused for a number of hours
+	OverrideForceOff = "FORCE_OFF" // the device stays off; manual runs and automations are refused too
+)
+
+// OverrideModes lists the valid override modes
+var OverrideModes = []string{OverrideManual, OverridePause, OverrideForceOff}
+
+// ErrForcedOff is returned when turning on a device that is forced off
+var ErrForcedOff = errors.New("device is forced off")
+
+// Override is the active schedule override of a device
+type Override struct {
+	Mode  string    `json:"mode"`
+	Until time.Time `json:"until"`
+}
+
+// ActiveOverride returns the override of a device type, or nil if it has
+// none or it expired
+func ActiveOverride(deviceType string) (*Override, error) {
+	var status models.DeviceStatus
+	if err := database.DB.Where("device_type = ?", deviceType).First(&status).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if status.OverrideMode == "" || status.OverrideUntil == nil || !time.Now().Before(*status.OverrideUntil) {
+		return nil, nil
+	}
+	return &Override{Mode: status.OverrideMode, Until: *status.OverrideUntil}, nil
+}
+
+// SetOverride replaces the override of a device type. In the same transaction
+// running schedule actions end OVERRIDDEN; with FORCE_OFF running manual and
+// automation actions end STOPPED too. FORCE_OFF, or ending the only running
+// actions, switches the device OFF, so the caller sends the OFF command first.
+// The ended actions are returned.
+func SetOverride(ctx context.Context, deviceType, mode string, until time.Time, reason string) ([]models.ActionHistory, error) {
+	var ended []models.ActionHistory
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		ended = nil
+		if err := setOverride(tx, deviceType, mode, &until); err != nil {
+			return err
+		}
+
+		var running []models.ActionHistory
+		if err := tx.Clauses(forUpdate).Where("device_type = ? AND status = ?", deviceType, models.ActionRunning).
+			Order("start_time DESC").
+			Find(&running).Error; err != nil {
+			return err
+		}
+
+		for i := range running {
+			status := models.ActionOverridden
+			if running[i].TriggerSource != "SCHEDULE" {
+				if mode != OverrideForceOff {
+					continue
+				}
+				status = models.ActionStopped
+			}
+			if err := transition(ctx, tx, &running[i], status, reason); err != nil {
+				return err
+			}
+			ended = append(ended, running[i])
+		}
+
+		if mode == OverrideForceOff || (len(ended) > 0 && len(ended) == len(running)) {
+			return setDeviceStatus(tx, deviceType, "OFF", 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ended {
+		publishFinished(&ended[i], reason)
+	}
+	return ended, nil
+}
+
+// ClearOverride removes the override of a device type; schedules resume on the next check
+func ClearOverride(deviceType string) error {
+	return setOverride(database.DB, deviceType, "", nil)
+}
+
+func setOverride(tx *gorm.DB, deviceType, mode string, until *time.Time) error {
+	return tx.Model(&models.DeviceStatus{}).Where("device_type = ?", deviceType).Updates(map[string]interface{}{
+		"override_mode":  mode,
+		"override_until": until,
+	}).Error
+}
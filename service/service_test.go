@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-backend-cursor/config"
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/logging"
+	"iot-backend-cursor/models"
+)
+
+func setupDB(t *testing.T, stockGram int) {
+	t.Helper()
+	cfg := &config.Config{
+		DBType:                  "sqlite",
+		DBName:                  filepath.Join(t.TempDir(), "test"),
+		DBLogLevel:              "silent",
+		DBMaxOpenConns:          4,
+		DBBusyRetries:           3,
+		DBBusyRetryMillis:       20,
+		SQLiteJournalMode:       "WAL",
+		SQLiteSynchronous:       "NORMAL",
+		SQLiteBusyTimeoutMillis: 5000,
+	}
+	if err := database.Connect(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	database.DB.Create(&models.Stock{AmountGram: stockGram})
+	database.DB.Create(&models.DeviceStatus{DeviceType: "UV", Status: "OFF"})
+}
+
+func newAction(t *testing.T, deviceType string, status models.ActionStatus, value int) *models.ActionHistory {
+	t.Helper()
+	action := &models.ActionHistory{DeviceType: deviceType, TriggerSource: "MANUAL", StartTime: time.Now(), Status: status, Value: value}
+	if err := StartAction(context.Background(), action, ""); err != nil {
+		t.Fatal(err)
+	}
+	return action
+}
+
+func stockGram(t *testing.T) int {
+	t.Helper()
+	var stock models.Stock
+	if err := database.DB.First(&stock).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stock.AmountGram
+}
+
+func TestFinishActionTakesStockOnce(t *testing.T) {
+	setupDB(t, 100)
+	action := newAction(t, "FEEDER", models.ActionRunning, 30)
+
+	if err := FinishAction(context.Background(), action, models.ActionSuccess, "device reported SUCCESS", 30); err != nil {
+		t.Fatal(err)
+	}
+	if action.Status != models.ActionSuccess || action.EndTime == nil {
+		t.Errorf("action = %s ended %v, want SUCCESS with end time", action.Status, action.EndTime)
+	}
+
+	// A second report for the same action must not take stock again
+	if err := FinishAction(context.Background(), action, models.ActionSuccess, "device reported SUCCESS", 30); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("second finish error = %v, want ErrInvalidTransition", err)
+	}
+	if got := stockGram(t); got != 70 {
+		t.Errorf("stock = %d, want 70", got)
+	}
+}
+
+func TestConcurrentFeedsTakeStockAtomically(t *testing.T) {
+	setupDB(t, 1000)
+
+	actions := make([]*models.ActionHistory, 20)
+	for i := range actions {
+		actions[i] = newAction(t, "FEEDER", models.ActionRunning, 10)
+	}
+
+	var wg sync.WaitGroup
+	for _, action := range actions {
+		wg.Add(1)
+		go func(action *models.ActionHistory) {
+			defer wg.Done()
+			if err := FinishAction(context.Background(), action, models.ActionSuccess, "", action.Value); err != nil {
+				t.Error(err)
+			}
+		}(action)
+	}
+	wg.Wait()
+
+	if got := stockGram(t); got != 800 {
+		t.Errorf("stock = %d, want 800", got)
+	}
+}
+
+func TestStockNeverNegative(t *testing.T) {
+	setupDB(t, 5)
+	if err := FinishAction(context.Background(), newAction(t, "FEEDER", models.ActionPending, 30), models.ActionSuccess, "", 30); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockGram(t); got != 0 {
+		t.Errorf("stock = %d, want 0", got)
+	}
+}
+
+func TestStopDeviceSwitchesOff(t *testing.T) {
+	setupDB(t, 0)
+	newAction(t, "UV", models.ActionRunning, 60)
+	newAction(t, "UV", models.ActionRunning, 60)
+	SetDeviceStatus("UV", "ON", 60)
+
+	stopped, err := StopDevice(context.Background(), "UV", models.ActionStopped, "stopped by user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stopped) != 2 {
+		t.Fatalf("stopped %d actions, want 2", len(stopped))
+	}
+
+	var running int64
+	database.DB.Model(&models.ActionHistory{}).Where("status = ?", models.ActionRunning).Count(&running)
+	var status models.DeviceStatus
+	database.DB.Where("device_type = ?", "UV").First(&status)
+	if running != 0 || status.Status != "OFF" {
+		t.Errorf("running = %d, status = %s; want 0 and OFF", running, status.Status)
+	}
+
+	if on, _ := UpdateRemaining("UV", 30); on {
+		t.Error("countdown updated a device that is OFF")
+	}
+}
+
+func TestTransitionsFollowLifecycle(t *testing.T) {
+	setupDB(t, 0)
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	action := newAction(t, "FEEDER", models.ActionPending, 10)
+
+	if err := MarkRunning(ctx, action); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishAction(ctx, action, models.ActionStopped, "stopped by user", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ended actions can't start running again
+	if err := MarkRunning(ctx, action); err != nil || action.Status != models.ActionStopped {
+		t.Errorf("MarkRunning after stop: status %s, error %v", action.Status, err)
+	}
+	if err := FailAction(ctx, action, "late failure"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("FailAction after stop error = %v, want ErrInvalidTransition", err)
+	}
+
+	timeline, err := Timeline(action.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ from, to models.ActionStatus }{
+		{"", models.ActionPending},
+		{models.ActionPending, models.ActionRunning},
+		{models.ActionRunning, models.ActionStopped},
+	}
+	if len(timeline) != len(want) {
+		t.Fatalf("timeline has %d events, want %d", len(timeline), len(want))
+	}
+	for i, w := range want {
+		if timeline[i].FromStatus != w.from || timeline[i].ToStatus != w.to {
+			t.Errorf("event %d = %s -> %s, want %s -> %s", i, timeline[i].FromStatus, timeline[i].ToStatus, w.from, w.to)
+		}
+	}
+	if timeline[2].RequestID != "req-1" || timeline[2].Reason != "stopped by user" {
+		t.Errorf("stop event = %+v, want request req-1 and reason", timeline[2])
+	}
+}
+
+func TestSetOverrideEndsScheduleRuns(t *testing.T) {
+	setupDB(t, 0)
+	ctx := context.Background()
+	schedule := &models.ActionHistory{DeviceType: "UV", TriggerSource: "SCHEDULE", StartTime: time.Now(), Status: models.ActionRunning}
+	if err := StartAction(ctx, schedule, "ON"); err != nil {
+		t.Fatal(err)
+	}
+	manual := newAction(t, "UV", models.ActionRunning, 600)
+
+	// A manual override only ends the schedule run; the manual run keeps UV on
+	ended, err := SetOverride(ctx, "UV", OverrideManual, time.Now().Add(time.Hour), "manual run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 1 || ended[0].ID != schedule.ID || ended[0].Status != models.ActionOverridden {
+		t.Fatalf("ended = %+v, want schedule action OVERRIDDEN", ended)
+	}
+	var status models.DeviceStatus
+	database.DB.Where("device_type = ?", "UV").First(&status)
+	if status.Status != "ON" {
+		t.Errorf("status = %s after manual override, want ON", status.Status)
+	}
+
+	// Force off stops the manual run as well
+	ended, err = SetOverride(ctx, "UV", OverrideForceOff, time.Now().Add(time.Hour), "override FORCE_OFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 1 || ended[0].ID != manual.ID || ended[0].Status != models.ActionStopped {
+		t.Fatalf("ended = %+v, want manual action STOPPED", ended)
+	}
+	database.DB.Where("device_type = ?", "UV").First(&status)
+	if status.Status != "OFF" {
+		t.Errorf("status = %s after force off, want OFF", status.Status)
+	}
+
+	override, err := ActiveOverride("UV")
+	if err != nil || override == nil || override.Mode != OverrideForceOff {
+		t.Errorf("active override = %+v, %v; want FORCE_OFF", override, err)
+	}
+}
+
+func TestActiveOverrideExpires(t *testing.T) {
+	setupDB(t, 0)
+	if _, err := SetOverride(context.Background(), "UV", OverridePause, time.Now().Add(-time.Minute), "override PAUSE"); err != nil {
+		t.Fatal(err)
+	}
+	if override, err := ActiveOverride("UV"); err != nil || override != nil {
+		t.Errorf("expired override = %+v, %v; want none", override, err)
+	}
+	if override, err := ActiveOverride("FEEDER"); err != nil || override != nil {
+		t.Errorf("override of device without status = %+v, %v; want none", override, err)
+	}
+}
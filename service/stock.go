@@ -0,0 +1,48 @@
+package service
+
+import (
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/events"
+	"iot-backend-cursor/models"
+
+	"gorm.io/gorm"
+)
+
+// SetStock replaces the food stock amount and returns the stock before and after
+func SetStock(amountGram int) (before, after models.Stock, err error) {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(forUpdate).First(&before).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Stock{}).Where("id = ?", before.ID).Update("amount_gram", amountGram).Error; err != nil {
+			return err
+		}
+		return tx.First(&after, before.ID).Error
+	})
+	if err != nil {
+		return before, after, err
+	}
+
+	events.PublishStockChanged(before.AmountGram, after.AmountGram)
+	return before, after, nil
+}
+
+// takeStock subtracts grams with a single UPDATE so concurrent reports
+// can't overwrite each other's decrement
+func takeStock(tx *gorm.DB, grams int) (previous, current int, err error) {
+	var stock models.Stock
+	if err := tx.Clauses(forUpdate).First(&stock).Error; err != nil {
+		return 0, 0, err
+	}
+	previous = stock.AmountGram
+
+	if err := tx.Model(&models.Stock{}).Where("id = ?", stock.ID).
+		Update("amount_gram", gorm.Expr("CASE WHEN amount_gram > ? THEN amount_gram - ? ELSE 0 END", grams, grams)).Error; err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.First(&stock, stock.ID).Error; err != nil {
+		return 0, 0, err
+	}
+	return previous, stock.AmountGram, nil
+}
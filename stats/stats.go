@@ -0,0 +1,260 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/devices"
+	"iot-backend-cursor/models"
+	"iot-backend-cursor/sensors"
+
+	"gorm.io/gorm"
+)
+
+const day = 24 * time.Hour
+
+// MaxDays limits the range of one stats query
+const MaxDays = 366
+
+// Report holds the dashboard statistics for a date range
+type Report struct {
+	From              time.Time        `json:"from"`
+	To                time.Time        `json:"to"`
+	FeedingPerDay     []FeedingPeriod  `json:"feeding_per_day"`
+	FeedingPerWeek    []FeedingPeriod  `json:"feeding_per_week"`
+	FeedsByTrigger    []TriggerCount   `json:"feeds_by_trigger"`
+	Outcomes          []DeviceOutcomes `json:"outcomes"`
+	UVHoursPerDay     []UVDay          `json:"uv_hours_per_day"`
+	TemperaturePerDay []TemperatureDay `json:"temperature_per_day"`
+}
+
+// FeedingPeriod is the food dispensed in one day or week (starting Monday)
+type FeedingPeriod struct {
+	Start time.Time `json:"start"`
+	Grams int64     `json:"grams"`
+	Feeds int64     `json:"feeds"`
+}
+
+// TriggerCount is the number of successful feeds per trigger source
+type TriggerCount struct {
+	TriggerSource string `json:"trigger_source"`
+	Feeds         int64  `json:"feeds"`
+	Grams         int64  `json:"grams"`
+}
+
+// DeviceOutcomes counts finished actions per status for one device type.
+// SuccessRate and FailureRate are shares of finished actions (0-1).
+type DeviceOutcomes struct {
+	DeviceType  string           `json:"device_type"`
+	Total       int64            `json:"total"`
+	ByStatus    map[string]int64 `json:"by_status"`
+	SuccessRate float64          `json:"success_rate"`
+	FailureRate float64          `json:"failure_rate"`
+}
+
+// UVDay is how long the UV lamp was on, attributed to the day it was turned on
+type UVDay struct {
+	Day   time.Time `json:"day"`
+	Hours float64   `json:"hours"`
+}
+
+// TemperatureDay is the mean air temperature of one day
+type TemperatureDay struct {
+	Day     time.Time `json:"day"`
+	Mean    float64   `json:"mean"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	Samples int64     `json:"samples"`
+}
+
+// unfinished statuses are left out of success/failure rates
+var unfinished = models.ActiveActionStatuses
+
+// Compute builds the report for [from, to). from is rounded down to local midnight.
+func Compute(from, to time.Time) (*Report, error) {
+	from = sensors.BucketStart(from, day)
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from) > MaxDays*day {
+		return nil, fmt.Errorf("range is limited to %d days", MaxDays)
+	}
+
+	report := &Report{From: from, To: to}
+	var err error
+
+	if report.FeedingPerDay, err = feedingPerDay(from, to); err != nil {
+		return nil, err
+	}
+	report.FeedingPerWeek = perWeek(report.FeedingPerDay)
+
+	if report.FeedsByTrigger, err = feedsByTrigger(from, to); err != nil {
+		return nil, err
+	}
+	if report.Outcomes, err = outcomes(from, to); err != nil {
+		return nil, err
+	}
+	if report.UVHoursPerDay, err = uvHoursPerDay(from, to); err != nil {
+		return nil, err
+	}
+	if report.TemperaturePerDay, err = temperaturePerDay(from, to); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// actions returns the action history query for one device type in the range
+func actions(deviceType string, from, to time.Time) *gorm.DB {
+	query := database.DB.Model(&models.ActionHistory{}).Where("start_time >= ? AND start_time < ?", from, to)
+	if deviceType != "" {
+		query = query.Where("device_type = ?", deviceType)
+	}
+	return query
+}
+
+// feedingPerDay sums successful feeds per local day, including empty days
+func feedingPerDay(from, to time.Time) ([]FeedingPeriod, error) {
+	var rows []struct {
+		Epoch int64
+		Grams int64
+		Feeds int64
+	}
+	err := actions(devices.Feeder, from, to).
+		Select(sensors.BucketExpr("start_time", day)+" AS epoch, COALESCE(SUM(value), 0) AS grams, COUNT(*) AS feeds").
+		Where("status = ?", models.ActionSuccess).
+		Group("epoch").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[int64]FeedingPeriod, len(rows))
+	for _, row := range rows {
+		byDay[row.Epoch] = FeedingPeriod{Grams: row.Grams, Feeds: row.Feeds}
+	}
+
+	var days []FeedingPeriod
+	for d := from; d.Before(to); d = sensors.BucketStart(d.Add(day+time.Hour), day) {
+		period := byDay[d.Unix()]
+		period.Start = d
+		days = append(days, period)
+	}
+	return days, nil
+}
+
+// perWeek folds daily totals into weeks starting on Monday
+func perWeek(days []FeedingPeriod) []FeedingPeriod {
+	var weeks []FeedingPeriod
+	for _, d := range days {
+		offset := (int(d.Start.Weekday()) + 6) % 7 // days since Monday
+		start := d.Start.AddDate(0, 0, -offset)
+
+		if len(weeks) == 0 || !weeks[len(weeks)-1].Start.Equal(start) {
+			weeks = append(weeks, FeedingPeriod{Start: start})
+		}
+		weeks[len(weeks)-1].Grams += d.Grams
+		weeks[len(weeks)-1].Feeds += d.Feeds
+	}
+	return weeks
+}
+
+// feedsByTrigger counts successful feeds per trigger source
+func feedsByTrigger(from, to time.Time) ([]TriggerCount, error) {
+	var rows []TriggerCount
+	err := actions(devices.Feeder, from, to).
+		Select("trigger_source, COUNT(*) AS feeds, COALESCE(SUM(value), 0) AS grams").
+		Where("status = ?", models.ActionSuccess).
+		Group("trigger_source").
+		Order("trigger_source").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// outcomes counts finished actions per device type and status
+func outcomes(from, to time.Time) ([]DeviceOutcomes, error) {
+	var rows []struct {
+		DeviceType string
+		Status     string
+		Count      int64
+	}
+	err := actions("", from, to).
+		Select("device_type, status, COUNT(*) AS count").
+		Where("status NOT IN ?", unfinished).
+		Group("device_type, status").
+		Order("device_type, status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var result []DeviceOutcomes
+	for _, row := range rows {
+		if len(result) == 0 || result[len(result)-1].DeviceType != row.DeviceType {
+			result = append(result, DeviceOutcomes{DeviceType: row.DeviceType, ByStatus: map[string]int64{}})
+		}
+		current := &result[len(result)-1]
+		current.ByStatus[row.Status] = row.Count
+		current.Total += row.Count
+	}
+
+	for i := range result {
+		total := float64(result[i].Total)
+		result[i].SuccessRate = float64(result[i].ByStatus[string(models.ActionSuccess)]) / total
+		result[i].FailureRate = float64(result[i].ByStatus[string(models.ActionFailed)]) / total
+	}
+	return result, nil
+}
+
+// uvHoursPerDay sums UV on-time per local day. A lamp that is still on
+// counts until now rather than its planned end.
+func uvHoursPerDay(from, to time.Time) ([]UVDay, error) {
+	var rows []struct {
+		Epoch int64
+		Hours float64
+	}
+	err := actions(devices.UV, from, to).
+		Select(sensors.BucketExpr("start_time", day)+" AS epoch, COALESCE(SUM("+durationHoursExpr()+"), 0) AS hours", models.ActionRunning, time.Now()).
+		Where("end_time IS NOT NULL OR status = ?", models.ActionRunning).
+		Group("epoch").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[int64]float64, len(rows))
+	for _, row := range rows {
+		byDay[row.Epoch] = math.Round(row.Hours*100) / 100
+	}
+
+	var days []UVDay
+	for d := from; d.Before(to); d = sensors.BucketStart(d.Add(day+time.Hour), day) {
+		days = append(days, UVDay{Day: d, Hours: byDay[d.Unix()]})
+	}
+	return days, nil
+}
+
+// durationHoursExpr returns end_time - start_time in hours. The placeholders
+// are the running status and the time used as the end of running actions.
+func durationHoursExpr() string {
+	end := "CASE WHEN status = ? THEN ? ELSE end_time END"
+	if database.DB.Dialector.Name() == "postgres" {
+		return "EXTRACT(EPOCH FROM ((" + end + ") - start_time)) / 3600.0"
+	}
+	return "(julianday(" + end + ") - julianday(start_time)) * 24.0"
+}
+
+// temperaturePerDay reads daily air temperature from the sensor rollups
+func temperaturePerDay(from, to time.Time) ([]TemperatureDay, error) {
+	buckets, err := sensors.Aggregate(sensors.Temperature, "", "1d", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]TemperatureDay, 0, len(buckets))
+	for _, b := range buckets {
+		days = append(days, TemperatureDay{Day: b.Start, Mean: b.Avg, Min: b.Min, Max: b.Max, Samples: b.Count})
+	}
+	return days, nil
+}
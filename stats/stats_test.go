@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"iot-backend-cursor/database"
+	"iot-backend-cursor/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ActionHistory{}, &models.SensorReading{}, &models.SensorRollup{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+}
+
+func action(t *testing.T, deviceType, source string, status models.ActionStatus, value int, start time.Time, end *time.Time) {
+	t.Helper()
+	a := models.ActionHistory{DeviceType: deviceType, TriggerSource: source, Status: status, Value: value, StartTime: start, EndTime: end}
+	if err := database.DB.Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	setupDB(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	yesterday := today.AddDate(0, 0, -1)
+
+	action(t, "FEEDER", "SCHEDULE", "SUCCESS", 10, yesterday.Add(8*time.Hour), nil)
+	action(t, "FEEDER", "MANUAL", "SUCCESS", 20, yesterday.Add(12*time.Hour), nil)
+	action(t, "FEEDER", "SCHEDULE", "FAILED", 10, yesterday.Add(16*time.Hour), nil)
+
+	uvEnd := yesterday.Add(11 * time.Hour)
+	action(t, "UV", "SCHEDULE", "SUCCESS", 0, yesterday.Add(9*time.Hour), &uvEnd)
+	planned := now.Add(time.Hour)
+	action(t, "UV", "MANUAL", "RUNNING", 0, now.Add(-30*time.Minute), &planned)
+
+	report, err := Compute(yesterday, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.FeedingPerDay) != 2 || report.FeedingPerDay[0].Grams != 30 || report.FeedingPerDay[0].Feeds != 2 {
+		t.Errorf("feeding per day = %+v", report.FeedingPerDay)
+	}
+	if len(report.FeedsByTrigger) != 2 || report.FeedsByTrigger[0].TriggerSource != "MANUAL" || report.FeedsByTrigger[0].Grams != 20 {
+		t.Errorf("feeds by trigger = %+v", report.FeedsByTrigger)
+	}
+
+	feeder := report.Outcomes[0]
+	if feeder.DeviceType != "FEEDER" || feeder.Total != 3 || feeder.FailureRate < 0.33 || feeder.FailureRate > 0.34 {
+		t.Errorf("feeder outcomes = %+v", feeder)
+	}
+
+	if report.UVHoursPerDay[0].Hours != 2 {
+		t.Errorf("UV hours yesterday = %v, want 2", report.UVHoursPerDay[0].Hours)
+	}
+	// The running lamp counts until now, not its planned end
+	if today.Before(now.Add(-30*time.Minute)) && report.UVHoursPerDay[1].Hours != 0.5 {
+		t.Errorf("UV hours today = %v, want 0.5", report.UVHoursPerDay[1].Hours)
+	}
+}
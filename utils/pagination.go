@@ -11,6 +11,11 @@ type PaginationParams struct {
 	Page     int
 	PageSize int
 	Offset   int
+
+	// Keyset pagination: enabled by a ?cursor= parameter (empty for the first
+	// page), then continued with next_cursor from the previous response
+	Keyset bool
+	Cursor string
 }
 
 // PaginationResponse holds pagination metadata
@@ -43,11 +48,14 @@ func GetPaginationParams(c *gin.Context, defaultPageSize int, maxPageSize int) P
 	}
 
 	offset := (page - 1) * pageSize
+	cursor, keyset := c.GetQuery("cursor")
 
 	return PaginationParams{
 		Page:     page,
 		PageSize: pageSize,
 		Offset:   offset,
+		Keyset:   keyset,
+		Cursor:   cursor,
 	}
 }
 
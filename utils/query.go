@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TimeRange holds the optional from/to bounds of a list query. From is
+// inclusive and To is exclusive.
+type TimeRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// GetTimeRange parses the optional from/to query parameters, each RFC3339 or
+// YYYY-MM-DD in local time. A date in to includes that whole day.
+func GetTimeRange(c *gin.Context) (TimeRange, error) {
+	var r TimeRange
+	for _, param := range []string{"from", "to"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.ParseInLocation("2006-01-02", value, time.Local)
+			if dayErr != nil {
+				return r, fmt.Errorf("%s must be RFC3339 or YYYY-MM-DD", param)
+			}
+			t = day
+			if param == "to" {
+				t = day.AddDate(0, 0, 1)
+			}
+		}
+		if param == "from" {
+			r.From = &t
+		} else {
+			r.To = &t
+		}
+	}
+
+	if r.From != nil && r.To != nil && r.To.Before(*r.From) {
+		return r, errors.New("to must not be before from")
+	}
+	return r, nil
+}
+
+// Apply restricts column to the range
+func (r TimeRange) Apply(query *gorm.DB, column string) *gorm.DB {
+	if r.From != nil {
+		query = query.Where(column+" >= ?", *r.From)
+	}
+	if r.To != nil {
+		query = query.Where(column+" < ?", *r.To)
+	}
+	return query
+}
+
+// QueryList returns the values of a multi-value filter given repeated
+// (?status=SUCCESS&status=FAILED) or comma-separated (?status=SUCCESS,FAILED)
+func QueryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(key) {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// WhereIn filters column by the values of a multi-value query parameter
+func WhereIn(c *gin.Context, query *gorm.DB, key, column string) *gorm.DB {
+	if values := QueryList(c, key); len(values) > 0 {
+		query = query.Where(column+" IN ?", values)
+	}
+	return query
+}
+
+// SortParams is a validated ?sort= parameter; ties are broken by id
+type SortParams struct {
+	Field string
+	Desc  bool
+}
+
+// GetSortParams parses ?sort=field (ascending) or ?sort=-field (descending).
+// Only fields in allowed (JSON names that match column names) are accepted.
+func GetSortParams(c *gin.Context, allowed []string, defaultSort string) (SortParams, error) {
+	value := c.DefaultQuery("sort", defaultSort)
+	sort := SortParams{Field: strings.TrimPrefix(value, "-"), Desc: strings.HasPrefix(value, "-")}
+
+	for _, field := range allowed {
+		if field == sort.Field {
+			return sort, nil
+		}
+	}
+	return sort, fmt.Errorf("sort must be one of %s (prefix with - for descending)", strings.Join(allowed, ", "))
+}
+
+// String returns the sort in its query parameter form
+func (s SortParams) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Order returns the ORDER BY clause
+func (s SortParams) Order() string {
+	direction := "ASC"
+	if s.Desc {
+		direction = "DESC"
+	}
+	if s.Field == "id" {
+		return "id " + direction
+	}
+	return fmt.Sprintf("%s %s, id %s", s.Field, direction, direction)
+}
+
+// cursor is the decoded form of a keyset pagination cursor
+type cursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// Paginate orders query and applies either offset pagination or, in keyset
+// mode, the cursor condition. Keyset mode fetches one extra row so
+// BuildCursorResponse can tell whether there is a next page.
+func Paginate(query *gorm.DB, params PaginationParams, sort SortParams) (*gorm.DB, error) {
+	query = query.Order(sort.Order())
+	if !params.Keyset {
+		return query.Offset(params.Offset).Limit(params.PageSize), nil
+	}
+
+	if params.Cursor != "" {
+		after, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after.Sort != sort.String() {
+			return nil, errors.New("cursor was issued for a different sort")
+		}
+
+		op := ">"
+		if sort.Desc {
+			op = "<"
+		}
+		if sort.Field == "id" {
+			query = query.Where("id "+op+" ?", after.ID)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", sort.Field, op, sort.Field, op),
+				after.Value, after.Value, after.ID)
+		}
+	}
+	return query.Limit(params.PageSize + 1), nil
+}
+
+// CursorResponse holds keyset pagination metadata
+type CursorResponse struct {
+	PageSize   int    `json:"page_size"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// BuildCursorResponse trims the extra row fetched by Paginate from the slice
+// rows points to and returns the metadata with the cursor of the next page
+func BuildCursorResponse(rows interface{}, params PaginationParams, sort SortParams) CursorResponse {
+	resp := CursorResponse{PageSize: params.PageSize, Sort: sort.String()}
+
+	slice := reflect.ValueOf(rows).Elem()
+	if slice.Len() <= params.PageSize {
+		return resp
+	}
+	slice.Set(slice.Slice(0, params.PageSize))
+
+	last := reflect.Indirect(slice.Index(params.PageSize - 1))
+	resp.HasMore = true
+	resp.NextCursor = encodeCursor(cursor{
+		Sort:  sort.String(),
+		Value: jsonField(last, sort.Field),
+		ID:    uint(last.FieldByName("ID").Uint()),
+	})
+	return resp
+}
+
+// jsonField returns the value of the struct field with the given JSON name
+func jsonField(v reflect.Value, name string) interface{} {
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if tag == name {
+			return v.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+
+	// Times are encoded as RFC3339 strings; compare them as times again
+	if s, ok := c.Value.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			c.Value = t
+		}
+	}
+	return c, nil
+}
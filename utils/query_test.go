@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+	return c
+}
+
+func TestGetTimeRange(t *testing.T) {
+	r, err := GetTimeRange(testContext("from=2026-01-01&to=2026-01-31"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local); !r.From.Equal(want) {
+		t.Errorf("from %v, want %v", r.From, want)
+	}
+	// A date in to includes the whole day; to is exclusive
+	if want := time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local); !r.To.Equal(want) {
+		t.Errorf("to %v, want %v", r.To, want)
+	}
+
+	r, err = GetTimeRange(testContext("to=2026-01-31T12:00:00%2B07:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.From != nil || r.To.Unix() != time.Date(2026, 1, 31, 5, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("unexpected range %v - %v", r.From, r.To)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2026-13-01", "from=2026-02-01&to=2026-01-01"} {
+		if _, err := GetTimeRange(testContext(query)); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+// event is a minimal row for pagination tests
+type event struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StartTime time.Time `json:"start_time"`
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&event{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestKeysetPaginationWithTies(t *testing.T) {
+	db := setupDB(t)
+
+	// Seven rows on three start times, so most pages end inside a tie
+	base := time.Now()
+	for _, offset := range []time.Duration{0, 0, 0, time.Minute, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		db.Create(&event{StartTime: base.Add(offset)})
+	}
+
+	sort, err := GetSortParams(testContext("sort=-start_time"), []string{"start_time", "id"}, "-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []uint
+	db.Model(&event{}).Order(sort.Order()).Pluck("id", &want)
+
+	var got []uint
+	params := PaginationParams{PageSize: 2, Keyset: true}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("pagination does not end")
+		}
+
+		query, err := Paginate(db.Model(&event{}), params, sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []event
+		if err := query.Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		resp := BuildCursorResponse(&rows, params, sort)
+		if len(rows) > params.PageSize {
+			t.Fatalf("page has %d rows, want at most %d", len(rows), params.PageSize)
+		}
+		for _, row := range rows {
+			got = append(got, row.ID)
+		}
+		if !resp.HasMore {
+			break
+		}
+		params.Cursor = resp.NextCursor
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("paged ids %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("paged ids %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPaginateRejectsForeignCursor(t *testing.T) {
+	db := setupDB(t)
+	byTime := SortParams{Field: "start_time", Desc: true}
+
+	cursor := encodeCursor(cursor{Sort: "id", ID: 3})
+	if _, err := Paginate(db, PaginationParams{PageSize: 2, Keyset: true, Cursor: cursor}, byTime); err == nil {
+		t.Error("expected error for a cursor of another sort")
+	}
+	if _, err := Paginate(db, PaginationParams{PageSize: 2, Keyset: true, Cursor: "not-a-cursor"}, byTime); err == nil {
+		t.Error("expected error for an invalid cursor")
+	}
+}